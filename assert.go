@@ -0,0 +1,40 @@
+package localcache
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Number of bytes of differing content included in AssertContent errors.
+const assertExcerptLen = 16
+
+// AssertContent returns an error if the entry for key is missing or its
+// content is not want.
+//
+// The error describes the mismatch, including the lengths of the content and
+// an excerpt of each at the first differing byte. This is intended for tests
+// and integrity checks.
+func (c *Cache) AssertContent(key string, want []byte) error {
+	got, err := c.ReadFile(key)
+	if err != nil {
+		return fmt.Errorf("content of %q could not be read: %w", key, err)
+	}
+	if bytes.Equal(got, want) {
+		return nil
+	}
+	offset := 0
+	for offset < len(got) && offset < len(want) && got[offset] == want[offset] {
+		offset++
+	}
+	return fmt.Errorf("content of %q differs at byte %d: got %d bytes %q, want %d bytes %q",
+		key, offset, len(got), excerpt(got, offset), len(want), excerpt(want, offset))
+}
+
+// excerpt returns up to assertExcerptLen bytes of data starting at offset.
+func excerpt(data []byte, offset int) []byte {
+	end := offset + assertExcerptLen
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[offset:end]
+}
@@ -0,0 +1,27 @@
+package localcache
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertContent(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("key", []byte("hello world"))
+	require.NoError(t, err)
+
+	err = cache.AssertContent("key", []byte("hello world"))
+	require.NoError(t, err)
+
+	err = cache.AssertContent("key", []byte("hello there"))
+	require.EqualError(t, err, `content of "key" differs at byte 6: got 11 bytes "world", want 11 bytes "there"`)
+
+	err = cache.AssertContent("key", []byte("hello"))
+	require.EqualError(t, err, `content of "key" differs at byte 5: got 11 bytes " world", want 5 bytes ""`)
+
+	err = cache.AssertContent("missing", []byte("hello"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorContains(t, err, `content of "missing" could not be read`)
+}
@@ -0,0 +1,127 @@
+package localcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// GetMany reads the entries for keys concurrently, returning the content of
+// each entry that exists.
+//
+// Missing keys are omitted from the result, while any other errors are
+// returned alongside the entries that were read successfully.
+func (c *Cache) GetMany(keys []string) (map[string][]byte, error) {
+	var (
+		lock sync.Mutex
+		out  = make(map[string][]byte, len(keys))
+		errs []error
+		wg   sync.WaitGroup
+		work = make(chan string)
+	)
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				data, err := c.ReadFile(key)
+				lock.Lock()
+				if err == nil {
+					out[key] = data
+				} else if !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, err)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		work <- key
+	}
+	close(work)
+	wg.Wait()
+	return out, errors.Join(errs...)
+}
+
+// WriteFiles writes each of entries to the Cache as its own file entry.
+//
+// Every entry is written to a Transaction before any are committed, and
+// partition directories are created at most once for the batch. The batch
+// is committed atomically: if writing or committing any entry fails, every
+// Transaction in the batch is rolled back and nothing is committed, and a
+// commit interrupted by a crash is completed by RecoverCommits.
+//
+// With WithMaxConcurrentWrites, slots for the whole batch are acquired
+// before any entry is written, so the batch must fit within the limit.
+func (c *Cache) WriteFiles(entries map[string][]byte) (err error) {
+	if err := c.writes.acquireN(len(entries)); err != nil {
+		return err
+	}
+	b := &writeBatch{dirs: map[string]bool{}, slots: len(entries)}
+	defer b.cancel(c.writes)
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var batch []Transaction
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, tx := range batch {
+			_ = c.Rollback(tx)
+		}
+	}()
+	for _, key := range keys {
+		tx, err := c.writeTx(key, entries[key], nil, b)
+		if err != nil {
+			return fmt.Errorf("failed to write %q: %w", key, err)
+		}
+		batch = append(batch, tx)
+	}
+	_, done, err := c.commitAll(context.Background(), batch, nil)
+	if done {
+		batch = nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return nil
+}
+
+// writeBatch is shared by the Transactions created by WriteFiles.
+//
+// A nil writeBatch creates each Transaction independently.
+type writeBatch struct {
+	// dirs are the partition directories known to exist.
+	dirs map[string]bool
+	// slots is the number of write slots acquired for the batch that have
+	// not yet been taken by a Transaction.
+	slots int
+}
+
+// acquire a write slot for a new Transaction, taking one of the batch's
+// slots if available.
+func (b *writeBatch) acquire(w *writeLimiter) error {
+	if b == nil || b.slots == 0 {
+		return w.acquire()
+	}
+	b.slots--
+	return nil
+}
+
+// cancel releases the slots acquired for the batch that were not taken.
+func (b *writeBatch) cancel(w *writeLimiter) {
+	for ; b.slots > 0; b.slots-- {
+		w.cancel()
+	}
+}
@@ -0,0 +1,223 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMany(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		var keys []string
+		expected := map[string][]byte{}
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			keys = append(keys, key)
+			if i%2 == 0 {
+				expected[key] = []byte(key)
+				require.NoError(t, cache.WriteFile(key, []byte(key)))
+			}
+		}
+		entries, err := cache.GetMany(keys)
+		require.NoError(t, err)
+		require.Equal(t, expected, entries)
+
+		entries, err = cache.GetMany(nil)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+}
+
+type mkdirCountFS struct {
+	FS
+	dirs map[string]int
+}
+
+func (f *mkdirCountFS) Mkdir(name string, perm os.FileMode) error {
+	f.dirs[name]++
+	return f.FS.Mkdir(name, perm)
+}
+
+func TestWriteFiles(t *testing.T) {
+	fs := &mkdirCountFS{FS: OSFS{}, dirs: map[string]int{}}
+	cache := NewForTesting(t, WithFS(fs))
+	entries := map[string][]byte{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		entries[key] = []byte(key)
+	}
+	require.NoError(t, cache.WriteFiles(entries))
+	for key, expected := range entries {
+		data, err := cache.ReadFile(key)
+		require.NoError(t, err)
+		require.Equal(t, expected, data)
+	}
+	for dir, n := range fs.dirs {
+		if isPartitionName(filepath.Base(dir)) {
+			require.Equal(t, 1, n, dir)
+		}
+	}
+	require.NoError(t, cache.WriteFiles(nil))
+}
+
+func TestWriteFilesRollback(t *testing.T) {
+	cache := NewForTesting(t)
+	tx, _, err := cache.Mkdir("dir")
+	require.NoError(t, err)
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	err = cache.WriteFiles(map[string][]byte{"a": []byte("a"), "dir": []byte("dir"), "z": []byte("z")})
+	require.ErrorIs(t, err, ErrKindMismatch)
+	require.Empty(t, cache.IfExists("a"))
+	require.Empty(t, cache.IfExists("z"))
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestWriteFilesLimit(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache(WithMaxConcurrentWrites(1))
+		err := cache.WriteFiles(map[string][]byte{"a": []byte("a"), "b": []byte("b")})
+		require.Error(t, err)
+		require.Empty(t, cache.IfExists("a"))
+	})
+}
+
+func TestWriteFilesConcurrentBatches(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache(WithMaxConcurrentWrites(4))
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < 8; i++ {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				batch := map[string][]byte{}
+				for j := 0; j < 3; j++ {
+					key := fmt.Sprintf("batch-%d-%d", i, j)
+					batch[key] = []byte(key)
+				}
+				errs <- cache.WriteFiles(batch)
+			}()
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("concurrent batches deadlocked")
+		}
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+		count, err := cache.Count()
+		require.NoError(t, err)
+		require.Equal(t, 24, count)
+	})
+}
+
+func TestWriteFilesFailFast(t *testing.T) {
+	cache := NewForTesting(t, WithMaxConcurrentWrites(2), WithFailFastWrites())
+	tx, f, err := cache.Create("held")
+	require.NoError(t, err)
+	_ = f.Close()
+	err = cache.WriteFiles(map[string][]byte{"a": []byte("a"), "b": []byte("b")})
+	require.ErrorIs(t, err, ErrTooManyWrites)
+
+	// The slot acquired before failing was returned.
+	require.NoError(t, cache.WriteFile("a", []byte("a")))
+	require.NoError(t, cache.Rollback(tx))
+	require.NoError(t, cache.WriteFiles(map[string][]byte{"a": []byte("a"), "b": []byte("b")}))
+}
+
+// renameHookFS calls hook before each Rename, failing it if hook returns an
+// error.
+type renameHookFS struct {
+	FS
+	hook func(oldpath, newpath string) error
+}
+
+func (f renameHookFS) Rename(oldpath, newpath string) error {
+	if err := f.hook(oldpath, newpath); err != nil {
+		return err
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+func TestWriteFilesCommitFails(t *testing.T) {
+	var failLink string
+	fs := renameHookFS{FS: OSFS{}, hook: func(oldpath, newpath string) error {
+		if newpath == failLink {
+			return errors.New("rename failed")
+		}
+		return nil
+	}}
+	cache := NewForTesting(t, WithFS(fs), WithIndex())
+	require.NoError(t, cache.WriteFile("a", []byte("old")))
+	failLink = cache.linkPath("a")
+
+	// Committing "a" fails after "b" and "c", whose partitions sort first,
+	// have been swapped, so they are swapped back.
+	err := cache.WriteFiles(map[string][]byte{"a": []byte("a"), "b": []byte("b"), "c": []byte("c")})
+	require.Error(t, err)
+	require.NoError(t, cache.AssertContent("a", []byte("old")))
+	require.Empty(t, cache.IfExists("b"))
+	require.Empty(t, cache.IfExists("c"))
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+	markers, err := filepath.Glob(filepath.Join(cache.root, pendingDir, "*"))
+	require.NoError(t, err)
+	require.Empty(t, markers)
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keys)
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	failLink = ""
+	require.NoError(t, cache.WriteFiles(map[string][]byte{"a": []byte("a"), "b": []byte("b")}))
+	require.NoError(t, cache.AssertContent("a", []byte("a")))
+	require.NoError(t, cache.AssertContent("b", []byte("b")))
+}
+
+func TestWriteFilesRecover(t *testing.T) {
+	var crashLink string
+	fs := renameHookFS{FS: OSFS{}, hook: func(oldpath, newpath string) error {
+		if newpath == crashLink {
+			panic("crash")
+		}
+		return nil
+	}}
+	cache := NewForTesting(t, WithFS(fs))
+	require.NoError(t, cache.WriteFile("a", []byte("old")))
+	crashLink = cache.linkPath("a")
+	require.Panics(t, func() {
+		_ = cache.WriteFiles(map[string][]byte{"a": []byte("a"), "b": []byte("b"), "c": []byte("c")})
+	})
+
+	// The interrupted batch is completed in full.
+	crashLink = ""
+	require.NoError(t, cache.RecoverCommits())
+	require.NoError(t, cache.AssertContent("a", []byte("a")))
+	require.NoError(t, cache.AssertContent("b", []byte("b")))
+	require.NoError(t, cache.AssertContent("c", []byte("c")))
+	markers, err := filepath.Glob(filepath.Join(cache.root, pendingDir, "*"))
+	require.NoError(t, err)
+	require.Empty(t, markers)
+}
@@ -0,0 +1,88 @@
+package localcache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// contentHash returns the hex SHA-256 of the content of a committed entry,
+// or of an in-flight Transaction's file or directory.
+//
+// Content is streamed through the hasher, decompressed as when read, so the
+// hash is independent of how the entry is stored. For directories the hash
+// covers the relative path and content digest of every file within it, so
+// that content can't be mistaken for the names that follow it.
+func (c *Cache) contentHash(path string) (string, error) {
+	info, err := c.fs.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	target := path
+	if dest, err := c.fs.Readlink(path); err == nil {
+		target = dest
+	}
+	h := sha256.New()
+	if info.IsDir() {
+		err = c.hashDir(h, target, "", 0)
+	} else {
+		err = c.hashEntry(h, target)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// hashEntry writes the decompressed content of the file entry target to h.
+func (c *Cache) hashEntry(h io.Writer, target string) error {
+	f, err := c.fs.Open(target)
+	if err != nil {
+		return err
+	}
+	r, err := c.entryReader(f, target)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(h, r)
+	return err
+}
+
+func (c *Cache) hashFile(h io.Writer, path string) error {
+	f, err := c.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+func (c *Cache) hashDir(h io.Writer, dir, rel string, depth int) error {
+	if err := c.checkDepth(dir, depth); err != nil {
+		return err
+	}
+	entries, err := c.fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		name := filepath.Join(rel, entry.Name())
+		if entry.IsDir() {
+			fmt.Fprintf(h, "d %s\x00", name)
+			if err := c.hashDir(h, path, name, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		fh := sha256.New()
+		if err := c.hashFile(fh, path); err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "f %s\x00%x", name, fh.Sum(nil))
+	}
+	return nil
+}
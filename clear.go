@@ -0,0 +1,46 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Clear removes every entry from the Cache, along with its metadata, key
+// index, trash and reservations, leaving an empty but usable Cache.
+//
+// Unlike Purge, entries are removed regardless of age, and in-flight
+// Transactions are lost and will fail to commit. Commits in progress are
+// waited for, and further commits are blocked until Clear completes.
+// Namespaces are separate caches and are not cleared.
+//
+// Clearing an empty Cache is a no-op. Failure to remove any part of the
+// Cache does not stop the rest being removed, and all such errors are
+// returned.
+func (c *Cache) Clear() error {
+	c.frozen.Lock()
+	defer c.frozen.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	paths, err := c.partitions()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{metaDir, indexFile, indexJournalDir, keysDir, trashDir, reservationsDir, pendingDir} {
+		paths = append(paths, filepath.Join(c.root, name))
+	}
+	var errs []error
+	for _, path := range paths {
+		if err := c.fs.RemoveAll(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to clear %s: %w", path, err))
+		}
+	}
+	if c.index != nil {
+		if err := c.withIndex(func(idx *keyIndex) { idx.reset(map[string]indexEntry{}) }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
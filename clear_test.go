@@ -0,0 +1,53 @@
+package localcache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClear(t *testing.T) {
+	cache := NewForTesting(t, WithIndex(), WithSoftDelete(time.Hour))
+	require.NoError(t, cache.Clear())
+
+	require.NoError(t, cache.WriteFileTTL("a", []byte("a"), time.Hour))
+	require.NoError(t, cache.WriteFile("b", []byte("b")))
+	require.NoError(t, cache.WriteFile("c", []byte("c")))
+	require.NoError(t, cache.Remove("c"))
+	ns, err := cache.Namespace("ns")
+	require.NoError(t, err)
+	require.NoError(t, ns.WriteFile("a", []byte("a")))
+
+	require.NoError(t, cache.Clear())
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Empty(t, keys)
+	require.Error(t, cache.Restore("c"))
+	entries, err := os.ReadDir(cache.root)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.Contains(t, []string{locksDir, namespacesDir}, entry.Name())
+	}
+	data, err := ns.ReadFile("a")
+	require.NoError(t, err)
+	require.Equal(t, "a", string(data))
+
+	// The cache is still usable.
+	require.NoError(t, cache.WriteFile("a", []byte("new")))
+	data, err = cache.ReadFile("a")
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	meta, err := cache.GetMeta("a")
+	require.NoError(t, err)
+	require.Zero(t, meta.TTL)
+	count, err = cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.NoError(t, cache.Clear())
+	require.NoError(t, cache.Clear())
+}
@@ -1,12 +1,24 @@
 package localcache
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
-type clocker interface {
+// Clock is the source of time used to timestamp and age cache entries.
+type Clock interface {
 	Now() time.Time
 	Since(time.Time) time.Duration
 }
 
+// WithClock sets the Clock used to timestamp and age entries.
+//
+// This is primarily useful for controlling time in tests, eg. with a
+// ManualClock. The default is the system clock.
+func WithClock(clock Clock) Option {
+	return func(c *Cache) { c.clock = clock }
+}
+
 type realClock struct{}
 
 func (realClock) Now() time.Time {
@@ -33,3 +45,44 @@ func (f *fakeClock) Since(t time.Time) time.Duration {
 func (f *fakeClock) advance(d time.Duration) {
 	f.currentTime = f.currentTime.Add(d)
 }
+
+// ManualClock is a Clock that only changes when Set or Advance is called.
+//
+// It is useful for asserting exact entry timestamps in tests.
+type ManualClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+var _ Clock = &ManualClock{}
+
+// NewManualClock returns a ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the time the clock is set to.
+func (m *ManualClock) Now() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.now
+}
+
+// Since returns the time elapsed between t and the clock's time.
+func (m *ManualClock) Since(t time.Time) time.Duration {
+	return m.Now().Sub(t)
+}
+
+// Set the clock to now.
+func (m *ManualClock) Set(now time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.now = now
+}
+
+// Advance the clock by d.
+func (m *ManualClock) Advance(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.now = m.now.Add(d)
+}
@@ -0,0 +1,311 @@
+package localcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// compressionMagic prefixes the content of compressed entries.
+var compressionMagic = []byte("\x00lcz")
+
+const (
+	compressionVersion = 1
+	// Magic, version, payload length and payload CRC-32.
+	compressionHeaderSize = 4 + 1 + 8 + 4
+)
+
+// WithCompression gzip compresses entries written with WriteFile.
+//
+// Compressed entries are transparently decompressed by every read, regardless
+// of whether the Cache reading them has compression enabled, and their
+// uncompressed size is recorded in their metadata. Entries written with
+// Create or Mkdir are not compressed.
+func WithCompression() Option {
+	return func(c *Cache) { c.compress = true }
+}
+
+// compress data, prefixing it with a header identifying it as compressed.
+//
+// The header contains the length and checksum of the compressed payload, so
+// raw content that happens to begin with the magic bytes is not mistaken for
+// compressed content.
+func compress(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, compressionHeaderSize))
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress entry: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress entry: %w", err)
+	}
+	out := buf.Bytes()
+	payload := out[compressionHeaderSize:]
+	copy(out, compressionMagic)
+	out[4] = compressionVersion
+	binary.BigEndian.PutUint64(out[5:], uint64(len(payload)))
+	binary.BigEndian.PutUint32(out[13:], crc32.ChecksumIEEE(payload))
+	return out, nil
+}
+
+// CompressionStats returns the total uncompressed size of all committed
+// file entries, and their total size on disk.
+//
+// Uncompressed entries contribute the same size to both totals. Directory
+// entries are not included.
+func (c *Cache) CompressionStats() (origBytes, storedBytes int64, err error) {
+	var rerr error
+	err = c.Range(func(info CacheInfo) bool {
+		if info.IsDir {
+			return true
+		}
+		target, err := c.fs.Readlink(info.Path)
+		if err != nil {
+			rerr = err
+			return false
+		}
+		meta, err := c.readMeta(target)
+		if err != nil {
+			rerr = err
+			return false
+		}
+		storedBytes += info.Size
+		if meta.OriginalSize > 0 {
+			origBytes += meta.OriginalSize
+		} else {
+			origBytes += info.Size
+		}
+		return true
+	})
+	if err == nil {
+		err = rerr
+	}
+	return origBytes, storedBytes, err
+}
+
+// Algo is a compression algorithm for entries created with CreateCompressed.
+type Algo string
+
+const (
+	// NoCompression stores entries as written.
+	NoCompression Algo = ""
+	// Gzip compresses entries with compress/gzip.
+	Gzip Algo = "gzip"
+	// Zlib compresses entries with compress/zlib.
+	Zlib Algo = "zlib"
+)
+
+func (a Algo) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch a {
+	case NoCompression:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zlib:
+		return zlib.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q", string(a))
+	}
+}
+
+func (a Algo) newReader(r io.Reader) (io.ReadCloser, error) {
+	switch a {
+	case NoCompression:
+		return ioutil.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zlib:
+		return zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %q", string(a))
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// CreateCompressed creates a file in the Cache, as with Create, whose content
+// is compressed with algo as it is written.
+//
+// The algorithm is recorded in the entry's metadata, and OpenReader and
+// ReadFile transparently decompress the entry, so compressed and uncompressed
+// entries can be freely mixed in the same Cache. The returned writer must be
+// closed before the Transaction is committed.
+func (c *Cache) CreateCompressed(key string, algo Algo) (Transaction, io.WriteCloser, error) {
+	if _, err := algo.newWriter(ioutil.Discard); err != nil {
+		return "", nil, err
+	}
+	tx, f, err := c.create(key)
+	if err != nil {
+		return "", nil, err
+	}
+	target := c.txPath(tx)
+	if err := c.updateMeta(target, func(meta *EntryMeta) { meta.Compression = algo }); err != nil {
+		_ = f.Close()
+		_ = c.Rollback(tx)
+		return "", nil, err
+	}
+	w, _ := algo.newWriter(f)
+	return tx, &compressingWriter{cache: c, target: target, w: w, f: f}, nil
+}
+
+// compressingWriter compresses content into an in-flight file, recording its
+// uncompressed size in the entry's metadata when closed.
+type compressingWriter struct {
+	cache  *Cache
+	target string
+	w      io.WriteCloser
+	f      File
+	size   int64
+}
+
+func (w *compressingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *compressingWriter) Close() error {
+	err := w.w.Close()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close compressed file: %w", err)
+	}
+	return w.cache.updateMeta(w.target, func(meta *EntryMeta) { meta.OriginalSize = w.size })
+}
+
+// OpenReader opens the file identified by key for reading, decompressing it
+// if it was compressed by CreateCompressed or WithCompression.
+func (c *Cache) OpenReader(key string) (io.ReadCloser, error) {
+	f, target, err := c.openEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.entryReader(f, target)
+}
+
+// entryReader returns a reader over the content of an opened entry target,
+// decompressing it if it was compressed by CreateCompressed, according to
+// its metadata, or by WithCompression, according to its header.
+//
+// All reads of entry content go through entryReader. If the entry is not
+// compressed f itself is returned, positioned at its start. Closing the
+// reader closes f.
+func (c *Cache) entryReader(f File, target string) (io.ReadCloser, error) {
+	algo := NoCompression
+	if c.owns(target) {
+		meta, err := c.readMeta(target)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		algo = meta.Compression
+	}
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	if algo != NoCompression {
+		r, err = algo.newReader(f)
+	} else {
+		r, err = headerReader(f)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to decompress entry: %w", err)
+	}
+	if r == nil {
+		return f, nil
+	}
+	return &decompressingReader{ReadCloser: r, f: f}, nil
+}
+
+// headerReader returns a reader decompressing f if its content has a valid
+// compression header, as written by WithCompression, or nil with f rewound
+// to its start if not.
+//
+// The payload's checksum is verified before decompressing, so raw content
+// that happens to begin with the magic bytes is not mistaken for compressed
+// content.
+func headerReader(f File) (io.ReadCloser, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() || info.Size() < compressionHeaderSize {
+		return nil, nil
+	}
+	header := make([]byte, compressionHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, err
+	}
+	valid := bytes.HasPrefix(header, compressionMagic) &&
+		header[4] == compressionVersion &&
+		binary.BigEndian.Uint64(header[5:]) == uint64(info.Size()-compressionHeaderSize)
+	if valid {
+		h := crc32.NewIEEE()
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		valid = h.Sum32() == binary.BigEndian.Uint32(header[13:])
+	}
+	if !valid {
+		_, err := f.Seek(0, io.SeekStart)
+		return nil, err
+	}
+	if _, err := f.Seek(compressionHeaderSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return gzip.NewReader(f)
+}
+
+// contentSize returns the size of the content of an opened entry target,
+// which is its uncompressed size if it is compressed. f is left positioned
+// at its start.
+func (c *Cache) contentSize(f File, target string, info os.FileInfo) (int64, error) {
+	if info.IsDir() {
+		return info.Size(), nil
+	}
+	if c.owns(target) {
+		meta, err := c.readMeta(target)
+		if err != nil {
+			return 0, err
+		}
+		// Only compressed entries record their original size.
+		if meta.Compression != NoCompression || meta.OriginalSize > 0 {
+			return meta.OriginalSize, nil
+		}
+	}
+	r, err := headerReader(f)
+	if err != nil || r == nil {
+		return info.Size(), err
+	}
+	size, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decompress entry: %w", err)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return size, err
+}
+
+type decompressingReader struct {
+	io.ReadCloser
+	f File
+}
+
+func (r *decompressingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
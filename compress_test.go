@@ -0,0 +1,218 @@
+package localcache
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	cache := NewForTesting(t, WithCompression())
+	compressible := strings.Repeat("hello world ", 1000)
+	err := cache.WriteFile("compressed", []byte(compressible))
+	require.NoError(t, err)
+	data, err := cache.ReadFile("compressed")
+	require.NoError(t, err)
+	require.Equal(t, compressible, string(data))
+
+	tx, f, err := cache.Create("raw")
+	require.NoError(t, err)
+	_, err = f.WriteString("raw")
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	orig, stored, err := cache.CompressionStats()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(compressible)+len("raw")), orig)
+	require.Less(t, stored, orig)
+}
+
+func TestCompressionMagicInRawEntry(t *testing.T) {
+	cache := NewForTesting(t, WithCompression())
+	raw := append(append([]byte(nil), compressionMagic...), "\x01not compressed at all"...)
+	tx, f, err := cache.Create("raw")
+	require.NoError(t, err)
+	_, err = f.Write(raw)
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	data, err := cache.ReadFile("raw")
+	require.NoError(t, err)
+	require.Equal(t, raw, data)
+
+	// Corrupting a compressed entry's payload makes it read back raw.
+	compressed, err := compress([]byte("hello"))
+	require.NoError(t, err)
+	compressed[len(compressed)-1] ^= 0xff
+	tx, f, err = cache.Create("corrupt")
+	require.NoError(t, err)
+	_, err = f.Write(compressed)
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	data, err = cache.ReadFile("corrupt")
+	require.NoError(t, err)
+	require.Equal(t, compressed, data)
+}
+
+func TestCompressedReads(t *testing.T) {
+	content := strings.Repeat("hello world ", 1000)
+	schemes := map[string]func(t *testing.T, cache *Cache){
+		"WithCompression": func(t *testing.T, cache *Cache) {
+			require.NoError(t, cache.WriteFile("test", []byte(content)))
+		},
+		"Gzip": func(t *testing.T, cache *Cache) { writeCompressed(t, cache, Gzip, content) },
+		"Zlib": func(t *testing.T, cache *Cache) { writeCompressed(t, cache, Zlib, content) },
+	}
+	reads := map[string]func(t *testing.T, cache *Cache){
+		"ReadFile": func(t *testing.T, cache *Cache) {
+			data, err := cache.ReadFile("test")
+			require.NoError(t, err)
+			require.Equal(t, content, string(data))
+		},
+		"OpenReader": func(t *testing.T, cache *Cache) {
+			r, err := cache.OpenReader("test")
+			require.NoError(t, err)
+			defer r.Close()
+			data, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, content, string(data))
+		},
+		"GetFresh": func(t *testing.T, cache *Cache) {
+			data, found, err := cache.GetFresh("test", time.Hour)
+			require.NoError(t, err)
+			require.True(t, found)
+			require.Equal(t, content, string(data))
+		},
+		"ReadRange": func(t *testing.T, cache *Cache) {
+			data, err := cache.ReadRange("test", 6, 11)
+			require.NoError(t, err)
+			require.Equal(t, content[6:17], string(data))
+			data, err = cache.ReadRange("test", int64(len(content))+1, 5)
+			require.NoError(t, err)
+			require.Empty(t, data)
+		},
+		"ReadFileLimit": func(t *testing.T, cache *Cache) {
+			data, err := cache.ReadFileLimit("test", int64(len(content)))
+			require.NoError(t, err)
+			require.Equal(t, content, string(data))
+			_, err = cache.ReadFileLimit("test", int64(len(content))-1)
+			require.ErrorIs(t, err, ErrTooLarge)
+		},
+		"ServeContent": func(t *testing.T, cache *Cache) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/test", nil)
+			r.Header.Set("Range", "bytes=6-16")
+			require.NoError(t, cache.ServeContent(w, r, "test"))
+			require.Equal(t, http.StatusPartialContent, w.Code)
+			require.Equal(t, content[6:17], w.Body.String())
+		},
+		"FS": func(t *testing.T, cache *Cache) {
+			name := cache.Hash("test")
+			data, err := fs.ReadFile(cache.FS(), name)
+			require.NoError(t, err)
+			require.Equal(t, content, string(data))
+			info, err := fs.Stat(cache.FS(), name)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(content)), info.Size())
+		},
+		"CheckoutCopy": func(t *testing.T, cache *Cache) {
+			dest := filepath.Join(t.TempDir(), "test")
+			require.NoError(t, cache.CheckoutCopy("test", dest))
+			data, err := os.ReadFile(dest)
+			require.NoError(t, err)
+			require.Equal(t, content, string(data))
+		},
+		"CopyTo": func(t *testing.T, cache *Cache) {
+			dest := filepath.Join(t.TempDir(), "test")
+			require.NoError(t, cache.CopyTo("test", dest))
+			data, err := os.ReadFile(dest)
+			require.NoError(t, err)
+			require.Equal(t, content, string(data))
+		},
+	}
+	for scheme, write := range schemes {
+		for read, check := range reads {
+			t.Run(scheme+"/"+read, func(t *testing.T) {
+				writer := NewForTesting(t, WithCompression())
+				write(t, writer)
+				// Decompression must not depend on the reader's options.
+				check(t, newCache(writer.root, nil))
+			})
+		}
+	}
+}
+
+func writeCompressed(t *testing.T, cache *Cache, algo Algo, content string) {
+	t.Helper()
+	tx, w, err := cache.CreateCompressed("test", algo)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+}
+
+func TestCreateCompressed(t *testing.T) {
+	cache := NewForTesting(t)
+	compressible := strings.Repeat("hello world ", 1000)
+	for _, algo := range []Algo{Gzip, Zlib} {
+		key := "compressed-" + string(algo)
+		tx, w, err := cache.CreateCompressed(key, algo)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(compressible))
+		require.NoError(t, err)
+		err = w.Close()
+		require.NoError(t, err)
+		_, err = cache.Commit(tx)
+		require.NoError(t, err)
+
+		data, err := cache.ReadFile(key)
+		require.NoError(t, err)
+		require.Equal(t, compressible, string(data))
+		r, err := cache.OpenReader(key)
+		require.NoError(t, err)
+		data, err = ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, compressible, string(data))
+
+		meta, err := cache.GetMeta(key)
+		require.NoError(t, err)
+		require.Equal(t, algo, meta.Compression)
+		require.Equal(t, int64(len(compressible)), meta.OriginalSize)
+		require.Less(t, meta.Size, meta.OriginalSize)
+	}
+
+	err := cache.WriteFile("raw", []byte("raw data"))
+	require.NoError(t, err)
+	data, err := cache.ReadFile("raw")
+	require.NoError(t, err)
+	require.Equal(t, "raw data", string(data))
+	r, err := cache.OpenReader("raw")
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "raw data", string(data))
+
+	_, err = cache.ReadFileLimit("compressed-gzip", 100)
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	_, _, err = cache.CreateCompressed("invalid", Algo("lz4"))
+	require.Error(t, err)
+}
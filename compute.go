@@ -0,0 +1,97 @@
+package localcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// GetOrCompute returns the content of the entry for key, calling compute to
+// write it to a new entry if there is none.
+//
+// Concurrent calls for the same key within the process are coalesced, so
+// that only one calls compute while the others wait for and share its
+// result. If compute fails the Transaction is rolled back and the error is
+// returned to every waiting caller.
+func (c *Cache) GetOrCompute(key string, compute func(w io.Writer) error) ([]byte, error) {
+	data, err := c.ReadFile(key)
+	if !errors.Is(err, os.ErrNotExist) {
+		return data, err
+	}
+	return c.flights.do(key, func() ([]byte, error) {
+		// Another caller may have committed the entry since the read above.
+		data, err := c.ReadFile(key)
+		if !errors.Is(err, os.ErrNotExist) {
+			return data, err
+		}
+		return c.compute(key, compute)
+	})
+}
+
+func (c *Cache) compute(key string, compute func(w io.Writer) error) (data []byte, err error) {
+	tx, f, err := c.create(key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			data = nil
+		}
+	}()
+	// Runs first, so a failed commit also discards data.
+	defer c.RollbackOrCommit(tx, &err)
+	// Closed before rolling back if compute panics.
+	defer f.Close() //nolint:errcheck
+	buf := &bytes.Buffer{}
+	err = compute(io.MultiWriter(f, buf))
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to close file: %w", cerr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flightGroup coalesces concurrent calls for the same key.
+type flightGroup struct {
+	lock    sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// do calls fn, unless a call for key is already in flight, in which case it
+// waits for that call. Each caller receives its own copy of the result.
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.lock.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.lock.Unlock()
+		<-f.done
+		return append([]byte(nil), f.data...), f.err
+	}
+	if g.flights == nil {
+		g.flights = map[string]*flight{}
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.lock.Unlock()
+
+	defer func() {
+		g.lock.Lock()
+		delete(g.flights, key)
+		g.lock.Unlock()
+		close(f.done)
+	}()
+	// Reported to waiters if fn panics.
+	f.err = fmt.Errorf("computation of %q panicked", key)
+	f.data, f.err = fn()
+	return append([]byte(nil), f.data...), f.err
+}
@@ -0,0 +1,103 @@
+package localcache
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOrCompute(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		var calls int32
+		release := make(chan struct{})
+		compute := func(w io.Writer) error {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			_, err := w.Write([]byte("computed"))
+			return err
+		}
+
+		var wg sync.WaitGroup
+		results := make([][]byte, 10)
+		errs := make([]error, 10)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], errs[i] = cache.GetOrCompute("key", compute)
+			}(i)
+		}
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		for i := range results {
+			require.NoError(t, errs[i])
+			require.Equal(t, "computed", string(results[i]))
+		}
+
+		data, err := cache.GetOrCompute("key", func(w io.Writer) error {
+			return fmt.Errorf("should not be called")
+		})
+		require.NoError(t, err)
+		require.Equal(t, "computed", string(data))
+	})
+}
+
+func TestGetOrComputeError(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		_, err := cache.GetOrCompute("key", func(w io.Writer) error {
+			_, _ = w.Write([]byte("partial"))
+			return fmt.Errorf("failed")
+		})
+		require.EqualError(t, err, "failed")
+		require.Empty(t, cache.IfExists("key"))
+		pending, err := cache.PendingTransactions()
+		require.NoError(t, err)
+		require.Empty(t, pending)
+	})
+}
+
+func TestGetOrComputeCommitFails(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		data, err := cache.GetOrCompute("key", func(w io.Writer) error {
+			// Closing the Cache makes the commit fail.
+			require.NoError(t, cache.Close())
+			_, err := w.Write([]byte("computed"))
+			return err
+		})
+		require.ErrorIs(t, err, ErrClosed)
+		require.Nil(t, data)
+	})
+}
+
+func TestGetOrComputePanic(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		require.Panics(t, func() {
+			_, _ = cache.GetOrCompute("key", func(w io.Writer) error {
+				_, _ = w.Write([]byte("partial"))
+				panic("failed")
+			})
+		})
+		require.Empty(t, cache.IfExists("key"))
+		pending, err := cache.PendingTransactions()
+		require.NoError(t, err)
+		require.Empty(t, pending)
+
+		data, err := cache.GetOrCompute("key", func(w io.Writer) error {
+			_, err := w.Write([]byte("computed"))
+			return err
+		})
+		require.NoError(t, err)
+		require.Equal(t, "computed", string(data))
+	})
+}
@@ -0,0 +1,136 @@
+package localcache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CheckoutCopy copies the committed entry for key to destPath, which must
+// not exist, giving the caller an independent copy that can be modified
+// without affecting the Cache.
+//
+// The entry is copied as with CopyTo. If key has no entry an error wrapping
+// ErrNotFound is returned.
+func (c *Cache) CheckoutCopy(key, destPath string) error {
+	return c.copyOut(key, destPath, false)
+}
+
+// CopyTo copies the committed entry for key to dest on the local filesystem,
+// regardless of the Cache's FS.
+//
+// File entries are decompressed if necessary and streamed to a temporary
+// file alongside dest, which is then renamed over dest, so dest is replaced
+// atomically and keeps the permissions of the entry. Directory entries are
+// copied recursively, keeping the permissions of their files and
+// directories, to a temporary directory that is then renamed to dest, which
+// must not exist. If key has no entry an error wrapping ErrNotFound is
+// returned.
+func (c *Cache) CopyTo(key, dest string) error {
+	return c.copyOut(key, dest, true)
+}
+
+// copyOut copies the committed entry for key to dest on the local
+// filesystem, replacing dest if it is an existing file and replace is true.
+func (c *Cache) copyOut(key, dest string, replace bool) error {
+	f, target, err := c.openEntry(key)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := os.Lstat(dest); err == nil && (info.IsDir() || !replace) {
+		_ = f.Close()
+		return fmt.Errorf("cannot copy %q: %w", key, os.ErrExist)
+	}
+	tmp := fmt.Sprintf("%s.%x.tmp", dest, c.clock.Now().UnixNano())
+	if info.IsDir() {
+		_ = f.Close()
+		err = c.copyEntry(OSFS{}, tmp, c.fs, target, 0)
+	} else {
+		err = c.copyFileTo(f, target, tmp, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+		return fmt.Errorf("failed to copy %q: %w", key, err)
+	}
+	return nil
+}
+
+// copyFileTo copies the decompressed content of the open entry target f to a
+// new file at path with the given permissions.
+func (c *Cache) copyFileTo(f File, target, path string, perm os.FileMode) error {
+	r, err := c.entryReader(f, target)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// copyEntry recursively copies the file or directory at srcPath in srcFS to
+// dstPath in dstFS, preserving permissions.
+func (c *Cache) copyEntry(dstFS FS, dstPath string, srcFS FS, srcPath string, depth int) error {
+	info, err := srcFS.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return copyFile(dstFS, dstPath, srcFS, srcPath, info.Mode().Perm())
+	}
+	if err := c.checkDepth(srcPath, depth); err != nil {
+		return err
+	}
+	if err := dstFS.Mkdir(dstPath, c.dirPerm()); err != nil {
+		return err
+	}
+	entries, err := srcFS.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := c.copyEntry(dstFS, filepath.Join(dstPath, entry.Name()), srcFS, filepath.Join(srcPath, entry.Name()), depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	// Applied last so read-only directories can still be filled.
+	return dstFS.Chmod(dstPath, info.Mode().Perm())
+}
+
+// copyFile copies the file at srcPath in srcFS to a new file at dstPath in
+// dstFS with the given permissions.
+func copyFile(dstFS FS, dstPath string, srcFS FS, srcPath string, perm os.FileMode) error {
+	r, err := srcFS.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := dstFS.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return dstFS.Chmod(dstPath, perm)
+}
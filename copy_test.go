@@ -0,0 +1,144 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckoutCopy(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("test", []byte("hello"))
+	require.NoError(t, err)
+
+	dest := filepath.Join(t.TempDir(), "checkout")
+	err = cache.CheckoutCopy("test", dest)
+	require.NoError(t, err)
+	err = os.WriteFile(dest, []byte("modified"), 0600)
+	require.NoError(t, err)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	err = cache.CheckoutCopy("test", dest)
+	require.ErrorIs(t, err, os.ErrExist)
+	err = cache.CheckoutCopy("missing", filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	err = cache.ReplaceDir("dir", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file"), []byte("hello"), 0600)
+	})
+	require.NoError(t, err)
+	destDir := filepath.Join(t.TempDir(), "dir")
+	err = cache.CheckoutCopy("dir", destDir)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(destDir, "file"), []byte("modified"), 0600)
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(cache.IfExists("dir"), "file"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+}
+
+func TestCheckoutCopyCompressed(t *testing.T) {
+	writer := NewForTesting(t, WithCompression())
+	err := writer.WriteFile("test", []byte("hello"))
+	require.NoError(t, err)
+
+	// Entries are decompressed whether or not the reading Cache compresses.
+	for _, cache := range []*Cache{writer, newCache(writer.root, nil)} {
+		dir := t.TempDir()
+		err = cache.CheckoutCopy("test", filepath.Join(dir, "checkout"))
+		require.NoError(t, err)
+		err = cache.CopyTo("test", filepath.Join(dir, "copy"))
+		require.NoError(t, err)
+		for _, name := range []string{"checkout", "copy"} {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			require.NoError(t, err)
+			require.Equal(t, "hello", string(data))
+		}
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	cache := NewForTesting(t)
+	tx, f, err := cache.Create("tool")
+	require.NoError(t, err)
+	_, err = f.WriteString("#!/bin/sh\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Chmod(0755))
+	require.NoError(t, f.Close())
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	bin := t.TempDir()
+	dest := filepath.Join(bin, "tool")
+	require.NoError(t, os.WriteFile(dest, []byte("old"), 0600))
+	err = cache.CopyTo("tool", dest)
+	require.NoError(t, err)
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh\n", string(data))
+	info, err := os.Stat(dest)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	err = cache.ReplaceDir("dir", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "nested"), []byte("nested"), 0600)
+	})
+	require.NoError(t, err)
+	err = cache.CopyTo("dir", filepath.Join(bin, "dir"))
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(bin, "dir", "nested"))
+	require.NoError(t, err)
+	require.Equal(t, "nested", string(data))
+	err = cache.CopyTo("dir", filepath.Join(bin, "dir"))
+	require.ErrorIs(t, err, os.ErrExist)
+
+	err = cache.CopyTo("missing", filepath.Join(bin, "missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+	entries, err := os.ReadDir(bin)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestCopyToDirPerms(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.ReplaceDir("dir", func(dir string) error {
+		if err := os.WriteFile(filepath.Join(dir, "script"), []byte("#!/bin/sh"), 0750); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "data"), []byte("data"), 0640); err != nil {
+			return err
+		}
+		sub := filepath.Join(dir, "sub")
+		if err := os.Mkdir(sub, 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(sub, "file"), []byte("file"), 0600); err != nil {
+			return err
+		}
+		return os.Chmod(sub, 0550)
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(cache.IfExists("dir"), "sub"), 0700) })
+
+	dest := filepath.Join(t.TempDir(), "dir")
+	err = cache.CopyTo("dir", dest)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(dest, "sub"), 0700) })
+	for name, perm := range map[string]os.FileMode{
+		"script":   0750,
+		"data":     0640,
+		"sub":      0550,
+		"sub/file": 0600,
+	} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		require.NoError(t, err)
+		require.Equal(t, perm, info.Mode().Perm(), name)
+	}
+}
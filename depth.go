@@ -0,0 +1,29 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDirTooDeep is returned when a directory entry is nested more deeply
+// than the limit set by WithMaxDirDepth.
+var ErrDirTooDeep = errors.New("localcache: directory entry too deep")
+
+// WithMaxDirDepth limits operations that walk directory entries, such as
+// Size, PurgeToInodes and MergeFrom, to recursing n levels below the entry's
+// root.
+//
+// Operations on entries nested more deeply fail with ErrDirTooDeep. This
+// guards against runaway nesting, such as a symlink loop within a directory
+// entry being copied. By default depth is unlimited.
+func WithMaxDirDepth(n int) Option {
+	return func(c *Cache) { c.maxDirDepth = n }
+}
+
+// checkDepth returns ErrDirTooDeep if depth exceeds the limit set by WithMaxDirDepth.
+func (c *Cache) checkDepth(dir string, depth int) error {
+	if c.maxDirDepth > 0 && depth > c.maxDirDepth {
+		return fmt.Errorf("%w: %q is more than %d levels deep", ErrDirTooDeep, dir, c.maxDirDepth)
+	}
+	return nil
+}
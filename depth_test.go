@@ -0,0 +1,37 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxDirDepth(t *testing.T) {
+	cache := NewForTesting(t, WithMaxDirDepth(5))
+	err := cache.ReplaceDir("shallow", func(dir string) error {
+		return os.MkdirAll(filepath.Join(dir, "a", "b", "c"), 0700)
+	})
+	require.NoError(t, err)
+	_, err = cache.Size()
+	require.NoError(t, err)
+
+	err = cache.ReplaceDir("deep", func(dir string) error {
+		return os.MkdirAll(filepath.Join(dir, strings.Repeat("a/", 10)), 0700)
+	})
+	require.NoError(t, err)
+	_, err = cache.Size()
+	require.ErrorIs(t, err, ErrDirTooDeep)
+
+	// A symlink loop is followed when copying, so must be caught.
+	src := NewForTesting(t)
+	err = src.ReplaceDir("loop", func(dir string) error {
+		return os.Symlink(".", filepath.Join(dir, "loop"))
+	})
+	require.NoError(t, err)
+	err = cache.MergeFrom(src, Overwrite)
+	require.ErrorIs(t, err, ErrDirTooDeep)
+	require.Empty(t, cache.IfExists("loop"))
+}
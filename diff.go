@@ -0,0 +1,76 @@
+package localcache
+
+import "sort"
+
+// Diff compares the committed entries of the Cache with those of other.
+//
+// Entries are matched by the hash of their key, so both caches must use the
+// same hashing scheme, and are identified in the results by their original
+// key if known, or otherwise their hash. Entry content is streamed through a
+// hasher rather than being loaded into memory, and is compared after
+// decompression, as with Push. Each result is sorted.
+func (c *Cache) Diff(other *Cache) (onlyHere, onlyThere, differing []string, err error) {
+	here, err := c.entriesByHash()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	there, err := other.entriesByHash()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for h, info := range here {
+		otherInfo, ok := there[h]
+		if !ok {
+			onlyHere = append(onlyHere, info.id())
+			continue
+		}
+		same, err := c.sameContent(info, other, otherInfo)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !same {
+			differing = append(differing, info.id())
+		}
+	}
+	for h, info := range there {
+		if _, ok := here[h]; !ok {
+			onlyThere = append(onlyThere, info.id())
+		}
+	}
+	sort.Strings(onlyHere)
+	sort.Strings(onlyThere)
+	sort.Strings(differing)
+	return onlyHere, onlyThere, differing, nil
+}
+
+func (c *Cache) sameContent(info CacheInfo, other *Cache, otherInfo CacheInfo) (bool, error) {
+	if info.IsDir != otherInfo.IsDir {
+		return false, nil
+	}
+	here, err := c.contentHash(info.Path)
+	if err != nil {
+		return false, err
+	}
+	there, err := other.contentHash(otherInfo.Path)
+	if err != nil {
+		return false, err
+	}
+	return here == there, nil
+}
+
+func (c *Cache) entriesByHash() (map[string]CacheInfo, error) {
+	out := map[string]CacheInfo{}
+	err := c.Range(func(info CacheInfo) bool {
+		out[info.Hash] = info
+		return true
+	})
+	return out, err
+}
+
+// id returns the key of the entry if known, or its hash.
+func (i CacheInfo) id() string {
+	if i.Key != "" {
+		return i.Key
+	}
+	return i.Hash
+}
@@ -0,0 +1,66 @@
+package localcache
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	a := NewForTesting(t)
+	b := NewForTesting(t)
+	for _, key := range []string{"same", "modified", "removed"} {
+		require.NoError(t, a.WriteFile(key, []byte(key)))
+		require.NoError(t, b.WriteFile(key, []byte(key)))
+	}
+	onlyHere, onlyThere, differing, err := a.Diff(b)
+	require.NoError(t, err)
+	require.Empty(t, onlyHere)
+	require.Empty(t, onlyThere)
+	require.Empty(t, differing)
+
+	require.NoError(t, a.WriteFile("added", []byte("added")))
+	require.NoError(t, a.Remove("removed"))
+	require.NoError(t, a.WriteFile("modified", []byte("changed")))
+
+	onlyHere, onlyThere, differing, err = a.Diff(b)
+	require.NoError(t, err)
+	require.Equal(t, []string{a.Hash("added")}, onlyHere)
+	require.Equal(t, []string{a.Hash("removed")}, onlyThere)
+	require.Equal(t, []string{a.Hash("modified")}, differing)
+}
+
+func TestDiffSorted(t *testing.T) {
+	a := NewForTesting(t)
+	b := NewForTesting(t)
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		keys = append(keys, a.Hash(key))
+		require.NoError(t, a.WriteFile(key, []byte(key)))
+	}
+	sort.Strings(keys)
+	for i := 0; i < 10; i++ {
+		onlyHere, _, _, err := a.Diff(b)
+		require.NoError(t, err)
+		require.Equal(t, keys, onlyHere)
+	}
+}
+
+func TestDiffCompressed(t *testing.T) {
+	a := NewForTesting(t, WithIndex())
+	b := NewForTesting(t, WithIndex(), WithCompression())
+	require.NoError(t, a.WriteFile("same", []byte("content")))
+	require.NoError(t, b.WriteFile("same", []byte("content")))
+	require.NoError(t, a.WriteFile("modified", []byte("content")))
+	require.NoError(t, b.WriteFile("modified", []byte("modified")))
+
+	// Entries are compared by their content, not how it is stored.
+	onlyHere, onlyThere, differing, err := a.Diff(b)
+	require.NoError(t, err)
+	require.Empty(t, onlyHere)
+	require.Empty(t, onlyThere)
+	require.Equal(t, []string{"modified"}, differing)
+}
@@ -0,0 +1,51 @@
+package localcache
+
+import (
+	"sort"
+)
+
+// DuplicateReport finds committed entries with identical content, as an
+// estimate of the space that could be reclaimed by deduplication.
+//
+// Each group contains the keys (if known, otherwise hashes) of entries
+// sharing identical content, and wastedBytes is the total size of all but
+// one entry in each group. Only entries of equal size are compared, and
+// their content is streamed through a hasher rather than loaded into memory.
+func (c *Cache) DuplicateReport() (groups [][]string, wastedBytes int64, err error) {
+	type sizeKey struct {
+		size  int64
+		isDir bool
+	}
+	bySize := map[sizeKey][]CacheInfo{}
+	err = c.Range(func(info CacheInfo) bool {
+		key := sizeKey{info.Size, info.IsDir}
+		bySize[key] = append(bySize[key], info)
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for key, candidates := range bySize {
+		if len(candidates) < 2 {
+			continue
+		}
+		byContent := map[string][]string{}
+		for _, info := range candidates {
+			h, err := c.contentHash(info.Path)
+			if err != nil {
+				return nil, 0, err
+			}
+			byContent[h] = append(byContent[h], info.id())
+		}
+		for _, group := range byContent {
+			if len(group) < 2 {
+				continue
+			}
+			sort.Strings(group)
+			groups = append(groups, group)
+			wastedBytes += key.size * int64(len(group)-1)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups, wastedBytes, nil
+}
@@ -0,0 +1,25 @@
+package localcache
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateReport(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		require.NoError(t, cache.WriteFile("a", []byte("duplicate")))
+		require.NoError(t, cache.WriteFile("b", []byte("duplicate")))
+		require.NoError(t, cache.WriteFile("c", []byte("different")))
+		require.NoError(t, cache.WriteFile("d", []byte("unique")))
+
+		groups, wasted, err := cache.DuplicateReport()
+		require.NoError(t, err)
+		expected := []string{cache.Hash("a"), cache.Hash("b")}
+		sort.Strings(expected)
+		require.Equal(t, [][]string{expected}, groups)
+		require.Equal(t, int64(len("duplicate")), wasted)
+	})
+}
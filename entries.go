@@ -0,0 +1,180 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheInfo describes a committed entry in the Cache.
+type CacheInfo struct {
+	// Key is the original key, if known.
+	Key string
+	// Hash of the key.
+	Hash string
+	// Path to the committed entry.
+	Path string
+	// Size in bytes of the entry. For directories this is the total size of all files within it.
+	Size int64
+	// Created is the time the entry was created, as embedded in its name.
+	//
+	// This is zero for entries published with Link.
+	Created time.Time
+	// ModTime is the modification time of the entry's target.
+	ModTime time.Time
+	// IsDir is true if the entry is a directory.
+	IsDir bool
+}
+
+// Range calls fn for each committed entry in the Cache, stopping if fn returns false.
+//
+// In-flight Transactions are not included, nor are entries removed while Range
+// is running. If WithIndex is set, entries are listed from the index.
+func (c *Cache) Range(fn func(info CacheInfo) bool) error {
+	if c.index != nil {
+		infos, err := c.indexed()
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if !fn(info) {
+				return nil
+			}
+		}
+		return nil
+	}
+	links, err := c.committed()
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		info, err := c.info(link)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !fn(info) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Latest returns the committed entry with the newest creation time.
+//
+// Ties are broken by choosing the entry with the greatest Hash. Entries
+// published with Link have no creation time and are never returned. If the
+// Cache has no such entries an error wrapping os.ErrNotExist is returned.
+func (c *Cache) Latest() (CacheInfo, error) {
+	var latest CacheInfo
+	err := c.Range(func(info CacheInfo) bool {
+		if info.Created.IsZero() {
+			return true
+		}
+		if latest.Created.IsZero() || info.Created.After(latest.Created) ||
+			(info.Created.Equal(latest.Created) && info.Hash > latest.Hash) {
+			latest = info
+		}
+		return true
+	})
+	if err != nil {
+		return CacheInfo{}, err
+	}
+	if latest.Created.IsZero() {
+		return CacheInfo{}, fmt.Errorf("no entries: %w", os.ErrNotExist)
+	}
+	return latest, nil
+}
+
+// Oldest returns up to n committed entries with the oldest creation times,
+// oldest first.
+//
+// This is useful for reviewing which entries a Purge would remove. Ties are
+// broken by Hash. Entries published with Link have no creation time and are
+// never returned.
+func (c *Cache) Oldest(n int) ([]CacheInfo, error) {
+	var entries []CacheInfo
+	err := c.Range(func(info CacheInfo) bool {
+		if !info.Created.IsZero() {
+			entries = append(entries, info)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Created.Equal(entries[j].Created) {
+			return entries[i].Hash < entries[j].Hash
+		}
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	if n < 0 {
+		n = 0
+	}
+	if n < len(entries) {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+// EntryTime returns the creation time embedded in the committed entry for key.
+//
+// Entries published with Link have no creation time, and a zero time is
+// returned for them.
+func (c *Cache) EntryTime(key string) (time.Time, error) {
+	target, err := c.fs.Readlink(c.linkPath(key))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !c.owns(target) {
+		return time.Time{}, nil
+	}
+	return c.targetTime(target)
+}
+
+// info returns the CacheInfo for a committed entry's symlink.
+func (c *Cache) info(link string) (CacheInfo, error) {
+	target, err := c.fs.Readlink(link)
+	if err != nil {
+		return CacheInfo{}, fmt.Errorf("failed to read entry: %w", err)
+	}
+	stat, err := c.fs.Stat(link)
+	if err != nil {
+		return CacheInfo{}, fmt.Errorf("failed to stat entry: %w", err)
+	}
+	size, err := c.entrySize(link)
+	if err != nil {
+		return CacheInfo{}, err
+	}
+	info := CacheInfo{
+		Hash:    filepath.Base(link),
+		Path:    link,
+		Size:    size,
+		ModTime: stat.ModTime(),
+		IsDir:   stat.IsDir(),
+	}
+	if c.owns(target) {
+		info.Created, err = c.targetTime(target)
+		if err != nil {
+			return CacheInfo{}, err
+		}
+	}
+	return info, nil
+}
+
+// entryTime returns the timestamp embedded in the name of an entry target.
+func entryTime(path string) (time.Time, error) {
+	hexTimestamp := strings.TrimPrefix(filepath.Ext(path), ".")
+	var ts int64
+	_, err := fmt.Sscanf(hexTimestamp, "%x", &ts)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cache entry %q: %w", path, err)
+	}
+	return time.Unix(0, ts), nil
+}
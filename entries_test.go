@@ -0,0 +1,104 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatest(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+
+	cache := NewForTesting(t, WithClock(testClock))
+	_, err := cache.Latest()
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, key := range []string{"first", "second", "third"} {
+		err := cache.WriteFile(key, []byte(key))
+		require.NoError(t, err)
+		testClock.advance(time.Minute)
+	}
+	latest, err := cache.Latest()
+	require.NoError(t, err)
+	require.Equal(t, cache.Hash("third"), latest.Hash)
+
+	err = cache.WriteFile("first", []byte("rewritten"))
+	require.NoError(t, err)
+	latest, err = cache.Latest()
+	require.NoError(t, err)
+	require.Equal(t, cache.Hash("first"), latest.Hash)
+}
+
+func TestEntryTime(t *testing.T) {
+	testClock := NewManualClock(time.Now())
+
+	cache := NewForTesting(t, WithClock(testClock))
+	created := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+	testClock.Set(created)
+	err := cache.WriteFile("test", []byte("test"))
+	require.NoError(t, err)
+	testClock.Advance(time.Hour)
+
+	entryTime, err := cache.EntryTime("test")
+	require.NoError(t, err)
+	require.True(t, created.Equal(entryTime), "%s != %s", created, entryTime)
+
+	_, err = cache.EntryTime("missing")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestOldest(t *testing.T) {
+	testClock := NewManualClock(time.Now())
+	cache := NewForTesting(t, WithClock(testClock))
+	for _, key := range []string{"oldest", "older", "newer", "newest"} {
+		err := cache.WriteFile(key, []byte(key))
+		require.NoError(t, err)
+		testClock.Advance(time.Minute)
+	}
+	external := filepath.Join(t.TempDir(), "external")
+	err := os.WriteFile(external, []byte("external"), 0600)
+	require.NoError(t, err)
+	_, err = cache.Link("linked", external)
+	require.NoError(t, err)
+
+	oldest, err := cache.Oldest(2)
+	require.NoError(t, err)
+	require.Len(t, oldest, 2)
+	require.Equal(t, cache.Hash("oldest"), oldest[0].Hash)
+	require.Equal(t, cache.Hash("older"), oldest[1].Hash)
+
+	all, err := cache.Oldest(10)
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	require.Equal(t, cache.Hash("newest"), all[3].Hash)
+
+	none, err := cache.Oldest(0)
+	require.NoError(t, err)
+	require.Empty(t, none)
+}
+
+func TestRangeSkipsRemoved(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		keys := []string{"a", "b", "c"}
+		for _, key := range keys {
+			require.NoError(t, cache.WriteFile(key, []byte(key)))
+		}
+		calls := 0
+		err := cache.Range(func(info CacheInfo) bool {
+			calls++
+			// Remove every other entry before Range reaches them.
+			for _, key := range keys {
+				if cache.Hash(key) != info.Hash {
+					_ = cache.Remove(key)
+				}
+			}
+			return true
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, calls)
+	})
+}
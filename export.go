@@ -0,0 +1,140 @@
+package localcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Header identifying version 1 of the ExportEntry format.
+var exportMagic = []byte("localcache-entry\x01")
+
+// Maximum size of an exported entry's header.
+const maxExportHeaderSize = 1 << 20
+
+// exportHeader describes an exported entry.
+type exportHeader struct {
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Created is zero for entries published with Link, and in exports
+	// written by earlier versions.
+	Created time.Time `json:"created"`
+	Meta    EntryMeta `json:"meta"`
+}
+
+// ExportEntry writes the committed file entry for key to w, along with its
+// key, metadata, creation time and checksum, in a self-describing format that
+// can be read by ImportEntry.
+//
+// Content is written as stored, so compressed entries remain compressed, and
+// is streamed rather than loaded into memory. Directory entries can't be
+// exported.
+//
+// The format is the magic "localcache-entry\x01", a big-endian uint32 length,
+// a JSON header of that length, and then the content.
+func (c *Cache) ExportEntry(key string, w io.Writer) error {
+	target, err := c.fs.Readlink(c.linkPath(key))
+	if err != nil {
+		return err
+	}
+	info, err := c.fs.Stat(target)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot export %q: directory entries can't be exported", key)
+	}
+	meta, err := c.entryMeta(target, info)
+	if err != nil {
+		return err
+	}
+	// Targets are never modified once committed, so hashing then copying
+	// the content yields a consistent export.
+	h := sha256.New()
+	if err := c.hashFile(h, target); err != nil {
+		return fmt.Errorf("failed to hash %q: %w", key, err)
+	}
+	header, err := json.Marshal(exportHeader{Key: key, Size: info.Size(), SHA256: fmt.Sprintf("%x", h.Sum(nil)), Created: meta.Created, Meta: meta})
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(append([]byte{}, exportMagic...))
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(header)))
+	buf.Write(header)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to export %q: %w", key, err)
+	}
+	f, err := c.fs.Open(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(w, f, info.Size()); err != nil {
+		return fmt.Errorf("failed to export %q: %w", key, err)
+	}
+	return nil
+}
+
+// ImportEntry reads an entry written by ExportEntry from r and commits it,
+// along with its metadata, returning its key.
+//
+// The entry keeps its exported creation time, so it ages and expires as it
+// would have in the exporting Cache.
+//
+// The content is verified against the exported checksum, and nothing is
+// committed if it does not match or reading r panics. Only the entry is read
+// from r, so several exported entries may be read from the same stream.
+func (c *Cache) ImportEntry(r io.Reader) (key string, err error) {
+	prefix := make([]byte, len(exportMagic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return "", fmt.Errorf("failed to read entry header: %w", err)
+	}
+	if !bytes.Equal(prefix[:len(exportMagic)], exportMagic) {
+		return "", errors.New("not an exported entry")
+	}
+	size := binary.BigEndian.Uint32(prefix[len(exportMagic):])
+	if size > maxExportHeaderSize {
+		return "", fmt.Errorf("entry header too large: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", fmt.Errorf("failed to read entry header: %w", err)
+	}
+	var header exportHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return "", fmt.Errorf("invalid entry header: %w", err)
+	}
+	created := header.Created
+	if created.IsZero() {
+		created = c.clock.Now()
+	}
+	tx, f, err := c.createTxAt(header.Key, created, c.kindOverwrite, nil)
+	if err != nil {
+		return "", err
+	}
+	defer c.RollbackOrCommit(tx, &err)
+	// Closed before rolling back if r panics.
+	defer f.Close() //nolint:errcheck
+	h := sha256.New()
+	_, err = io.CopyN(io.MultiWriter(f, h), r, header.Size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to import %q: %w", header.Key, err)
+	}
+	if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != header.SHA256 {
+		return "", fmt.Errorf("failed to import %q: checksum %s does not match %s", header.Key, sum, header.SHA256)
+	}
+	err = c.updateMeta(c.txPath(tx), func(meta *EntryMeta) { *meta = header.Meta })
+	if err != nil {
+		return "", err
+	}
+	return header.Key, nil
+}
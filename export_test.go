@@ -0,0 +1,99 @@
+package localcache
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportEntry(t *testing.T) {
+	src := NewForTesting(t)
+	tx, f, err := src.CreateWithTTL("a", time.Hour)
+	require.NoError(t, err)
+	_, err = f.WriteString("hello")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = src.Commit(tx)
+	require.NoError(t, err)
+	tx, w, err := src.CreateCompressed("b", Zlib)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	_, err = src.Commit(tx)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, src.ExportEntry("a", buf))
+	require.NoError(t, src.ExportEntry("b", buf))
+
+	dst := NewForTesting(t)
+	for _, want := range []string{"a", "b"} {
+		key, err := dst.ImportEntry(buf)
+		require.NoError(t, err)
+		require.Equal(t, want, key)
+		data, err := dst.ReadFile(key)
+		require.NoError(t, err)
+		expected, err := src.ReadFile(key)
+		require.NoError(t, err)
+		require.Equal(t, expected, data)
+		meta, err := dst.GetMeta(key)
+		require.NoError(t, err)
+		expectedMeta, err := src.GetMeta(key)
+		require.NoError(t, err)
+		require.Equal(t, expectedMeta, meta)
+	}
+	require.Zero(t, buf.Len())
+
+	// Corrupt content is not committed.
+	buf.Reset()
+	require.NoError(t, src.ExportEntry("a", buf))
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+	_, err = dst.ImportEntry(bytes.NewReader(data))
+	require.ErrorContains(t, err, "checksum")
+	pending, err := dst.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	// Nor is partial content if reading panics.
+	partial := bytes.NewReader(data[:len(data)-3])
+	require.Panics(t, func() { _, _ = dst.ImportEntry(io.MultiReader(partial, panicReader{})) })
+	pending, err = dst.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestImportEntryCreated(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	src := NewForTesting(t, WithClock(NewManualClock(created)))
+	require.NoError(t, src.WriteFile("owned", []byte("owned")))
+	external := filepath.Join(t.TempDir(), "external")
+	require.NoError(t, os.WriteFile(external, []byte("external"), 0600))
+	_, err := src.Link("linked", external)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, src.ExportEntry("owned", buf))
+	require.NoError(t, src.ExportEntry("linked", buf))
+
+	now := created.Add(time.Hour)
+	dst := NewForTesting(t, WithClock(NewManualClock(now)))
+	_, err = dst.ImportEntry(buf)
+	require.NoError(t, err)
+	entryTime, err := dst.EntryTime("owned")
+	require.NoError(t, err)
+	require.True(t, created.Equal(entryTime), "%s != %s", created, entryTime)
+
+	// Linked entries have no creation time, so are imported as new.
+	_, err = dst.ImportEntry(buf)
+	require.NoError(t, err)
+	entryTime, err = dst.EntryTime("linked")
+	require.NoError(t, err)
+	require.True(t, now.Equal(entryTime), "%s != %s", now, entryTime)
+}
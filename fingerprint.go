@@ -0,0 +1,35 @@
+package localcache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+// Fingerprint returns a hex SHA-256 hash over the hashed key and content of
+// every committed entry.
+//
+// The fingerprint is independent of the order entries were written in and
+// of their timestamps, compression and on-disk layout, so Caches with
+// identical contents have identical fingerprints. This is useful for
+// detecting whether a Cache changed, eg. between CI runs.
+func (c *Cache) Fingerprint() (string, error) {
+	var infos []CacheInfo
+	err := c.Range(func(info CacheInfo) bool {
+		infos = append(infos, info)
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Hash < infos[j].Hash })
+	h := sha256.New()
+	for _, info := range infos {
+		content, err := c.contentHash(info.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to fingerprint %q: %w", info.id(), err)
+		}
+		fmt.Fprintf(h, "%s %s\n", info.Hash, content)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,47 @@
+package localcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := NewForTesting(t)
+	b := NewForTesting(t, WithClock(&fakeClock{currentTime: time.Now().Add(time.Hour)}))
+	for _, key := range []string{"one", "two", "three"} {
+		require.NoError(t, a.WriteFile(key, []byte(key)))
+	}
+	for _, key := range []string{"three", "one", "two"} {
+		require.NoError(t, b.WriteFile(key, []byte(key)))
+	}
+	fingerprint, err := a.Fingerprint()
+	require.NoError(t, err)
+	other, err := b.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, other)
+
+	require.NoError(t, a.WriteFile("one", []byte("modified")))
+	modified, err := a.Fingerprint()
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, modified)
+
+	require.NoError(t, b.WriteFile("four", []byte("four")))
+	added, err := b.Fingerprint()
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, added)
+	require.NotEqual(t, modified, added)
+}
+
+func TestFingerprintCompressed(t *testing.T) {
+	a := NewForTesting(t)
+	b := NewForTesting(t, WithCompression())
+	require.NoError(t, a.WriteFile("key", []byte("content")))
+	require.NoError(t, b.WriteFile("key", []byte("content")))
+	fingerprint, err := a.Fingerprint()
+	require.NoError(t, err)
+	other, err := b.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, other)
+}
@@ -0,0 +1,19 @@
+package localcache
+
+import (
+	"sync"
+)
+
+// Freeze blocks Commit, Link and RenamePreservingAge until the returned
+// unfreeze function is called, so that a backup of the Cache's directory
+// sees only fully committed entries.
+//
+// Freeze waits for commits already in progress to complete. Transactions
+// may still be created and written to while the Cache is frozen, but are
+// not committed until it is unfrozen. unfreeze may safely be called more
+// than once.
+func (c *Cache) Freeze() (unfreeze func(), err error) {
+	c.frozen.Lock()
+	var once sync.Once
+	return func() { once.Do(c.frozen.Unlock) }, nil
+}
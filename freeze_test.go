@@ -0,0 +1,30 @@
+package localcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeze(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		unfreeze, err := cache.Freeze()
+		require.NoError(t, err)
+
+		committed := make(chan error)
+		go func() { committed <- cache.WriteFile("test", []byte("hello")) }()
+		select {
+		case <-committed:
+			t.Fatal("commit should block while the cache is frozen")
+		case <-time.After(50 * time.Millisecond):
+		}
+		require.Empty(t, cache.IfExists("test"))
+
+		unfreeze()
+		require.NoError(t, <-committed)
+		require.NotEmpty(t, cache.IfExists("test"))
+		unfreeze()
+	})
+}
@@ -0,0 +1,85 @@
+package localcache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotOSFile is returned by methods that return an *os.File when the
+// Cache's FS does not produce them.
+var ErrNotOSFile = errors.New("localcache: FS does not provide *os.File")
+
+// FS is the filesystem a Cache operates over.
+//
+// The default is the local filesystem, as provided by the os package. On
+// Windows it is wrapped with SymlinkFallbackFS.
+type FS interface {
+	Mkdir(name string, perm os.FileMode) error
+	Create(name string) (File, error)
+	Open(name string) (File, error)
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	Glob(pattern string) ([]string, error)
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Lchown(name string, uid, gid int) error
+}
+
+// File is an open file in an FS.
+//
+// *os.File implements File.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// WithFS sets the filesystem the Cache operates over.
+//
+// Note that Create, Open and CreateOrRead return ErrNotOSFile if the FS
+// does not return *os.File from its Create and Open methods.
+func WithFS(fs FS) Option {
+	return func(c *Cache) { c.fs = fs }
+}
+
+// OSFS is an FS backed by the os package.
+type OSFS struct{}
+
+var _ FS = OSFS{}
+
+func (OSFS) Mkdir(name string, perm os.FileMode) error  { return os.Mkdir(name, perm) }
+func (OSFS) Create(name string) (File, error)           { return nilFile(os.Create(name)) }
+func (OSFS) Open(name string) (File, error)             { return nilFile(os.Open(name)) }
+func (OSFS) Symlink(oldname, newname string) error      { return os.Symlink(oldname, newname) }
+func (OSFS) Readlink(name string) (string, error)       { return os.Readlink(name) }
+func (OSFS) Rename(oldpath, newpath string) error       { return os.Rename(oldpath, newpath) }
+func (OSFS) Remove(name string) error                   { return os.Remove(name) }
+func (OSFS) RemoveAll(path string) error                { return os.RemoveAll(path) }
+func (OSFS) Stat(name string) (os.FileInfo, error)      { return os.Stat(name) }
+func (OSFS) Lstat(name string) (os.FileInfo, error)     { return os.Lstat(name) }
+func (OSFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+func (OSFS) Glob(pattern string) ([]string, error)      { return filepath.Glob(pattern) }
+func (OSFS) Chmod(name string, mode os.FileMode) error  { return os.Chmod(name, mode) }
+func (OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+func (OSFS) Lchown(name string, uid, gid int) error { return os.Lchown(name, uid, gid) }
+
+// nilFile avoids returning a non-nil File interface wrapping a nil *os.File.
+func nilFile(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
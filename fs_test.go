@@ -0,0 +1,101 @@
+package localcache
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newMemCache(t *testing.T, options ...Option) (*Cache, *memFS) {
+	t.Helper()
+	fs := newMemFS("/cache")
+	return newCache("/cache", append([]Option{WithFS(fs)}, options...)), fs
+}
+
+// forEachFS runs fn as a subtest against a Cache over each FS implementation,
+// where newCache creates a Cache with the given options.
+//
+// Create, Open and CreateOrRead return ErrNotOSFile under FSs other than
+// OSFS, which tests can check for with isOSFS.
+func forEachFS(t *testing.T, fn func(t *testing.T, newCache func(options ...Option) *Cache)) {
+	t.Helper()
+	t.Run("OSFS", func(t *testing.T) {
+		fn(t, func(options ...Option) *Cache { return NewForTesting(t, options...) })
+	})
+	t.Run("memFS", func(t *testing.T) {
+		fn(t, func(options ...Option) *Cache {
+			cache, _ := newMemCache(t, options...)
+			return cache
+		})
+	})
+}
+
+// isOSFS returns true if cache operates over the OS filesystem.
+func isOSFS(cache *Cache) bool {
+	_, ok := cache.fs.(OSFS)
+	return ok
+}
+
+func TestMemFS(t *testing.T) {
+	cache, fs := newMemCache(t, WithPurgeSafetyWindow(0))
+
+	err := cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	data, err := cache.ReadFile("file")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	require.NotEmpty(t, cache.IfExists("file"))
+
+	// Replace the file with a directory.
+	err = cache.ReplaceDir("file", func(dir string) error {
+		f, err := fs.Create(filepath.Join(dir, "nested"))
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte("world!"))
+		return err
+	})
+	require.NoError(t, err)
+	size, err := cache.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(6), size)
+
+	err = cache.ReplaceDir("file", func(dir string) error { return fmt.Errorf("failed") })
+	require.Error(t, err)
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	_, err = cache.ReadFileLimit("other", 10)
+	require.Error(t, err)
+	err = cache.WriteFile("other", []byte("0123456789"))
+	require.NoError(t, err)
+	_, err = cache.ReadFileLimit("other", 5)
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	err = cache.Remove("file")
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("file"))
+
+	err = cache.PurgeKey("other", time.Hour)
+	require.NoError(t, err)
+	require.NotEmpty(t, cache.IfExists("other"))
+	err = cache.Purge(0)
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("other"))
+
+	_, _, err = cache.Create("file")
+	require.ErrorIs(t, err, ErrNotOSFile)
+	_, err = cache.Open("other")
+	require.Error(t, err)
+
+	// Only empty partition directories remain.
+	for path, node := range fs.nodes {
+		if filepath.Dir(filepath.Dir(path)) == "/cache" {
+			t.Errorf("unexpected entry %s (%s)", path, node.mode)
+		}
+	}
+}
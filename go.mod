@@ -1,8 +1,11 @@
 module github.com/alecthomas/localcache
 
-go 1.17
+go 1.20
 
-require github.com/stretchr/testify v1.9.0
+require (
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/time v0.5.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,75 @@
+package localcache
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// WithGroupBy derives the partition of each entry from group(key) rather
+// than from the key itself, while the full key still determines the entry's
+// name within the partition.
+//
+// Keys that map to the same group are stored in the same partition
+// directory, eg. grouping "user/123/avatar" and "user/123/profile" by their
+// "user/123" prefix. group must be deterministic, and a Cache must always be
+// opened with the same group function or existing entries will not be found.
+//
+// Repartition is not supported for grouped Caches, as the partition of an
+// entry can't be derived from its hash alone.
+func WithGroupBy(group func(key string) string) Option {
+	return func(c *Cache) { c.group = group }
+}
+
+// keyPartition returns the name of the partition directory for key.
+func (c *Cache) keyPartition(key string) string {
+	if c.group != nil {
+		key = c.group(key)
+	}
+	return c.partition(c.keyHash(key))
+}
+
+// linkPath returns the path of the committed entry's symlink for key.
+func (c *Cache) linkPath(key string) string {
+	return filepath.Join(c.root, c.keyPartition(key), c.keyHash(key))
+}
+
+// infoLink returns the path of the symlink for an entry described by info,
+// which may come from another Cache.
+//
+// The key is used when known so that the entry is grouped, falling back to
+// the hash.
+func (c *Cache) infoLink(info CacheInfo) string {
+	if c.group != nil && info.Key != "" {
+		return c.linkPath(info.Key)
+	}
+	return c.entryPath(info.Hash)
+}
+
+// txFor returns the Transaction for an in-flight path.
+//
+// Grouped Transactions include their partition, as it can't be derived from
+// the name.
+func (c *Cache) txFor(path string) Transaction {
+	if c.group != nil {
+		if rel, err := filepath.Rel(c.root, path); err == nil {
+			return Transaction(filepath.ToSlash(rel))
+		}
+	}
+	return Transaction(filepath.Base(path))
+}
+
+// txName returns the name of a Transaction's file or directory, without its
+// partition.
+func txName(tx Transaction) string {
+	name := string(tx)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// txHash returns the hash of the key a Transaction was created for.
+func (c *Cache) txHash(tx Transaction) string {
+	name := strings.TrimPrefix(txName(tx), c.tempPrefix)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
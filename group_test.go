@@ -0,0 +1,60 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupBy(t *testing.T) {
+	cache := NewForTesting(t, WithIndex(), WithGroupBy(func(key string) string {
+		return strings.SplitN(key, "/", 2)[0]
+	}))
+	for _, key := range []string{"user/avatar", "user/profile", "other"} {
+		err := cache.WriteFile(key, []byte(key))
+		require.NoError(t, err)
+	}
+	avatar := cache.IfExists("user/avatar")
+	profile := cache.IfExists("user/profile")
+	require.NotEmpty(t, avatar)
+	require.NotEmpty(t, profile)
+	require.Equal(t, filepath.Dir(avatar), filepath.Dir(profile))
+	require.NotEqual(t, filepath.Base(avatar), filepath.Base(profile))
+	require.Equal(t, cache.Hash("user/avatar"), filepath.Base(avatar))
+	require.Equal(t, cache.partition(cache.Hash("user")), filepath.Base(filepath.Dir(avatar)))
+
+	data, err := cache.ReadFile("user/profile")
+	require.NoError(t, err)
+	require.Equal(t, "user/profile", string(data))
+
+	var paths []string
+	err = cache.Range(func(info CacheInfo) bool {
+		paths = append(paths, info.Path)
+		return true
+	})
+	require.NoError(t, err)
+	require.Contains(t, paths, avatar)
+
+	err = cache.Remove("user/avatar")
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("user/avatar"))
+	_, err = cache.ReadFile("user/avatar")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NotEmpty(t, cache.IfExists("user/profile"))
+
+	tx, f, err := cache.Create("user/draft")
+	require.NoError(t, err)
+	_ = f.Close()
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Equal(t, []Transaction{tx}, pending)
+	draft, err := cache.Commit(tx)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Dir(profile), filepath.Dir(draft))
+
+	err = cache.Repartition()
+	require.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package localcache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithHasher replaces SHA-256 as the function used to hash keys, eg. with a
+// cheaper non-cryptographic hash such as FNV or xxHash.
+//
+// The hash must be lowercase hex and at least two characters long, as its
+// prefix names the entry's partition. Entries are only found by a Cache
+// using the same hasher as the one that committed them, so changing the
+// hasher of an existing cache effectively empties it until the old entries
+// are purged.
+func WithHasher(hasher func(key string) string) Option {
+	return func(c *Cache) { c.hasher = hasher }
+}
+
+// Length of a partition name derived from a hash prefix.
+const partitionLen = 2
+
+// invalidHashPad pads hashes too short to name a partition. It is not a hex
+// digit, so padded hashes never collide with the hash of another key.
+const invalidHashPad = "_"
+
+// keyHash returns the hash of key.
+//
+// If the hasher returns a hash too short to name a partition it is padded,
+// so that looking it up misses rather than panics.
+func (c *Cache) keyHash(key string) string {
+	h := c.hasher(key)
+	if len(h) < partitionLen {
+		h += strings.Repeat(invalidHashPad, partitionLen-len(h))
+	}
+	return h
+}
+
+// checkHash returns an error if the hash of key can't address an entry.
+func (c *Cache) checkHash(key string) error {
+	if h := c.hasher(key); len(h) < partitionLen || !isPartitionName(h) {
+		return fmt.Errorf("invalid hash %q for key %q: must be at least %d lowercase hex characters", h, key, partitionLen)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package localcache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fnvHash(key string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func TestWithHasher(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewWithOptions(dir, WithHasher(fnvHash))
+	require.NoError(t, err)
+	require.Equal(t, fnvHash("key"), cache.Hash("key"))
+
+	require.NoError(t, cache.WriteFile("key", []byte("value")))
+	path := cache.IfExists("key")
+	require.Equal(t, filepath.Join(dir, fnvHash("key")[:2], fnvHash("key")), path)
+	data, err := cache.ReadFile("key")
+	require.NoError(t, err)
+	require.Equal(t, "value", string(data))
+
+	// Caches with a different hasher don't see each other's entries.
+	other, err := NewWithOptions(dir)
+	require.NoError(t, err)
+	require.Empty(t, other.IfExists("key"))
+
+	var hashes []string
+	require.NoError(t, cache.Range(func(info CacheInfo) bool {
+		hashes = append(hashes, info.Hash)
+		return true
+	}))
+	require.Equal(t, []string{fnvHash("key")}, hashes)
+
+	data, err = fs.ReadFile(cache.FS(), fnvHash("key"))
+	require.NoError(t, err)
+	require.Equal(t, "value", string(data))
+
+	require.NoError(t, cache.Remove("key"))
+	require.Empty(t, cache.IfExists("key"))
+}
+
+func TestWithHasherShortHash(t *testing.T) {
+	for _, h := range []string{"", "a", "XY"} {
+		for _, ring := range []bool{false, true} {
+			h := h
+			var options []Option
+			if ring {
+				options = append(options, WithConsistentHashPartitions(4))
+			}
+			cache := NewForTesting(t, options...)
+			// Populate partitions that short hashes might resolve to.
+			for i := 0; i < 16; i++ {
+				require.NoError(t, cache.WriteFile(fmt.Sprint(i), []byte("other")))
+			}
+			cache.hasher = func(string) string { return h }
+			err := cache.WriteFile("key", []byte("value"))
+			require.ErrorContains(t, err, "invalid hash")
+			_, _, err = cache.Mkdir("key")
+			require.ErrorContains(t, err, "invalid hash")
+			_, err = cache.Link("key", t.TempDir())
+			require.ErrorContains(t, err, "invalid hash")
+
+			_, err = cache.Open("key")
+			require.ErrorIs(t, err, os.ErrNotExist)
+			_, err = cache.ReadFile("key")
+			require.ErrorIs(t, err, os.ErrNotExist)
+			require.Empty(t, cache.IfExists("key"))
+			require.Error(t, cache.Remove("key"))
+		}
+	}
+}
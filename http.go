@@ -0,0 +1,105 @@
+package localcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Handler returns a http.Handler serving committed file entries, where the
+// request path with its leading "/" removed is the key.
+//
+// Entries are served with ServeContent.
+func (c *Cache) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = c.ServeContent(w, r, strings.TrimPrefix(r.URL.Path, "/"))
+	})
+}
+
+// ServeContent replies to r with the content of the committed file entry for
+// key, using http.ServeContent to handle Range, If-Modified-Since and
+// If-None-Match requests.
+//
+// The ETag header is derived from the creation time embedded in the entry,
+// or from the size and modification time of entries published with Link.
+// The Content-Type header is set from the entry's metadata if present (see
+// CreateWithContentType), otherwise it is detected from the content.
+//
+// Compressed entries are decompressed before being served, so ranges are of
+// their decompressed content. Missing keys and directory entries produce a
+// 404. Any error is returned
+// after the response has been written, for logging.
+func (c *Cache) ServeContent(w http.ResponseWriter, r *http.Request, key string) error {
+	f, target, err := c.openEntry(key)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return err
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	if info.IsDir() {
+		http.NotFound(w, r)
+		return fmt.Errorf("%s: is a directory", key)
+	}
+	meta, err := c.readMeta(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	if c.owns(target) {
+		created, err := c.targetTime(target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		etag = fmt.Sprintf(`"%x"`, created.UnixNano())
+	}
+	content, err := c.entryContent(f, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	if meta.ContentType != "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	http.ServeContent(w, r, "", info.ModTime(), content)
+	return nil
+}
+
+// entryContent returns the seekable content of an opened entry target,
+// which is f itself unless the entry is compressed, in which case it is
+// decompressed into memory. The caller remains responsible for closing f.
+func (c *Cache) entryContent(f File, target string) (io.ReadSeeker, error) {
+	r, err := c.entryReader(nopFileCloser{f}, target)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := r.(nopFileCloser); ok {
+		return r.File, nil
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// nopFileCloser is a File whose Close is a no-op.
+type nopFileCloser struct{ File }
+
+func (nopFileCloser) Close() error { return nil }
@@ -0,0 +1,71 @@
+package localcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerContentType(t *testing.T) {
+	cache := NewForTesting(t)
+	tx, f, err := cache.CreateWithContentType("data", "application/vnd.test+json")
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"hello":"world"}`)
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	meta, err := cache.GetMeta("data")
+	require.NoError(t, err)
+	require.Equal(t, "application/vnd.test+json", meta.ContentType)
+
+	w := httptest.NewRecorder()
+	cache.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/data", nil))
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "application/vnd.test+json", w.Header().Get("Content-Type"))
+	require.Equal(t, `{"hello":"world"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	cache.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	require.Equal(t, 404, w.Code)
+
+	// Metadata is removed along with the entry.
+	err = cache.Remove("data")
+	require.NoError(t, err)
+	metas, err := filepath.Glob(filepath.Join(cache.root, metaDir, "*"))
+	require.NoError(t, err)
+	require.Empty(t, metas)
+}
+
+func TestServeContentRange(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("data", []byte("0123456789"))
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	err = cache.ServeContent(w, r, "data")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	require.Equal(t, "2345", w.Body.String())
+	require.Equal(t, "bytes 2-5/10", w.Header().Get("Content-Range"))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	err = cache.ServeContent(w, r, "data")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotModified, w.Code)
+
+	w = httptest.NewRecorder()
+	err = cache.ServeContent(w, httptest.NewRequest("GET", "/", nil), "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,49 @@
+package localcache
+
+// WithSkipIdenticalCommit causes Commit to discard a Transaction whose
+// content and metadata are identical to the existing entry for its key,
+// rather than replacing the entry.
+//
+// The existing entry, and so its age, is kept. This avoids churning the
+// filesystem when identical content is recomputed, at the cost of hashing
+// both the new and existing content on each Commit.
+func WithSkipIdenticalCommit() Option {
+	return func(c *Cache) { c.skipIdentical = true }
+}
+
+// identical returns true if the in-flight file or directory at path has the
+// same content and metadata as the committed entry at link.
+func (c *Cache) identical(path, link string) (bool, error) {
+	target, err := c.fs.Readlink(link)
+	if err != nil || !c.owns(target) {
+		return false, nil
+	}
+	existing, err := c.fs.Stat(target)
+	if err != nil {
+		return false, nil
+	}
+	info, err := c.fs.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() != existing.IsDir() || (!info.IsDir() && info.Size() != existing.Size()) {
+		return false, nil
+	}
+	newMeta, err := c.readMeta(path)
+	if err != nil {
+		return false, err
+	}
+	oldMeta, err := c.readMeta(target)
+	if err != nil || newMeta != oldMeta {
+		return false, err
+	}
+	newHash, err := c.contentHash(path)
+	if err != nil {
+		return false, err
+	}
+	oldHash, err := c.contentHash(target)
+	if err != nil {
+		return false, nil
+	}
+	return newHash == oldHash, nil
+}
@@ -0,0 +1,63 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipIdenticalCommit(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+	cache := NewForTesting(t, WithClock(testClock), WithSkipIdenticalCommit())
+	err := cache.WriteFile("test", []byte("hello"))
+	require.NoError(t, err)
+	link := cache.linkPath("test")
+	target, err := cache.fs.Readlink(link)
+	require.NoError(t, err)
+	created, err := cache.EntryTime("test")
+	require.NoError(t, err)
+
+	testClock.advance(time.Hour)
+	err = cache.WriteFile("test", []byte("hello"))
+	require.NoError(t, err)
+	actual, err := cache.fs.Readlink(link)
+	require.NoError(t, err)
+	require.Equal(t, target, actual)
+	age, err := cache.EntryTime("test")
+	require.NoError(t, err)
+	require.Equal(t, created, age)
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	err = cache.WriteFile("test", []byte("world"))
+	require.NoError(t, err)
+	actual, err = cache.fs.Readlink(link)
+	require.NoError(t, err)
+	require.NotEqual(t, target, actual)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "world", string(data))
+}
+
+func TestSkipIdenticalCommitDirBoundaries(t *testing.T) {
+	cache := NewForTesting(t, WithSkipIdenticalCommit())
+	require.NoError(t, cache.ReplaceDir("test", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "a"), []byte("1f b\x002"), 0600)
+	}))
+
+	// File content must not be confused with the names of the files after it.
+	require.NoError(t, cache.ReplaceDir("test", func(dir string) error {
+		if err := os.WriteFile(filepath.Join(dir, "a"), []byte("1"), 0600); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "b"), []byte("2"), 0600)
+	}))
+	path, err := cache.fs.Readlink(cache.linkPath("test"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(path, "b"))
+	require.NoError(t, err)
+}
@@ -0,0 +1,537 @@
+package localcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Name of the index snapshot under the cache root.
+const indexFile = ".index"
+
+// Directory under the cache root containing the index journal.
+const indexJournalDir = ".index.journal"
+
+// Header identifying version 2 of the index format.
+var indexMagic = []byte("localcache-index\x02")
+
+// WithIndex maintains an index of committed entries, so that Count, Size
+// and Range do not need to walk the filesystem.
+//
+// The index records the key of each entry committed through the Cache,
+// which is then reported in CacheInfo.Key and listed by Keys. It is held in
+// memory while the Cache is in use, and persisted as a snapshot along with a
+// journal. Before an entry is committed or removed, its hash and pending key
+// are recorded in the journal, and when the index is next loaded the
+// journaled entries are refreshed from disk on top of the snapshot. The index
+// is therefore kept consistent, including the keys of entries committed
+// through the Cache, even if the process exits without calling Close. Close
+// saves a new snapshot and clears the journal.
+//
+// If the snapshot is missing or corrupt, the index is rebuilt by scanning
+// the Cache and a new snapshot saved. The keys of existing entries are then
+// unknown unless WithKeyIndex is also set.
+//
+// The index only reflects changes made through Caches with WithIndex set,
+// and a loaded index does not see changes made by other Caches, so every
+// Cache sharing the same root should be closed before another uses the
+// index.
+func WithIndex() Option {
+	return func(c *Cache) { c.index = &keyIndex{} }
+}
+
+type indexEntry struct {
+	key     string
+	dir     string
+	created time.Time
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+// keyIndex is the in-memory index of committed entries, keyed by hash.
+type keyIndex struct {
+	lock    sync.Mutex
+	loaded  bool
+	entries map[string]indexEntry
+	// usage is the total size of the entries with keys beginning with each
+	// quota prefix, computed when first needed and kept up to date by put
+	// and remove.
+	usage map[string]int64
+	// reserved is the size of commits in progress for each quota prefix.
+	reserved map[string]int64
+	// Held for reading from journaling a change until it is made, and for
+	// writing while the journal is cleared.
+	journal sync.RWMutex
+}
+
+// withIndex calls fn with the loaded index locked.
+func (c *Cache) withIndex(fn func(idx *keyIndex)) error {
+	idx := c.index
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if !idx.loaded {
+		if err := c.checkOpen(); err != nil {
+			return err
+		}
+		if err := c.loadIndex(); err != nil {
+			return err
+		}
+	}
+	fn(idx)
+	return nil
+}
+
+// loadIndex reads the index snapshot and replays the journal over it, or
+// rebuilds the index if the snapshot is unusable.
+//
+// A rebuilt index is saved as the new snapshot, so it need not be rebuilt
+// again if the process exits without calling Close. The journal is left in
+// place, as changes may be journaled concurrently, and is cleared by Close.
+func (c *Cache) loadIndex() error {
+	idx := c.index
+	path := filepath.Join(c.root, indexFile)
+	entries, err := c.readIndex(path)
+	if err == nil {
+		err = c.replayJournal(entries)
+	}
+	if err != nil {
+		entries, err = c.scanIndex()
+		if err != nil {
+			return fmt.Errorf("failed to rebuild index: %w", err)
+		}
+		// Errors are ignored, as the index is rebuilt again if need be.
+		_ = c.writeAtomic(path, encodeIndex(entries))
+	}
+	idx.reset(entries)
+	idx.loaded = true
+	return nil
+}
+
+// scanIndex builds the index from the committed entries on disk.
+func (c *Cache) scanIndex() (map[string]indexEntry, error) {
+	links, err := c.committed()
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]indexEntry{}
+	for _, link := range links {
+		info, err := c.info(link)
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		if c.keyIndex {
+			if key, err = c.readKey(info.Hash); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		entries[info.Hash] = newIndexEntry(key, link, info)
+	}
+	return entries, nil
+}
+
+// flushIndex saves a snapshot of the index, clears the journal, and unloads
+// the index.
+func (c *Cache) flushIndex() error {
+	if c.index == nil {
+		return nil
+	}
+	idx := c.index
+	// Wait for journaled changes to be made, so that the snapshot includes
+	// them. The journal lock is always taken before the index lock.
+	idx.journal.Lock()
+	defer idx.journal.Unlock()
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if !idx.loaded {
+		return nil
+	}
+	// Refresh journaled entries from disk, in case a change was made but the
+	// index not yet updated.
+	if err := c.replayJournal(idx.entries); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := c.writeAtomic(filepath.Join(c.root, indexFile), encodeIndex(idx.entries)); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := c.fs.RemoveAll(filepath.Join(c.root, indexJournalDir)); err != nil {
+		return fmt.Errorf("failed to clear index journal: %w", err)
+	}
+	idx.loaded = false
+	idx.reset(nil)
+	return nil
+}
+
+// journalEntries records in the index journal that the committed entries at
+// links are about to change, along with their pending keys if any, so that
+// the changes are replayed when the index is next loaded even if the process
+// exits before the index is saved.
+//
+// The returned function must be called once the changes have been made.
+func (c *Cache) journalEntries(links []string) (done func(), err error) {
+	if c.index == nil {
+		return func() {}, nil
+	}
+	c.index.journal.RLock()
+	for _, link := range links {
+		if err := c.journalEntry(link); err != nil {
+			c.index.journal.RUnlock()
+			return nil, err
+		}
+	}
+	return c.index.journal.RUnlock, nil
+}
+
+// journalEntry records a change to the committed entry at link in the index
+// journal. The journal lock must be held for reading.
+func (c *Cache) journalEntry(link string) error {
+	h := filepath.Base(link)
+	dir := filepath.Base(filepath.Dir(link))
+	path := filepath.Join(c.root, indexJournalDir, h)
+	key, ok := c.keyNames.lookup(h)
+	if !ok {
+		// Keep the key journaled by an earlier change that is not yet saved.
+		if jdir, jkey, err := c.readJournal(path); err == nil {
+			if jdir == dir {
+				return nil
+			}
+			key = jkey
+		}
+	}
+	err := c.mkdir(filepath.Dir(path))
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create index journal: %w", err)
+	}
+	if err := c.writeAtomic(path, []byte(dir+"\n"+key)); err != nil {
+		return fmt.Errorf("failed to write index journal: %w", err)
+	}
+	return nil
+}
+
+// readJournal returns the partition directory and key recorded by a journal
+// entry.
+func (c *Cache) readJournal(path string) (dir, key string, err error) {
+	f, err := c.fs.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", "", err
+	}
+	dir, key, ok := strings.Cut(string(data), "\n")
+	if !ok {
+		return "", "", errCorruptIndex
+	}
+	return dir, key, nil
+}
+
+// replayJournal refreshes the entries recorded in the index journal from
+// the state of the Cache on disk.
+//
+// Keys recorded in the journal replace those in entries, and if unknown are
+// recovered from the key index if WithKeyIndex is set.
+func (c *Cache) replayJournal(entries map[string]indexEntry) error {
+	journal, err := c.fs.Glob(filepath.Join(c.root, indexJournalDir, "*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range journal {
+		h := filepath.Base(path)
+		if strings.Contains(h, ".") {
+			continue // an interrupted write
+		}
+		dir, key, err := c.readJournal(path)
+		if err != nil {
+			return err
+		}
+		link := filepath.Join(c.root, dir, h)
+		info, err := c.info(link)
+		if prev := entries[h].dir; errors.Is(err, os.ErrNotExist) && prev != "" && prev != dir {
+			// The entry may not have been moved to its new partition.
+			link = filepath.Join(c.root, prev, h)
+			info, err = c.info(link)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			delete(entries, h)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if key == "" {
+			key = entries[h].key
+		}
+		if key == "" && c.keyIndex {
+			key, _ = c.readKey(h)
+		}
+		entries[h] = newIndexEntry(key, link, info)
+	}
+	return nil
+}
+
+// writeAtomic writes data to path via a temporary file that is renamed into
+// place, so a crash can't leave path partially written.
+func (c *Cache) writeAtomic(path string, data []byte) error {
+	tmp := fmt.Sprintf("%s.%x-%d", path, c.clock.Now().UnixNano(), atomic.AddInt64(&tempSeq, 1))
+	f, err := c.createFile(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = c.fs.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = c.fs.Remove(tmp)
+	}
+	return err
+}
+
+// errIndexUpdate wraps failures to update the index after a change to the
+// Cache has been made.
+var errIndexUpdate = errors.New("failed to update index")
+
+// indexKey records the key that will be committed under its hash, for the
+// index or key index.
+func (c *Cache) indexKey(key string) {
+	if c.index == nil && !c.keyIndex {
+		return
+	}
+	c.keyNames.pend(c.keyHash(key), key)
+}
+
+// indexForget discards the key recorded for a rolled back Transaction.
+func (c *Cache) indexForget(tx Transaction) {
+	if c.index == nil && !c.keyIndex {
+		return
+	}
+	c.keyNames.forget(c.txHash(tx))
+}
+
+// newIndexEntry returns the index entry for the committed entry at link.
+func newIndexEntry(key, link string, info CacheInfo) indexEntry {
+	return indexEntry{key: key, dir: filepath.Base(filepath.Dir(link)), created: info.Created, modTime: info.ModTime, size: info.Size, isDir: info.IsDir}
+}
+
+// reset replaces the entries in the index.
+func (idx *keyIndex) reset(entries map[string]indexEntry) {
+	idx.entries = entries
+	idx.usage = map[string]int64{}
+}
+
+// put sets the index entry for the hash h.
+func (idx *keyIndex) put(h string, entry indexEntry) {
+	idx.remove(h)
+	idx.entries[h] = entry
+	idx.account(entry, entry.size)
+}
+
+// remove deletes the index entry for the hash h.
+func (idx *keyIndex) remove(h string) {
+	if entry, ok := idx.entries[h]; ok {
+		idx.account(entry, -entry.size)
+		delete(idx.entries, h)
+	}
+}
+
+// indexPut updates the index entry for a committed entry's symlink.
+func (c *Cache) indexPut(link string) error {
+	h := filepath.Base(link)
+	key, pending := c.keyNames.forget(h)
+	if c.index == nil {
+		return nil
+	}
+	info, err := c.info(link)
+	uerr := c.updateIndex(func(idx *keyIndex) {
+		if err != nil {
+			idx.remove(h)
+			return
+		}
+		if !pending {
+			key = idx.entries[h].key
+		}
+		idx.put(h, newIndexEntry(key, link, info))
+	})
+	if err != nil && uerr == nil && !errors.Is(err, os.ErrNotExist) {
+		// The entry has been dropped from the index, which is still usable.
+		return fmt.Errorf("%w: %w", errIndexUpdate, err)
+	}
+	return uerr
+}
+
+// indexDelete removes the index and key index entries for a committed
+// entry's symlink.
+func (c *Cache) indexDelete(link string) error {
+	if err := c.deleteKey(link); err != nil {
+		return fmt.Errorf("%w: %w", errIndexUpdate, err)
+	}
+	if c.index == nil {
+		return nil
+	}
+	return c.updateIndex(func(idx *keyIndex) { idx.remove(filepath.Base(link)) })
+}
+
+// updateIndex calls withIndex, wrapping any error in errIndexUpdate.
+func (c *Cache) updateIndex(fn func(idx *keyIndex)) error {
+	if err := c.withIndex(fn); err != nil {
+		return fmt.Errorf("%w: %w", errIndexUpdate, err)
+	}
+	return nil
+}
+
+// indexed returns the CacheInfo for all indexed entries, ordered by hash.
+func (c *Cache) indexed() ([]CacheInfo, error) {
+	var out []CacheInfo
+	err := c.withIndex(func(idx *keyIndex) {
+		out = make([]CacheInfo, 0, len(idx.entries))
+		for h, entry := range idx.entries {
+			out = append(out, CacheInfo{
+				Key:     entry.key,
+				Hash:    h,
+				Path:    filepath.Join(c.root, entry.dir, h),
+				Size:    entry.size,
+				Created: entry.created,
+				ModTime: entry.modTime,
+				IsDir:   entry.isDir,
+			})
+		}
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Hash < out[j].Hash })
+	return out, err
+}
+
+func (c *Cache) readIndex(path string) (map[string]indexEntry, error) {
+	f, err := c.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return decodeIndex(data)
+}
+
+// encodeIndex serialises entries as the index header, a count, the
+// length-prefixed entries, and a trailing CRC-32 of everything before it.
+func encodeIndex(entries map[string]indexEntry) []byte {
+	buf := bytes.NewBuffer(append([]byte(nil), indexMagic...))
+	scratch := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(v uint64) { buf.Write(scratch[:binary.PutUvarint(scratch, v)]) }
+	putVarint := func(v int64) { buf.Write(scratch[:binary.PutVarint(scratch, v)]) }
+	putString := func(s string) {
+		putUvarint(uint64(len(s)))
+		buf.WriteString(s)
+	}
+	putTime := func(t time.Time) {
+		if t.IsZero() {
+			putVarint(0)
+		} else {
+			putVarint(t.UnixNano())
+		}
+	}
+	putUvarint(uint64(len(entries)))
+	for h, entry := range entries {
+		putString(h)
+		putString(entry.key)
+		putString(entry.dir)
+		putTime(entry.created)
+		putTime(entry.modTime)
+		putVarint(entry.size)
+		if entry.isDir {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	}
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum)
+	return buf.Bytes()
+}
+
+var errCorruptIndex = errors.New("corrupt index")
+
+func decodeIndex(data []byte) (map[string]indexEntry, error) {
+	if len(data) < len(indexMagic)+4 || !bytes.Equal(data[:len(indexMagic)], indexMagic) {
+		return nil, errCorruptIndex
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, errCorruptIndex
+	}
+	r := bytes.NewReader(body[len(indexMagic):])
+	getString := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		if n > uint64(r.Len()) {
+			return "", errCorruptIndex
+		}
+		s := make([]byte, n)
+		_, err = io.ReadFull(r, s)
+		return string(s), err
+	}
+	getTime := func() (time.Time, error) {
+		ns, err := binary.ReadVarint(r)
+		if err != nil || ns == 0 {
+			return time.Time{}, err
+		}
+		return time.Unix(0, ns), nil
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errCorruptIndex
+	}
+	entries := map[string]indexEntry{}
+	for i := uint64(0); i < count; i++ {
+		var entry indexEntry
+		h, err := getString()
+		if err == nil {
+			entry.key, err = getString()
+		}
+		if err == nil {
+			entry.dir, err = getString()
+		}
+		if err == nil {
+			entry.created, err = getTime()
+		}
+		if err == nil {
+			entry.modTime, err = getTime()
+		}
+		if err == nil {
+			entry.size, err = binary.ReadVarint(r)
+		}
+		var isDir byte
+		if err == nil {
+			isDir, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, errCorruptIndex
+		}
+		entry.isDir = isDir == 1
+		entries[h] = entry
+	}
+	if r.Len() != 0 {
+		return nil, errCorruptIndex
+	}
+	return entries, nil
+}
@@ -0,0 +1,108 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// walkCountingFS counts the directory listings made through it.
+type walkCountingFS struct {
+	OSFS
+	walks int
+}
+
+func (w *walkCountingFS) Glob(pattern string) ([]string, error) {
+	w.walks++
+	return w.OSFS.Glob(pattern)
+}
+
+func (w *walkCountingFS) ReadDir(name string) ([]os.DirEntry, error) {
+	w.walks++
+	return w.OSFS.ReadDir(name)
+}
+
+func TestIndex(t *testing.T) {
+	fs := &walkCountingFS{}
+	root := t.TempDir()
+	cache := newCache(root, []Option{WithFS(fs), WithIndex()})
+	for _, key := range []string{"one", "two", "three"} {
+		err := cache.WriteFile(key, []byte(key))
+		require.NoError(t, err)
+	}
+	err := cache.Remove("two")
+	require.NoError(t, err)
+
+	fs.walks = 0
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	size, err := cache.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(len("one")+len("three")), size)
+	var keys []string
+	err = cache.Range(func(info CacheInfo) bool {
+		keys = append(keys, info.Key)
+		return true
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"one", "three"}, keys)
+	require.Zero(t, fs.walks)
+
+	// A snapshot of the index is saved on Close and reloaded with its keys.
+	err = cache.Close()
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(root, indexFile))
+	cache = newCache(root, []Option{WithIndex()})
+	infos, err := cache.indexed()
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	for _, info := range infos {
+		require.Equal(t, cache.Hash(info.Key), info.Hash)
+	}
+	err = cache.Close()
+	require.NoError(t, err)
+
+	// A missing index is rebuilt from the filesystem.
+	err = os.Remove(filepath.Join(root, indexFile))
+	require.NoError(t, err)
+	cache = newCache(root, []Option{WithIndex()})
+	count, err = cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	err = cache.Close()
+	require.NoError(t, err)
+
+	// As is a corrupt one.
+	err = os.WriteFile(filepath.Join(root, indexFile), []byte("garbage"), 0600)
+	require.NoError(t, err)
+	cache = newCache(root, []Option{WithIndex()})
+	count, err = cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// Changes made by a Cache that is never closed are replayed from the
+	// journal, along with their keys.
+	err = cache.WriteFile("four", []byte("four"))
+	require.NoError(t, err)
+	err = cache.Remove("one")
+	require.NoError(t, err)
+	cache = newCache(root, []Option{WithIndex()})
+	count, err = cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	keys, err = cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"four"}, keys)
+
+	// Closing saves a snapshot and clears the journal.
+	err = cache.Close()
+	require.NoError(t, err)
+	require.NoDirExists(t, filepath.Join(root, indexJournalDir))
+	cache = newCache(root, []Option{WithIndex()})
+	count, err = cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
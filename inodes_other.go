@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+
+package localcache
+
+import (
+	"errors"
+)
+
+// FreeInodes returns the number of free inodes on the filesystem containing
+// the Cache, as reported by statfs(2).
+//
+// This is not supported on this platform.
+func (c *Cache) FreeInodes() (uint64, error) {
+	return 0, errors.New("localcache: FreeInodes is not supported on this platform")
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package localcache
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FreeInodes returns the number of free inodes on the filesystem containing
+// the Cache, as reported by statfs(2).
+//
+// This reports on the local filesystem regardless of the Cache's FS.
+func (c *Cache) FreeInodes() (uint64, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(c.root, &stat); err != nil {
+		return 0, fmt.Errorf("could not statfs cache root: %w", err)
+	}
+	return uint64(stat.Ffree), nil
+}
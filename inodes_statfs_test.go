@@ -0,0 +1,36 @@
+//go:build linux || darwin || freebsd
+
+package localcache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeToInodes(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+
+	cache := NewForTesting(t, WithClock(testClock))
+	free, err := cache.FreeInodes()
+	require.NoError(t, err)
+	require.NotZero(t, free)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		err := cache.WriteFile(key, []byte(key))
+		require.NoError(t, err)
+	}
+	// Each file entry uses two inodes: its symlink and its target.
+	removed, err := cache.PurgeToInodes(8)
+	require.NoError(t, err)
+	require.Equal(t, 0, removed)
+
+	removed, err = cache.PurgeToInodes(5)
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	require.Empty(t, cache.IfExists("a"))
+	require.Empty(t, cache.IfExists("b"))
+	require.NotEmpty(t, cache.IfExists("c"))
+	require.NotEmpty(t, cache.IfExists("d"))
+}
@@ -0,0 +1,288 @@
+package localcache
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FS returns a read-only view of the Cache's committed entries as an fs.FS,
+// for use with libraries such as html/template and archive/zip.
+//
+// The path of an entry is the hash of its key, which may optionally be
+// prefixed by its partition, eg. "<hash>" or "9f/<hash>". Paths within a
+// directory entry are appended, eg. "<hash>/sub/file.txt". Opening an entry
+// resolves its symlink, and compressed entries are decompressed, with their
+// reported size being their decompressed size.
+//
+// The returned FS also implements fs.ReadDirFS and fs.StatFS. Listing "."
+// returns the partitions, and listing a partition returns its entries.
+// As keys can't be recovered from their hashes, listings expose hashed names
+// only. Entries in a Cache using WithGroupBy can only be opened via their
+// partition.
+func (c *Cache) FS() fs.FS {
+	return cacheFS{c}
+}
+
+type cacheFS struct{ c *Cache }
+
+var (
+	_ fs.ReadDirFS = cacheFS{}
+	_ fs.StatFS    = cacheFS{}
+)
+
+func (f cacheFS) Open(name string) (fs.File, error) {
+	path, info, err := f.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := f.readDir(name, path)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &cacheDir{info: info, entries: entries}, nil
+	}
+	file, err := f.c.fs.Open(path)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	target, err := f.c.fs.Readlink(path)
+	if err != nil {
+		// Files within directory entries are stored as written.
+		return cacheFile{File: file, info: info}, nil //nolint:nilerr
+	}
+	r, err := f.c.entryReader(file, target)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if r, ok := r.(File); ok {
+		return cacheFile{File: r, info: info}, nil
+	}
+	return &cacheReader{ReadCloser: r, info: info}, nil
+}
+
+func (f cacheFS) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := f.resolve("stat", name)
+	return info, err
+}
+
+func (f cacheFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, info, err := f.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := f.readDir(name, path)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// resolve returns the path in the Cache's FS for name, following entry
+// symlinks, along with its info.
+func (f cacheFS) resolve(op, name string) (string, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if err := f.c.checkOpen(); err != nil {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	path, err := f.path(name)
+	if err != nil {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	info, err := f.c.fs.Stat(path)
+	if err == nil {
+		info, err = f.entryInfo(path, info)
+	}
+	if err != nil {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return path, info, nil
+}
+
+// entryInfo returns info for the file at path, reporting the decompressed
+// size of compressed entries.
+func (f cacheFS) entryInfo(path string, info fs.FileInfo) (fs.FileInfo, error) {
+	if info.IsDir() {
+		return info, nil
+	}
+	target, err := f.c.fs.Readlink(path)
+	if err != nil {
+		// Not an entry's symlink.
+		return info, nil //nolint:nilerr
+	}
+	file, err := f.c.fs.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	size, err := f.c.contentSize(file, target, info)
+	if err != nil {
+		return nil, err
+	}
+	if size == info.Size() {
+		return info, nil
+	}
+	return contentInfo{FileInfo: info, size: size}, nil
+}
+
+func (f cacheFS) path(name string) (string, error) {
+	if name == "." {
+		return f.c.root, nil
+	}
+	parts := strings.Split(name, "/")
+	var link string
+	switch {
+	case f.isEntry(parts[0]):
+		link, parts = f.c.entryPath(parts[0]), parts[1:]
+	case !isPartitionName(parts[0]):
+		return "", fs.ErrNotExist
+	case len(parts) == 1:
+		return filepath.Join(f.c.root, parts[0]), nil
+	case isHash(parts[1]):
+		link, parts = filepath.Join(f.c.root, parts[0], parts[1]), parts[2:]
+	default:
+		return "", fs.ErrNotExist
+	}
+	target, err := f.c.fs.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	if len(parts) == 0 {
+		// Stat the link rather than the target, so the entry is named by its hash.
+		return link, nil
+	}
+	return filepath.Join(append([]string{target}, parts...)...), nil
+}
+
+// readDir lists the directory at path, hiding everything but partitions in
+// the root and committed entries in partitions.
+func (f cacheFS) readDir(name, path string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	switch {
+	case name == ".":
+		partitions, err := f.c.partitions()
+		if err != nil {
+			return nil, err
+		}
+		for _, partition := range partitions {
+			info, err := f.c.fs.Stat(partition)
+			if err == nil && info.IsDir() {
+				entries = append(entries, fs.FileInfoToDirEntry(info))
+			}
+		}
+
+	case !strings.Contains(name, "/") && path == filepath.Join(f.c.root, name):
+		dir, err := f.c.fs.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range dir {
+			link := filepath.Join(path, entry.Name())
+			if !isHash(entry.Name()) {
+				continue
+			}
+			if info, err := f.c.fs.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			info, err := f.c.fs.Stat(link)
+			if err == nil {
+				info, err = f.entryInfo(link, info)
+			}
+			if err == nil {
+				entries = append(entries, fs.FileInfoToDirEntry(info))
+			}
+		}
+
+	default:
+		dir, err := f.c.fs.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = dir
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// isEntry returns true if name is the hash of a committed entry.
+//
+// As hashes from WithHasher may be as short as partition names, a name is
+// only treated as a hash if its entry exists.
+func (f cacheFS) isEntry(name string) bool {
+	if !isHash(name) {
+		return false
+	}
+	info, err := f.c.fs.Lstat(f.c.entryPath(name))
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// isHash returns true if name could be a hashed key.
+func isHash(name string) bool {
+	return len(name) >= 2 && isPartitionName(name)
+}
+
+// cacheFile is an entry's file, reporting the info of its symlink.
+type cacheFile struct {
+	File
+	info fs.FileInfo
+}
+
+func (f cacheFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// cacheReader is a compressed entry's decompressed content, reporting the
+// info of its symlink.
+type cacheReader struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (r *cacheReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+
+// contentInfo is the info of a compressed entry, reporting its decompressed
+// size.
+type contentInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i contentInfo) Size() int64 { return i.size }
+
+// cacheDir is a directory listed by cacheFS.
+type cacheDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *cacheDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *cacheDir) Close() error               { return nil }
+
+func (d *cacheDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *cacheDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,44 @@
+package localcache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	tx, dir, err := cache.Mkdir("dir")
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "sub.txt"), []byte("world"), 0600)
+	require.NoError(t, err)
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	fsys := cache.FS()
+	fileHash, dirHash := hash("file"), hash("dir")
+	err = fstest.TestFS(fsys, cache.keyPartition("file")+"/"+fileHash, cache.keyPartition("dir")+"/"+dirHash+"/sub.txt")
+	require.NoError(t, err)
+
+	data, err := fs.ReadFile(fsys, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	data, err = fs.ReadFile(fsys, dirHash+"/sub.txt")
+	require.NoError(t, err)
+	require.Equal(t, "world", string(data))
+	info, err := fs.Stat(fsys, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, fileHash, info.Name())
+	require.Equal(t, int64(5), info.Size())
+
+	_, err = fsys.Open(hash("missing"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Open(".meta")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,200 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Directory under the cache root containing the key index.
+const keysDir = ".keys"
+
+// WithKeyIndex maintains a persistent index mapping the hash of each
+// committed entry to its original key, so that Keys can list them.
+//
+// Each entry's key is recorded in its own small file under the root, which
+// is written atomically before the entry is committed and removed with it.
+// Unlike WithIndex, the key index is therefore never lost by a crash, and is
+// shared by every Cache using the same root. If WithIndex is also set, the
+// key index is used to recover keys when the index is rebuilt. Entries
+// committed before the key index was enabled, or by a Cache without it,
+// have no known key.
+func WithKeyIndex() Option {
+	return func(c *Cache) { c.keyIndex = true }
+}
+
+// keyNames tracks the keys of in-flight Transactions until they are
+// committed, keyed by hash.
+type keyNames struct {
+	lock    sync.Mutex
+	pending map[string]string
+}
+
+func (k *keyNames) pend(h, key string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.pending == nil {
+		k.pending = map[string]string{}
+	}
+	k.pending[h] = key
+}
+
+func (k *keyNames) lookup(h string) (string, bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	key, ok := k.pending[h]
+	return key, ok
+}
+
+func (k *keyNames) forget(h string) (string, bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	key, ok := k.pending[h]
+	delete(k.pending, h)
+	return key, ok
+}
+
+// Keys returns the original keys of all committed entries, in sorted order.
+//
+// WithIndex or WithKeyIndex must be set, as keys are recorded by the index.
+// Entries whose keys are unknown, such as those committed before the index
+// was enabled or by another Cache, are omitted.
+func (c *Cache) Keys() ([]string, error) {
+	var keys []string
+	switch {
+	case c.index != nil:
+		err := c.withIndex(func(idx *keyIndex) {
+			keys = make([]string, 0, len(idx.entries))
+			for _, entry := range idx.entries {
+				if entry.key != "" {
+					keys = append(keys, entry.key)
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+	case c.keyIndex:
+		records, err := c.fs.Glob(filepath.Join(c.root, keysDir, "*"))
+		if err != nil {
+			return nil, fmt.Errorf("could not list key index: %w", err)
+		}
+		for _, record := range records {
+			if strings.Contains(filepath.Base(record), ".") {
+				continue // an interrupted write
+			}
+			key, err := c.readKey(filepath.Base(record))
+			if err != nil {
+				return nil, err
+			}
+			// Skip entries removed without updating the index, eg. by a crash.
+			if _, err := c.fs.Lstat(c.linkPath(key)); err == nil {
+				keys = append(keys, key)
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("localcache: Keys requires WithIndex or WithKeyIndex")
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// RemoveMatching removes every committed entry whose original key matches
+// re, returning the number of entries removed.
+//
+// WithIndex or WithKeyIndex must be set, and entries whose keys are unknown
+// are never removed. Failure to remove an individual entry does not stop the
+// removal, and all such errors are returned.
+func (c *Cache) RemoveMatching(re *regexp.Regexp) (int, error) {
+	keys, err := c.Keys()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var errs []error
+	for _, key := range keys {
+		if !re.MatchString(key) {
+			continue
+		}
+		if err := c.Remove(key); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %q: %w", key, err))
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// recordKey writes the pending key for the entry at link to the key index,
+// before the entry is committed.
+func (c *Cache) recordKey(link string) error {
+	if !c.keyIndex {
+		return nil
+	}
+	h := filepath.Base(link)
+	key, ok := c.keyNames.lookup(h)
+	if !ok {
+		return nil
+	}
+	if existing, err := c.readKey(h); err == nil && existing == key {
+		return nil
+	}
+	dir := filepath.Join(c.root, keysDir)
+	err := c.mkdir(dir)
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create key index: %w", err)
+	}
+	if err := c.writeAtomic(filepath.Join(dir, h), []byte(key)); err != nil {
+		return fmt.Errorf("failed to write key index: %w", err)
+	}
+	return nil
+}
+
+// readKey returns the key recorded in the key index for the hash h.
+func (c *Cache) readKey(h string) (string, error) {
+	f, err := c.fs.Open(filepath.Join(c.root, keysDir, h))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key index: %w", err)
+	}
+	return string(data), nil
+}
+
+// keyOf returns the original key of the committed entry with the hash h, or
+// an empty string if it is not known.
+func (c *Cache) keyOf(h string) string {
+	var key string
+	if c.index != nil {
+		_ = c.withIndex(func(idx *keyIndex) { key = idx.entries[h].key })
+	}
+	if key == "" && c.keyIndex {
+		key, _ = c.readKey(h)
+	}
+	return key
+}
+
+// deleteKey removes the key index record for the entry at link.
+func (c *Cache) deleteKey(link string) error {
+	if !c.keyIndex {
+		return nil
+	}
+	err := c.fs.Remove(filepath.Join(c.root, keysDir, filepath.Base(link)))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to update key index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package localcache
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+	cache := NewForTesting(t, WithClock(testClock), WithIndex())
+	for _, key := range []string{"old", "b", "a"} {
+		require.NoError(t, cache.WriteFile(key, []byte(key)))
+	}
+	tx, _, err := cache.Create("rolled-back")
+	require.NoError(t, err)
+	require.NoError(t, cache.Rollback(tx))
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "old"}, keys)
+
+	require.NoError(t, cache.Remove("b"))
+	require.NoError(t, cache.PurgeKey("old", 0))
+	keys, err = cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keys)
+
+	// Keys are saved with the index when the Cache is closed.
+	require.NoError(t, cache.Close())
+	other, err := NewWithOptions(cache.root, WithIndex())
+	require.NoError(t, err)
+	keys, err = other.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keys)
+	require.NoError(t, other.Close())
+
+	_, err = NewForTesting(t).Keys()
+	require.Error(t, err)
+}
+
+func TestKeyIndex(t *testing.T) {
+	cache := NewForTesting(t, WithKeyIndex())
+	for _, key := range []string{"c", "b", "a"} {
+		require.NoError(t, cache.WriteFile(key, []byte(key)))
+	}
+	tx, _, err := cache.Create("rolled-back")
+	require.NoError(t, err)
+	require.NoError(t, cache.Rollback(tx))
+	require.NoError(t, cache.Remove("b"))
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, keys)
+
+	// The key index is persistent and shared, so another Cache sees the
+	// keys without the first being closed.
+	other := newCache(cache.root, []Option{WithKeyIndex()})
+	require.NoError(t, other.WriteFile("d", []byte("d")))
+	keys, err = cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c", "d"}, keys)
+
+	// An index rebuilt after a crash recovers keys from the key index.
+	indexed := newCache(cache.root, []Option{WithIndex(), WithKeyIndex()})
+	keys, err = indexed.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c", "d"}, keys)
+	removed, err := indexed.RemoveMatching(regexp.MustCompile(`^[ad]$`))
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	keys, err = cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, keys)
+}
+
+func TestRemoveMatching(t *testing.T) {
+	cache := NewForTesting(t, WithIndex())
+	for _, key := range []string{"user/1/avatar", "user/2/avatar", "user/1/profile", "team/1/avatar"} {
+		require.NoError(t, cache.WriteFile(key, []byte(key)))
+	}
+	tx, _, err := cache.Create("user/3/avatar")
+	require.NoError(t, err)
+
+	removed, err := cache.RemoveMatching(regexp.MustCompile(`^user/\d+/avatar$`))
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"team/1/avatar", "user/1/profile"}, keys)
+
+	// In-flight Transactions are unaffected.
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	require.NotEmpty(t, cache.IfExists("user/3/avatar"))
+}
+
+func TestIndexUpdateErrors(t *testing.T) {
+	cache := NewForTesting(t, WithIndex())
+	require.NoError(t, cache.WriteFile("a", []byte("a")))
+	// Loading the index fails once the Cache is closed.
+	cache.index.lock.Lock()
+	cache.index.loaded = false
+	cache.index.lock.Unlock()
+	require.NoError(t, cache.Close())
+	err := cache.indexDelete(cache.linkPath("a"))
+	require.ErrorIs(t, err, errIndexUpdate)
+	require.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,104 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// WithKindOverwrite allows Create and Mkdir to replace a committed entry of
+// the other kind, ie. a directory with a file or a file with a directory,
+// rather than returning ErrKindMismatch.
+func WithKindOverwrite() Option {
+	return func(c *Cache) { c.kindOverwrite = true }
+}
+
+// checkKind returns an error wrapping ErrKindMismatch if key has a committed
+// entry that is not of the kind being created.
+//
+// In-flight Transactions are not considered, so concurrently created entries
+// of different kinds are only detected once one of them is committed.
+func (c *Cache) checkKind(key string, dir bool) error {
+	info, err := c.fs.Stat(c.linkPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check existing entry: %w", err)
+	}
+	if info.IsDir() == dir {
+		return nil
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: cannot create file for %q, which is a directory", ErrKindMismatch, key)
+	}
+	return fmt.Errorf("%w: cannot create directory for %q, which is a file", ErrKindMismatch, key)
+}
+
+// IsDir returns true if the committed entry for key is a directory.
+//
+// An error wrapping ErrNotFound is returned if key has no entry.
+func (c *Cache) IsDir(key string) (bool, error) {
+	info, err := c.Stat(key)
+	if errors.Is(err, os.ErrNotExist) {
+		// Only a missing link means a missing key, not a missing target.
+		if _, lerr := c.fs.Lstat(c.linkPath(key)); os.IsNotExist(lerr) {
+			return false, notFound("stat", key)
+		}
+		return false, err
+	} else if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// OpenFile opens the committed file entry for key, as with Open.
+//
+// Unlike Open, an error wrapping ErrKindMismatch is returned if key is a
+// directory entry, so the result can always be read as a file.
+func (c *Cache) OpenFile(key string) (*os.File, error) {
+	f, err := c.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: cannot open %q as a file, as it is a directory", ErrKindMismatch, key)
+	}
+	return f, nil
+}
+
+// OpenDir opens the committed directory entry for key for listing.
+//
+// An error wrapping ErrKindMismatch is returned if key is a file entry. If
+// the Cache's FS does not return directories that can be listed, the
+// listing is read when OpenDir is called.
+func (c *Cache) OpenDir(key string) (fs.ReadDirFile, error) {
+	f, target, err := c.openEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if !info.IsDir() {
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: cannot open %q as a directory, as it is a file", ErrKindMismatch, key)
+	}
+	if dir, ok := f.(fs.ReadDirFile); ok {
+		return dir, nil
+	}
+	_ = f.Close()
+	entries, err := c.fs.ReadDir(target)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheDir{info: info, entries: entries}, nil
+}
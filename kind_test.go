@@ -0,0 +1,91 @@
+package localcache
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindMismatch(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("file", []byte("file"))
+	require.NoError(t, err)
+	_, _, err = cache.Mkdir("file")
+	require.ErrorIs(t, err, ErrKindMismatch)
+	require.EqualError(t, err, `localcache: entry kind mismatch: cannot create directory for "file", which is a file`)
+
+	tx, _, err := cache.Mkdir("dir")
+	require.NoError(t, err)
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	_, _, err = cache.Create("dir")
+	require.ErrorIs(t, err, ErrKindMismatch)
+	err = cache.WriteFile("dir", []byte("dir"))
+	require.ErrorIs(t, err, ErrKindMismatch)
+
+	cache = NewForTesting(t, WithKindOverwrite())
+	err = cache.WriteFile("file", []byte("file"))
+	require.NoError(t, err)
+	tx, _, err = cache.Mkdir("file")
+	require.NoError(t, err)
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	info, err := cache.Stat("file")
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+}
+
+func TestOpenKind(t *testing.T) {
+	for _, memory := range []bool{false, true} {
+		cache := NewForTesting(t)
+		if memory {
+			cache, _ = newMemCache(t)
+		}
+		require.NoError(t, cache.WriteFile("file", []byte("file")))
+		_, err := cache.WithDir("dir", func(dir string) error {
+			f, err := cache.fs.Create(filepath.Join(dir, "a.txt"))
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		})
+		require.NoError(t, err)
+
+		isDir, err := cache.IsDir("dir")
+		require.NoError(t, err)
+		require.True(t, isDir)
+		isDir, err = cache.IsDir("file")
+		require.NoError(t, err)
+		require.False(t, isDir)
+		_, err = cache.IsDir("missing")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		dir, err := cache.OpenDir("dir")
+		require.NoError(t, err)
+		entries, err := dir.ReadDir(-1)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "a.txt", entries[0].Name())
+		require.NoError(t, dir.Close())
+		_, err = cache.OpenDir("file")
+		require.ErrorIs(t, err, ErrKindMismatch)
+		_, err = cache.OpenDir("missing")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		if memory {
+			continue
+		}
+		f, err := cache.OpenFile("file")
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "file", string(data))
+		require.NoError(t, f.Close())
+		_, err = cache.OpenFile("dir")
+		require.ErrorIs(t, err, ErrKindMismatch)
+		_, err = cache.OpenFile("missing")
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+}
@@ -0,0 +1,65 @@
+package localcache
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type jsonEntry struct {
+	Key     string    `json:"key,omitempty"`
+	Hash    string    `json:"hash"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	ModTime time.Time `json:"mod_time"`
+	Kind    string    `json:"kind"`
+}
+
+// ListJSON writes a JSON array describing every committed entry to w.
+//
+// Each element has the fields "key" (if known), "hash", "path", "size",
+// "created", "mod_time" and "kind" ("file" or "dir"). Entries are written
+// as they are enumerated rather than being accumulated in memory.
+func (c *Cache) ListJSON(w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	var werr error
+	first := true
+	err := c.Range(func(info CacheInfo) bool {
+		entry := jsonEntry{
+			Key:     info.Key,
+			Hash:    info.Hash,
+			Path:    info.Path,
+			Size:    info.Size,
+			Created: info.Created,
+			ModTime: info.ModTime,
+			Kind:    "file",
+		}
+		if info.IsDir {
+			entry.Kind = "dir"
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			werr = err
+			return false
+		}
+		if !first {
+			data = append([]byte(","), data...)
+		}
+		first = false
+		if _, werr = w.Write(data); werr != nil {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
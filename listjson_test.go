@@ -0,0 +1,40 @@
+package localcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListJSON(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	err = cache.ReplaceDir("dir", func(dir string) error { return nil })
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	err = cache.ListJSON(buf)
+	require.NoError(t, err)
+	var entries []map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &entries)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	kinds := map[string]string{}
+	for _, entry := range entries {
+		kinds[entry["hash"].(string)] = entry["kind"].(string)
+		if entry["hash"] == cache.Hash("file") {
+			require.Equal(t, float64(5), entry["size"])
+			require.Equal(t, cache.IfExists("file"), entry["path"])
+		}
+	}
+	require.Equal(t, map[string]string{cache.Hash("file"): "file", cache.Hash("dir"): "dir"}, kinds)
+
+	buf.Reset()
+	err = NewForTesting(t).ListJSON(buf)
+	require.NoError(t, err)
+	require.Equal(t, "[]\n", buf.String())
+}
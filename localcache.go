@@ -1,98 +1,678 @@
 package localcache
 
 import (
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
+// ErrTooLarge is returned by ReadFileLimit when an entry exceeds the requested limit.
+var ErrTooLarge = errors.New("localcache: entry too large")
+
+// ErrNotFound is returned when a key has no committed entry, eg. by Open
+// and ReadFile.
+//
+// Errors for missing keys also match os.ErrNotExist with errors.Is, but
+// other errors matching os.ErrNotExist, eg. for an entry's missing external
+// target, do not match ErrNotFound.
+var ErrNotFound = errors.New("localcache: key not found")
+
+// notFoundError is returned by op when key has no entry.
+type notFoundError struct {
+	op  string
+	key string
+}
+
+func notFound(op, key string) error { return &notFoundError{op: op, key: key} }
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("localcache: %s %q: key not found", e.op, e.key)
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound || target == os.ErrNotExist
+}
+
+// ErrKindMismatch is returned when creating a file for a key with a committed
+// directory entry, or a directory for a key with a committed file entry. It
+// is also returned by OpenFile and OpenDir when opening an entry of the
+// other kind.
+var ErrKindMismatch = errors.New("localcache: entry kind mismatch")
+
+// ErrChecksumMismatch is returned by ReadFileVerified when an entry's content
+// does not match its expected checksum.
+var ErrChecksumMismatch = errors.New("localcache: checksum mismatch")
+
+// ErrClosed is returned by operations on a Cache after Close has been called.
+var ErrClosed = errors.New("localcache: cache is closed")
+
 // Transaction key for an uncommitted cache entry.
 type Transaction string
 
-var clock clocker = realClock{}
-
 // Valid returns true if the Transaction is valid.
 func (t Transaction) Valid() bool { return t != "" }
 
-func (t Transaction) path(root string) string {
-	if !t.Valid() {
-		panic("transaction is not valid")
+// Cache type.
+type Cache struct {
+	root   string
+	fs     FS
+	ring   *hashRing
+	skew   time.Duration
+	stats  *counters
+	writes *writeLimiter
+	rate   *rate.Limiter
+	refs   *refCounter
+
+	autoRecover    bool
+	reservationTTL time.Duration
+	safetyWindow   time.Duration
+	onEvict        func(info CacheInfo) error
+	tempPrefix     string
+	softDelete     time.Duration
+	secondary      *Cache
+	onSecondaryErr func(err error) error
+	fallback       *Cache
+	index          *keyIndex
+	keyIndex       bool
+	owner          *owner
+	compress       bool
+	maxDirDepth    int
+	group          func(key string) string
+	clock          Clock
+	dirMode        os.FileMode
+	fileMode       os.FileMode
+	defaultTTL     time.Duration
+	skipIdentical  bool
+	purgeBatch     int
+	enforceExpiry  bool
+	kindOverwrite  bool
+	observer       func(event Event)
+	janitor        time.Duration
+	hasher         func(key string) string
+	options        []Option
+
+	formatTarget    func(hash string, created time.Time) string
+	parseTargetName ParseFunc
+
+	frozen      sync.RWMutex
+	quotaLock   sync.Mutex
+	quotas      map[string]int64
+	keyNames    keyNames
+	flights     flightGroup
+	purgeCursor purgeCursor
+	keyLocks    keyMutex
+	namespaces  namespaces
+	done        chan struct{}
+	closeOnce   sync.Once
+	background  sync.WaitGroup
+}
+
+// Option configures a Cache.
+type Option func(*Cache)
+
+func newCache(root string, options []Option) *Cache {
+	c := &Cache{
+		root:         root,
+		fs:           defaultFS(),
+		stats:        newCounters(),
+		clock:        realClock{},
+		hasher:       hash,
+		refs:         processRefs,
+		safetyWindow: DefaultPurgeSafetyWindow,
+		done:         make(chan struct{}),
+	}
+	for _, option := range options {
+		option(c)
 	}
-	return filepath.Join(root, string(t)[:2], string(t))
+	c.options = options
+	if c.softDelete > 0 {
+		c.background.Add(1)
+		go func() {
+			defer c.background.Done()
+			c.sweepTrashPeriodically()
+		}()
+	}
+	if c.janitor > 0 {
+		c.background.Add(1)
+		go func() {
+			defer c.background.Done()
+			c.purgeExpiredPeriodically()
+		}()
+	}
+	return c
 }
 
-// Cache type.
-type Cache struct{ root string }
+// Close stops any background work started by the Cache and saves a snapshot
+// of the index, if enabled.
+//
+// Close waits for in-progress commits, any Freeze and any running trash sweep
+// to finish, so the Cache is left consistent on disk. Subsequent writes and commits
+// return ErrClosed, though in-flight Transactions may still be rolled back.
+// Namespaces of the Cache are also closed.
+//
+// It is safe to call Close more than once; only the first call does any work.
+func (c *Cache) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		errs := c.closeNamespaces()
+		c.frozen.Lock()
+		close(c.done)
+		c.frozen.Unlock()
+		c.background.Wait()
+		err = errors.Join(append(errs, c.flushIndex())...)
+	})
+	return err
+}
+
+// checkOpen returns ErrClosed if the Cache has been closed.
+func (c *Cache) checkOpen() error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
 
 // NewForTesting creates a new Cache for testing.
 //
 // The Cache will be removed on test completion.
-func NewForTesting(t testing.TB) *Cache {
+func NewForTesting(t testing.TB, options ...Option) *Cache {
 	root, err := os.MkdirTemp("", "")
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Cleanup(func() { _ = os.RemoveAll(root) })
-	return &Cache{root}
+	c := newCache(root, options)
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = os.RemoveAll(root)
+	})
+	return c
 }
 
 // New creates a new cache "name" under the user's cache directory.
-func New(name string) (*Cache, error) {
+func New(name string, options ...Option) (*Cache, error) {
 	cacheDir, err := os.UserCacheDir()
 	if err != nil {
 		return nil, fmt.Errorf("couldn't locate cache dir: %w", err)
 	}
-	root := filepath.Join(cacheDir, name)
-	err = os.Mkdir(root, 0700)
+	return NewWithOptions(filepath.Join(cacheDir, name), options...)
+}
+
+// NewWithOptions creates a new cache rooted at the directory root, creating
+// it if necessary.
+func NewWithOptions(root string, options ...Option) (*Cache, error) {
+	c := newCache(root, options)
+	err := c.mkdir(c.root)
 	if err != nil && !os.IsExist(err) {
 		return nil, fmt.Errorf("couldn't create cache dir: %w", err)
 	}
-	return &Cache{root}, nil
+	if c.autoRecover {
+		if err := c.RecoverCommits(); err != nil {
+			return nil, fmt.Errorf("couldn't recover commits: %w", err)
+		}
+	}
+	return c, nil
 }
 
 // Commit atomically commits an in-flight file or directory creation Transaction to the Cache.
+//
+// Commit and Remove hold an advisory lock on the entry's partition while
+// replacing it, so processes on the same host sharing the Cache can't remove
+// each other's entries. This does not protect against processes on other
+// hosts, eg. over a network filesystem.
 func (c *Cache) Commit(tx Transaction) (string, error) {
-	if !tx.Valid() {
-		return "", fmt.Errorf("transaction is not valid")
+	return c.CommitContext(context.Background(), tx)
+}
+
+// CommitContext is like Commit, but gives up waiting for the
+// WithWriteRateLimit limiter when ctx is done.
+//
+// The Transaction remains in-flight if the wait fails and should be rolled back.
+func (c *Cache) CommitContext(ctx context.Context, tx Transaction) (string, error) {
+	path, _, err := c.commit(ctx, tx)
+	return path, err
+}
+
+// commit commits tx, returning done as true if the Transaction has ended,
+// even if an error is also returned, eg. by WithWriteThrough.
+//
+// A Transaction that fails to commit remains in-flight until it is rolled
+// back, so it keeps its WithMaxConcurrentWrites slot until then.
+func (c *Cache) commit(ctx context.Context, tx Transaction) (_ string, done bool, err error) {
+	dests, done, err := c.commitAll(ctx, []Transaction{tx}, nil)
+	if len(dests) == 0 {
+		return "", done, err
+	}
+	return dests[0], done, err
+}
+
+// pendingCommit is a Transaction being committed by commitAll.
+type pendingCommit struct {
+	tx     Transaction
+	h      string
+	path   string
+	dest   string
+	target string
+	size   int64
+	// identical is true if the Transaction is to be discarded, as it is
+	// identical to the existing entry.
+	identical bool
+}
+
+// commitAll is like commit, but commits several Transactions together, such
+// that either every entry is committed or none are. If any Transaction fails
+// to commit, they all remain in-flight until rolled back.
+//
+// Each symlink in links is also pointed at its target as part of the
+// commit, or removed if its target is empty. These must not be the
+// symlinks of any of txs.
+func (c *Cache) commitAll(ctx context.Context, txs []Transaction, links map[string]string) (_ []string, done bool, err error) {
+	for _, tx := range txs {
+		if !tx.Valid() {
+			return nil, false, fmt.Errorf("transaction is not valid")
+		}
+	}
+	defer func() {
+		if done {
+			for _, tx := range txs {
+				c.writes.release(tx)
+			}
+		}
+	}()
+	start := time.Now()
+	c.frozen.RLock()
+	defer c.frozen.RUnlock()
+	if err := c.checkOpen(); err != nil {
+		return nil, false, err
 	}
-	path := tx.path(c.root)
+	pending := make([]pendingCommit, 0, len(txs))
+	for _, tx := range txs {
+		p, err := c.prepareCommit(tx)
+		if err != nil {
+			return nil, false, err
+		}
+		pending = append(pending, p)
+	}
+	for _, p := range pending {
+		if p.identical {
+			continue
+		}
+		if err := c.chownEntry(p.path, 0); err != nil {
+			return nil, false, err
+		}
+		if c.rate != nil {
+			if err := c.rate.Wait(ctx); err != nil {
+				return nil, false, fmt.Errorf("write rate limit: %w", err)
+			}
+		}
+		release, err := c.checkQuota(p.path, p.h)
+		if err != nil {
+			return nil, false, err
+		}
+		defer release()
+	}
+
+	// Strip the temporary prefix, if any, from the committed targets, and
+	// apply the target format.
+	targets := map[string]string{}
+	for i, p := range pending {
+		if p.identical {
+			continue
+		}
+		if err := c.finaliseTarget(p.path, p.target); err != nil {
+			c.unfinaliseTargets(pending[:i])
+			return nil, false, err
+		}
+		targets[p.dest] = p.target
+	}
+
+	for dest, target := range links {
+		targets[dest] = target
+	}
+
+	// The entries are committed even if the index could not be updated.
+	if len(targets) == 1 && len(links) == 0 {
+		for dest, target := range targets {
+			err = c.swapLink(dest, target)
+		}
+	} else if len(targets) > 0 {
+		err = c.swapLinks(targets)
+	}
+	if err != nil && !errors.Is(err, errIndexUpdate) {
+		c.unfinaliseTargets(pending)
+		return nil, false, err
+	}
+	dests := make([]string, 0, len(pending))
+	for _, p := range pending {
+		dests = append(dests, p.dest)
+		if p.identical {
+			c.indexForget(p.tx)
+			if rerr := c.removeTarget(p.path); err == nil {
+				err = rerr
+			}
+			continue
+		}
+		atomic.AddInt64(&c.stats.writes, 1)
+		c.observe(OpCommit, p.h, p.size, start)
+		if werr := c.writeToSecondary(p.dest); err == nil {
+			err = werr
+		}
+	}
+	return dests, true, err
+}
+
+// prepareCommit checks that tx can be committed, without changing it.
+func (c *Cache) prepareCommit(tx Transaction) (pendingCommit, error) {
+	path := c.txPath(tx)
 	if !strings.HasPrefix(path, c.root) {
-		return "", fmt.Errorf("cannot finalise path outside cache root")
+		return pendingCommit{}, fmt.Errorf("cannot finalise path outside cache root")
+	}
+	h, created, err := parseDefaultTarget(strings.TrimPrefix(txName(tx), c.tempPrefix))
+	if err != nil {
+		return pendingCommit{}, err
+	}
+	dest := filepath.Join(filepath.Dir(path), h)
+	target := filepath.Join(filepath.Dir(dest), c.targetName(h, created))
+	if err := checkPathLength(target); err != nil {
+		return pendingCommit{}, err
 	}
-	dest := strings.TrimSuffix(path, filepath.Ext(path))
 
 	// Check if the file we're committing actually exists.
-	_, err := os.Stat(path)
+	info, err := c.fs.Stat(path)
 	if err != nil {
-		return "", err
+		return pendingCommit{}, err
+	}
+	p := pendingCommit{tx: tx, h: h, path: path, dest: dest, target: target}
+	if !info.IsDir() {
+		p.size = info.Size()
+	}
+	if c.skipIdentical {
+		p.identical, err = c.identical(path, dest)
+		if err != nil {
+			return pendingCommit{}, err
+		}
 	}
+	return p, nil
+}
+
+// finaliseTarget renames the in-flight Transaction at path, and its
+// metadata, to the committed target.
+func (c *Cache) finaliseTarget(path, target string) error {
+	if path == target {
+		return nil
+	}
+	if err := c.fs.Rename(path, target); err != nil {
+		return fmt.Errorf("failed to finalise transaction: %w", err)
+	}
+	if c.metaPath(path) != c.metaPath(target) {
+		err := c.fs.Rename(c.metaPath(path), c.metaPath(target))
+		if err != nil && !os.IsNotExist(err) {
+			_ = c.fs.Rename(target, path)
+			return fmt.Errorf("failed to finalise metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// unfinaliseTargets renames the committed targets of pending back to their
+// Transactions, after a failed commit, so that they can be rolled back.
+func (c *Cache) unfinaliseTargets(pending []pendingCommit) {
+	for _, p := range pending {
+		if p.identical || p.path == p.target {
+			continue
+		}
+		if c.metaPath(p.path) != c.metaPath(p.target) {
+			_ = c.fs.Rename(c.metaPath(p.target), c.metaPath(p.path))
+		}
+		_ = c.fs.Rename(p.target, p.path)
+	}
+}
+
+// swapLink atomically points the symlink dest at target, removing the
+// previous target if it is owned by the Cache.
+func (c *Cache) swapLink(dest, target string) error {
+	_, err := c.swapLinkIf(dest, target, nil)
+	return err
+}
+
+// swapLinkFrom is like swapLink, but only swaps the symlink if it still
+// points to old, or if old is empty, if it does not exist. It returns true if
+// the symlink was swapped.
+func (c *Cache) swapLinkFrom(dest, old, target string) (bool, error) {
+	return c.swapLinkIf(dest, target, func(current string) bool { return current == old })
+}
+
+// swapLinkIf is like swapLink, but if cond is not nil only swaps the symlink
+// if cond returns true for its current target, which is empty if it does not
+// exist. It returns true if the symlink was swapped.
+func (c *Cache) swapLinkIf(dest, target string, cond func(current string) bool) (bool, error) {
+	unlock, err := c.lockEntry(dest)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
 
 	// First, store the old link if any, so we can remove its target.
-	oldDest, err := os.Readlink(dest)
+	oldDest, err := c.fs.Readlink(dest)
 	if err != nil && !os.IsNotExist(err) {
-		return "", fmt.Errorf("failed to read link: %w", err)
+		return false, fmt.Errorf("failed to read link: %w", err)
+	}
+	if cond != nil && !cond(oldDest) {
+		return false, nil
+	}
+
+	// Record our intent, so an interrupted commit can be recovered.
+	tmpSymlink := c.tempName(dest)
+	intent := commitIntent{Symlink: tmpSymlink, Dest: dest, Target: target, Old: oldDest}
+	marker, err := c.writeIntent(intent)
+	if err != nil {
+		return false, err
 	}
 
 	// Next create a temporary symlink pointing to the new destination.
-	tmpSymlink := fmt.Sprintf("%s.%x", dest, clock.Now().UnixNano())
-	err = os.Symlink(path, tmpSymlink)
+	err = c.fs.Symlink(target, tmpSymlink)
 	if err != nil {
-		return "", fmt.Errorf("failed to finalise symlink: %w", err)
+		_ = c.fs.Remove(marker)
+		return false, fmt.Errorf("failed to finalise symlink: %w", err)
 	}
 
 	// Then atomically rename the new symlink to the final destination symlink.
-	err = os.Rename(tmpSymlink, dest)
+	err = c.fs.Rename(tmpSymlink, dest)
 	if err != nil {
-		return "", fmt.Errorf("failed to finalise rename: %w", err)
+		_ = c.fs.Remove(tmpSymlink)
+		_ = c.fs.Remove(marker)
+		return false, fmt.Errorf("failed to finalise rename: %w", err)
+	}
+	c.removeOldTarget(intent)
+	_ = c.fs.Remove(marker)
+	return true, c.indexPut(dest)
+}
+
+// swapLinks atomically points each symlink in targets at its target, as with
+// swapLink, or removes it if its target is empty, such that either every
+// symlink is swapped or none are.
+//
+// Every temporary symlink is created before the intent is recorded, so a
+// commit interrupted by a crash is completed in full by RecoverCommits.
+func (c *Cache) swapLinks(targets map[string]string) error {
+	links := make([]string, 0, len(targets))
+	for dest := range targets {
+		links = append(links, dest)
 	}
-	if oldDest != "" {
-		_ = os.RemoveAll(oldDest)
+	sort.Strings(links)
+	unlock, err := c.lockEntries(links)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	batch := commitIntent{}
+	for _, dest := range links {
+		old, err := c.fs.Readlink(dest)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read link: %w", err)
+		}
+		intent := commitIntent{Dest: dest, Target: targets[dest], Old: old}
+		if intent.Target != "" {
+			intent.Symlink = c.tempName(dest)
+		} else if old == "" {
+			continue // Already removed.
+		}
+		batch.Batch = append(batch.Batch, intent)
+	}
+	if len(batch.Batch) == 0 {
+		return nil
 	}
+	removeSymlinks := func(intents []commitIntent) {
+		for _, intent := range intents {
+			if intent.Symlink != "" {
+				_ = c.fs.Remove(intent.Symlink)
+			}
+		}
+	}
+	for i, intent := range batch.Batch {
+		if intent.Symlink == "" {
+			continue
+		}
+		if err := c.fs.Symlink(intent.Target, intent.Symlink); err != nil {
+			removeSymlinks(batch.Batch[:i])
+			return fmt.Errorf("failed to finalise symlink: %w", err)
+		}
+	}
+	marker, err := c.writeIntent(batch)
+	if err != nil {
+		removeSymlinks(batch.Batch)
+		return err
+	}
+	for i, intent := range batch.Batch {
+		if err := c.finaliseLink(intent); err != nil {
+			// Swap back the symlinks already swapped, so none are.
+			removeSymlinks(batch.Batch[i:])
+			for _, swapped := range batch.Batch[:i] {
+				if rerr := c.restoreLink(swapped); rerr != nil {
+					err = errors.Join(err, rerr)
+				}
+			}
+			_ = c.fs.Remove(marker)
+			return err
+		}
+	}
+	for _, intent := range batch.Batch {
+		c.removeOldTarget(intent)
+	}
+	_ = c.fs.Remove(marker)
+	var errs []error
+	for _, intent := range batch.Batch {
+		index := c.indexPut
+		if intent.Target == "" {
+			index = c.indexDelete
+		}
+		if err := index(intent.Dest); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// finaliseLink renames the temporary symlink of intent over its destination,
+// or removes the destination if intent has no target.
+func (c *Cache) finaliseLink(intent commitIntent) error {
+	if intent.Target == "" {
+		if err := c.fs.Remove(intent.Dest); err != nil {
+			return fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		return nil
+	}
+	if err := c.fs.Rename(intent.Symlink, intent.Dest); err != nil {
+		return fmt.Errorf("failed to finalise rename: %w", err)
+	}
+	return nil
+}
+
+// restoreLink points the symlink swapped by intent back at its old target,
+// or removes it if it had none.
+func (c *Cache) restoreLink(intent commitIntent) error {
+	if intent.Old == "" {
+		if err := c.fs.Remove(intent.Dest); err != nil {
+			return fmt.Errorf("failed to restore %q: %w", intent.Dest, err)
+		}
+		return nil
+	}
+	tmpSymlink := c.tempName(intent.Dest)
+	if err := c.fs.Symlink(intent.Old, tmpSymlink); err != nil {
+		return fmt.Errorf("failed to restore %q: %w", intent.Dest, err)
+	}
+	if err := c.fs.Rename(tmpSymlink, intent.Dest); err != nil {
+		_ = c.fs.Remove(tmpSymlink)
+		return fmt.Errorf("failed to restore %q: %w", intent.Dest, err)
+	}
+	return nil
+}
+
+// removeOldTarget removes the target replaced by a commit, if owned by the Cache.
+func (c *Cache) removeOldTarget(intent commitIntent) {
+	if intent.Old != "" && intent.Old != intent.Target && c.owns(intent.Old) {
+		_ = c.removeTarget(intent.Old)
+	}
+}
+
+// owns returns true if target is managed by the Cache, rather than being an
+// external target published with Link.
+func (c *Cache) owns(target string) bool {
+	return strings.HasPrefix(target, c.root+string(filepath.Separator))
+}
+
+// Link atomically points key at an externally managed target file or directory.
+//
+// The target is not owned by the Cache: it will not be deleted when the
+// entry is overwritten, removed or purged, and as it has no embedded
+// timestamp it is never purged by age. A target previously committed by the
+// Cache for key is owned, and is deleted as with Commit.
+//
+// Returns the path of the committed entry.
+func (c *Cache) Link(key, target string) (string, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.fs.Stat(target); err != nil {
+		return "", fmt.Errorf("invalid link target: %w", err)
+	}
+	c.frozen.RLock()
+	defer c.frozen.RUnlock()
+	if err := c.checkOpen(); err != nil {
+		return "", err
+	}
+	if err := c.checkHash(key); err != nil {
+		return "", err
+	}
+	dest := c.linkPath(key)
+	err = c.mkdir(filepath.Dir(dest))
+	if err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("failed to create cache partition: %w", err)
+	}
+	c.indexKey(key)
+	if err := c.swapLink(dest, target); err != nil {
+		if errors.Is(err, errIndexUpdate) {
+			atomic.AddInt64(&c.stats.writes, 1)
+		}
+		return "", err
+	}
+	atomic.AddInt64(&c.stats.writes, 1)
 	return dest, nil
 }
 
@@ -101,15 +681,23 @@ func (c *Cache) Rollback(tx Transaction) error {
 	if !tx.Valid() {
 		return fmt.Errorf("transaction is not valid")
 	}
-	path := tx.path(c.root)
-	return os.RemoveAll(path)
+	defer c.writes.release(tx)
+	start := time.Now()
+	c.indexForget(tx)
+	path := c.txPath(tx)
+	size := c.observedSize(path)
+	if err := c.removeTarget(path); err != nil {
+		return err
+	}
+	c.observe(OpRollback, c.txHash(tx), size, start)
+	return nil
 }
 
 // RollbackOnError is a convenience method for use with defer.
 //
 // It will Rollback on error, however Commit must be called manually.
 //
-//     defer cache.RollbackOnError(tx, &err)
+//	defer cache.RollbackOnError(tx, &err)
 func (c *Cache) RollbackOnError(tx Transaction, err *error) {
 	if *err != nil {
 		rberr := c.Rollback(tx)
@@ -121,12 +709,19 @@ func (c *Cache) RollbackOnError(tx Transaction, err *error) {
 
 // RollbackOrCommit is a convenience method for use with defer.
 //
-// It will Rollback on error or otherwise Commit.
+// It will Rollback on error or otherwise Commit, rolling back if the Commit
+// fails. If the deferring function panics the Transaction is rolled back and
+// the panic is propagated once rolled back, so partial content is never
+// committed.
 //
-//     defer cache.RollbackOrCommit(tx, &err)
+//	defer cache.RollbackOrCommit(tx, &err)
 func (c *Cache) RollbackOrCommit(tx Transaction, err *error) {
+	if r := recover(); r != nil {
+		_ = c.Rollback(tx)
+		panic(r)
+	}
 	if *err == nil {
-		_, *err = c.Commit(tx)
+		_, *err = c.commitOrRollback(tx)
 	} else {
 		rberr := c.Rollback(tx)
 		if rberr != nil {
@@ -135,23 +730,111 @@ func (c *Cache) RollbackOrCommit(tx Transaction, err *error) {
 	}
 }
 
+// commitOrRollback commits tx, rolling it back if the commit fails so that it
+// does not remain in-flight.
+func (c *Cache) commitOrRollback(tx Transaction) (string, error) {
+	path, done, err := c.commit(context.Background(), tx)
+	if err != nil && !done {
+		if rberr := c.Rollback(tx); rberr != nil {
+			return "", fmt.Errorf("error rolling back: %s: %w", rberr, err)
+		}
+		return "", err
+	}
+	return path, err
+}
+
 // Mkdir creates a directory in the cache.
 //
 // Commit() must be called with the returned Transaction to atomically
 // add the created directory to the Cache.
 //
-//     tx, dir, err := cache.Mkdir("my-key")
-//     err = cache.Commit(tx)
+//	tx, dir, err := cache.Mkdir("my-key")
+//	err = cache.Commit(tx)
+//
+// ErrKindMismatch is returned if key has a committed file entry, unless
+// WithKindOverwrite is set.
 func (c *Cache) Mkdir(key string) (Transaction, string, error) {
-	path, err := c.pathForKey(key)
+	return c.mkdirTx(key, c.kindOverwrite, nil)
+}
+
+// mkdirTx creates a directory Transaction, replacing a file entry for key
+// only if overwrite is true.
+//
+// If b is not nil the Transaction is created as part of the batch.
+func (c *Cache) mkdirTx(key string, overwrite bool, b *writeBatch) (Transaction, string, error) {
+	if err := c.checkOpen(); err != nil {
+		return "", "", err
+	}
+	if !overwrite {
+		if err := c.checkKind(key, true); err != nil {
+			return "", "", err
+		}
+	}
+	if err := b.acquire(c.writes); err != nil {
+		return "", "", err
+	}
+	path, err := c.pathForKey(key, c.clock.Now(), b)
 	if err != nil {
+		c.writes.cancel()
 		return "", "", err
 	}
-	err = os.Mkdir(path, 0700)
+	err = c.mkdir(path)
 	if err != nil {
+		c.writes.cancel()
 		return "", "", fmt.Errorf("could not create cache directory: %w", err)
 	}
-	return Transaction(filepath.Base(path)), path, nil
+	tx := c.txFor(path)
+	c.writes.hold(tx)
+	if err := c.applyDefaultTTL(path); err != nil {
+		_ = c.Rollback(tx)
+		return "", "", err
+	}
+	return tx, path, nil
+}
+
+// ReplaceDir atomically replaces the directory entry for key.
+//
+// The new directory is populated by build in a fresh Transaction, which is
+// committed if build succeeds and rolled back otherwise. If build panics the
+// Transaction is rolled back and the panic propagated. Readers will see either
+// the previous directory or the fully built replacement, never a partially
+// built directory. A file entry for key is also replaced, regardless of
+// WithKindOverwrite.
+func (c *Cache) ReplaceDir(key string, build func(dir string) error) (err error) {
+	tx, dir, err := c.mkdirTx(key, true, nil)
+	if err != nil {
+		return err
+	}
+	defer c.RollbackOrCommit(tx, &err)
+	return build(dir)
+}
+
+// WithDir creates a directory for key, passes its path to populate, and
+// commits it if populate succeeds, eg. to extract an archive and publish it
+// atomically.
+//
+// If populate returns an error or panics the Transaction is rolled back, and
+// any panic is propagated once rolled back. Returns the path of the committed
+// entry. As with Mkdir, ErrKindMismatch is returned if key has a committed
+// file entry, unless WithKindOverwrite is set.
+func (c *Cache) WithDir(key string, populate func(dir string) error) (path string, err error) {
+	tx, dir, err := c.Mkdir(key)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = c.Rollback(tx)
+			panic(r)
+		}
+	}()
+	if err := populate(dir); err != nil {
+		if rberr := c.Rollback(tx); rberr != nil {
+			return "", fmt.Errorf("error rolling back: %s: %w", rberr, err)
+		}
+		return "", err
+	}
+	return c.commitOrRollback(tx)
 }
 
 // Create a file in the Cache.
@@ -159,170 +842,925 @@ func (c *Cache) Mkdir(key string) (Transaction, string, error) {
 // Commit() must be called with the returned Transaction to atomically
 // add the created file to the Cache.
 //
-//     tx, f, err := cache.Create("my-key")
-//     err = f.Close()
-//     err = cache.Commit(tx)
+//	tx, f, err := cache.Create("my-key")
+//	err = f.Close()
+//	err = cache.Commit(tx)
+//
+// ErrKindMismatch is returned if key has a committed directory entry, unless
+// WithKindOverwrite is set.
 func (c *Cache) Create(key string) (Transaction, *os.File, error) {
-	path, err := c.pathForKey(key)
+	tx, f, err := c.create(key)
 	if err != nil {
 		return "", nil, err
 	}
-	f, err := os.Create(path)
+	osf, ok := f.(*os.File)
+	if !ok {
+		_ = f.Close()
+		_ = c.Rollback(tx)
+		return "", nil, ErrNotOSFile
+	}
+	return tx, osf, nil
+}
+
+func (c *Cache) create(key string) (Transaction, File, error) {
+	return c.createTx(key, c.kindOverwrite, nil)
+}
+
+// createTx creates a file Transaction, replacing a directory entry for key
+// only if overwrite is true.
+//
+// If b is not nil the Transaction is created as part of the batch.
+func (c *Cache) createTx(key string, overwrite bool, b *writeBatch) (Transaction, File, error) {
+	return c.createTxAt(key, c.clock.Now(), overwrite, b)
+}
+
+// createTxAt is like createTx, but the entry is committed with the creation
+// time created.
+func (c *Cache) createTxAt(key string, created time.Time, overwrite bool, b *writeBatch) (Transaction, File, error) {
+	if err := c.checkOpen(); err != nil {
+		return "", nil, err
+	}
+	if !overwrite {
+		if err := c.checkKind(key, false); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := b.acquire(c.writes); err != nil {
+		return "", nil, err
+	}
+	path, err := c.pathForKey(key, created, b)
 	if err != nil {
+		c.writes.cancel()
+		return "", nil, err
+	}
+	f, err := c.createFile(path)
+	if err != nil {
+		c.writes.cancel()
 		return "", nil, fmt.Errorf("could not create cache file: %w", err)
 	}
-	return Transaction(filepath.Base(path)), f, nil
+	tx := c.txFor(path)
+	c.writes.hold(tx)
+	if err := c.applyDefaultTTL(path); err != nil {
+		_ = f.Close()
+		_ = c.Rollback(tx)
+		return "", nil, err
+	}
+	return tx, f, nil
 }
 
 // WriteFile writes a byte slice to a file in the cache.
 func (c *Cache) WriteFile(key string, data []byte) (err error) {
-	tx, w, err := c.Create(key)
+	return c.writeFile(key, data, nil)
+}
+
+// writeFile writes data to a file in the cache, applying update, if any, to
+// its metadata.
+func (c *Cache) writeFile(key string, data []byte, update func(meta *EntryMeta)) error {
+	tx, err := c.writeTx(key, data, update, nil)
 	if err != nil {
 		return err
 	}
-	defer c.RollbackOrCommit(tx, &err)
+	_, err = c.commitOrRollback(tx)
+	return err
+}
+
+// writeTx writes data to a new file Transaction for key, applying update,
+// if any, to its metadata. The Transaction is rolled back on error.
+//
+// If b is not nil the Transaction is created as part of the batch.
+func (c *Cache) writeTx(key string, data []byte, update func(meta *EntryMeta), b *writeBatch) (tx Transaction, err error) {
+	tx, w, err := c.createTx(key, c.kindOverwrite, b)
+	if err != nil {
+		return "", err
+	}
+	defer c.RollbackOnError(tx, &err)
+	if c.compress {
+		size := len(data)
+		if data, err = compress(data); err != nil {
+			_ = w.Close()
+			return "", err
+		}
+		original := update
+		update = func(meta *EntryMeta) {
+			meta.OriginalSize = int64(size)
+			if original != nil {
+				original(meta)
+			}
+		}
+	}
+	if update != nil {
+		if err = c.updateMeta(c.txPath(tx), update); err != nil {
+			_ = w.Close()
+			return "", err
+		}
+	}
 	_, err = w.Write(data)
 	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		_ = w.Close()
+		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 	err = w.Close()
 	if err != nil {
-		return fmt.Errorf("failed to close file: %w", err)
+		return "", fmt.Errorf("failed to close file: %w", err)
 	}
-	return nil
+	return tx, nil
+}
+
+// WriteFrom streams the content of r to a file in the cache, returning the
+// number of bytes read from r.
+//
+// Unlike WriteFile the content is not buffered in memory. The Transaction is
+// rolled back if reading from r fails or panics. If WithCompression is set the content
+// is compressed as it is written, as with CreateCompressed.
+func (c *Cache) WriteFrom(key string, r io.Reader) (n int64, err error) {
+	var (
+		tx Transaction
+		w  io.WriteCloser
+	)
+	if c.compress {
+		tx, w, err = c.CreateCompressed(key, Gzip)
+	} else {
+		tx, w, err = c.create(key)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer c.RollbackOrCommit(tx, &err)
+	// Closed before rolling back if r panics.
+	defer w.Close() //nolint:errcheck
+	n, err = io.Copy(w, r)
+	if err != nil {
+		_ = w.Close()
+		return n, fmt.Errorf("failed to write file: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return n, fmt.Errorf("failed to close file: %w", err)
+	}
+	return n, nil
+}
+
+// WithTransaction creates a file for key, passes it to fn, and commits it if
+// fn succeeds.
+//
+// The file is closed once fn returns, and fn may also close it. If fn
+// returns an error or panics the Transaction is rolled back, and any panic
+// is propagated once rolled back. Returns the path of the committed entry.
+func (c *Cache) WithTransaction(key string, fn func(w *os.File) error) (path string, err error) {
+	tx, f, err := c.Create(key)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = f.Close()
+			_ = c.Rollback(tx)
+			panic(r)
+		}
+	}()
+	err = fn(f)
+	if cerr := f.Close(); err == nil && cerr != nil && !errors.Is(cerr, os.ErrClosed) {
+		err = fmt.Errorf("failed to close file: %w", cerr)
+	}
+	if err != nil {
+		if rberr := c.Rollback(tx); rberr != nil {
+			return "", fmt.Errorf("error rolling back: %s: %w", rberr, err)
+		}
+		return "", err
+	}
+	return c.commitOrRollback(tx)
+}
+
+// AssembleParts writes each part in order into a single entry for key,
+// atomically committing it once all parts have been written.
+//
+// If reading any part fails the entry is rolled back. Returns the path of
+// the committed entry.
+func (c *Cache) AssembleParts(key string, parts []io.Reader) (path string, err error) {
+	tx, w, err := c.create(key)
+	if err != nil {
+		return "", err
+	}
+	defer c.RollbackOnError(tx, &err)
+	for i, part := range parts {
+		if _, err := io.Copy(w, part); err != nil {
+			_ = w.Close()
+			return "", fmt.Errorf("failed to write part %d: %w", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to close file: %w", err)
+	}
+	return c.Commit(tx)
 }
 
 // CreateOrRead creates a key if it doesn't exist, or opens it for reading if it does.
 //
-// Use Transaction.Valid() to check if the key was created.
+// Use Transaction.Valid() to check if the key was created. Errors opening
+// the key other than it not existing are returned rather than creating it.
 func (c *Cache) CreateOrRead(key string) (Transaction, *os.File, error) {
 	f, err := c.Open(key)
-	if err != nil {
+	if errors.Is(err, os.ErrNotExist) {
 		return c.Create(key)
+	} else if err != nil {
+		return "", nil, err
 	}
-	return "", f, err
+	return "", f, nil
 }
 
 // Remove cache entry atomically.
+//
+// If WithSoftDelete is set the entry is moved to the trash, from where it
+// can be recovered with Restore.
 func (c *Cache) Remove(key string) error {
-	key = hash(key, false)
-	path := filepath.Join(c.root, key[:2], key)
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	link := c.linkPath(key)
+	if err := c.beforeEvict(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	unlock, err := c.lockEntry(link)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if c.softDelete > 0 {
+		return c.trash(link)
+	}
+	return c.removeLink(link)
+}
 
+// removeLinkTo removes the committed entry at link, as with removeLink, if it
+// still points to target, so that an entry replaced since it was read is
+// left alone. It returns true if the entry was removed.
+func (c *Cache) removeLinkTo(link, target string) (bool, error) {
+	unlock, err := c.lockEntry(link)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if current, err := c.fs.Readlink(link); err != nil || current != target {
+		return false, nil //nolint:nilerr
+	}
+	return true, c.removeLink(link)
+}
+
+// removeLinkOnly removes the symlink at link, leaving its target in place, if
+// it still points to target. It returns true if the symlink was removed.
+func (c *Cache) removeLinkOnly(link, target string) (bool, error) {
+	unlock, err := c.lockEntry(link)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if current, err := c.fs.Readlink(link); err != nil || current != target {
+		return false, nil //nolint:nilerr
+	}
+	if err := c.fs.Remove(link); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to remove entry link: %w", err)
+	}
+	return true, nil
+}
+
+// removeLink removes a committed entry's symlink and, if owned, its target.
+func (c *Cache) removeLink(path string) error {
 	// First, store the old link if any, so we can remove its target.
-	oldDest, err := os.Readlink(path)
+	oldDest, err := c.fs.Readlink(path)
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to read entry: %w", err)
 	}
 
-	err = os.Remove(path)
+	err = c.fs.Remove(path)
 	if err != nil {
 		return fmt.Errorf("failed to remove cache entry: %w", err)
 	}
 
-	if oldDest != "" {
-		_ = os.RemoveAll(oldDest)
+	if oldDest != "" && c.owns(oldDest) {
+		_ = c.removeTarget(oldDest)
 	}
-	return nil
+	return c.indexDelete(path)
+}
+
+// Hash returns the hash used to address key on disk.
+//
+// Committed entries for key are stored at "<root>/<partition>/<hash>", where
+// the partition is the first two characters of the hash unless configured
+// otherwise, eg. with WithGroupBy. The hash is SHA-256 unless configured
+// otherwise with WithHasher.
+func (c *Cache) Hash(key string) string {
+	return c.keyHash(key)
 }
 
 // IfExists returns the path to a cache entry if it exists, or empty string if it does not.
+//
+// If WithExpiryEnforced is set, entries older than their TTL do not exist.
 func (c *Cache) IfExists(key string) string {
-	key = hash(key, false)
-	path := filepath.Join(c.root, key[:2], key)
-	_, err := os.Stat(path)
+	path := c.linkPath(key)
+	_, err := c.fs.Stat(path)
+	if err == nil && c.enforceExpiry {
+		var target string
+		if target, err = c.fs.Readlink(path); err == nil {
+			err = c.checkExpiry(path, target)
+		}
+	}
+	c.stats.record(err)
 	if err != nil {
 		return ""
 	}
 	return path
 }
 
+// Stat returns the os.FileInfo of the committed file or directory for key.
+//
+// If key has no entry the error satisfies os.IsNotExist.
+func (c *Cache) Stat(key string) (os.FileInfo, error) {
+	info, err := c.fs.Stat(c.linkPath(key))
+	if err != nil {
+		var perr *os.PathError
+		if errors.As(err, &perr) {
+			return nil, &os.PathError{Op: "stat", Path: key, Err: perr.Err}
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
 // Open a file or directory in the Cache.
+//
+// An error wrapping ErrNotFound is returned if key has no entry. Use
+// OpenFile or OpenDir to require an entry of a particular kind.
 func (c *Cache) Open(key string) (*os.File, error) {
-	key = hash(key, false)
-	return os.Open(filepath.Join(c.root, key[:2], key))
+	f, err := c.open(key)
+	if err != nil {
+		return nil, err
+	}
+	osf, ok := f.(*os.File)
+	if !ok {
+		_ = f.Close()
+		return nil, ErrNotOSFile
+	}
+	return osf, nil
+}
+
+func (c *Cache) open(key string) (File, error) {
+	f, _, err := c.openEntry(key)
+	return f, err
+}
+
+// openEntry opens the target of the committed entry for key, returning it
+// along with the target's path.
+//
+// If the target is removed between resolving the symlink and opening it, eg.
+// by a concurrent Purge or Commit, the symlink is resolved once more. An error
+// wrapping ErrNotFound is returned if there is no entry or it has expired,
+// but not if the entry's target is missing, eg. for a Link to a removed path.
+func (c *Cache) openEntry(key string) (File, string, error) {
+	start := time.Now()
+	link := c.linkPath(key)
+	target, err := c.fs.Readlink(link)
+	if os.IsNotExist(err) && c.fallback != nil {
+		if ferr := c.readFromFallback(key); ferr != nil {
+			return nil, "", ferr
+		}
+		target, err = c.fs.Readlink(link)
+	}
+	if err == nil {
+		err = c.checkExpiry(link, target)
+	}
+	var f File
+	if err == nil {
+		f, err = c.fs.Open(target)
+		if os.IsNotExist(err) {
+			f, target, err = c.reopenEntry(key, link)
+		}
+	} else if os.IsNotExist(err) {
+		err = notFound("open", key)
+	}
+	c.stats.record(err)
+	c.observeRead(filepath.Base(link), f, err, start)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, target, nil
+}
+
+// reopenEntry resolves and opens the committed entry for key at link after
+// its previous target vanished.
+func (c *Cache) reopenEntry(key, link string) (File, string, error) {
+	target, err := c.fs.Readlink(link)
+	if os.IsNotExist(err) {
+		return nil, "", notFound("open", key)
+	} else if err != nil {
+		return nil, "", err
+	}
+	f, err := c.fs.Open(target)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, target, nil
 }
 
 // ReadFile identified by key.
+//
+// Entries compressed with WithCompression or CreateCompressed are
+// decompressed. An error wrapping ErrNotFound is returned if key has no
+// entry.
 func (c *Cache) ReadFile(key string) ([]byte, error) {
-	key = hash(key, false)
-	path := filepath.Join(c.root, key[:2], key)
-	return ioutil.ReadFile(path)
+	f, target, err := c.openEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.readEntry(f, target)
+}
+
+// readEntry reads and closes an entry's file opened from target.
+func (c *Cache) readEntry(f File, target string) ([]byte, error) {
+	r, err := c.entryReader(f, target)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// GetFresh reads the file identified by key if it was created within maxAge.
+//
+// found is false if the entry does not exist or is older than maxAge. Stale
+// entries are treated as misses but are left in place for Purge to remove.
+// Entries published with Link have no creation time and are never stale.
+func (c *Cache) GetFresh(key string, maxAge time.Duration) (data []byte, found bool, err error) {
+	target, err := c.fs.Readlink(c.linkPath(key))
+	if os.IsNotExist(err) {
+		c.stats.record(err)
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to read entry: %w", err)
+	}
+	if c.owns(target) {
+		created, err := c.targetTime(target)
+		if err != nil {
+			return nil, false, err
+		}
+		if c.clock.Since(created) > maxAge {
+			c.stats.misses.add(1)
+			return nil, false, nil
+		}
+	}
+	// Read the target directly so the content matches the checked timestamp.
+	f, err := c.fs.Open(target)
+	c.stats.record(err)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	data, err = c.readEntry(f, target)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// ReadRange reads up to length bytes of the file identified by key,
+// starting at offset.
+//
+// Fewer bytes are returned if the end of the file is reached. Ranges are of
+// the decompressed content of compressed entries. An error wrapping
+// ErrNotFound is returned if key has no entry.
+func (c *Cache) ReadRange(key string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range: offset %d and length %d must not be negative", offset, length)
+	}
+	f, target, err := c.openEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.entryReader(f, target)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if s, ok := r.(io.Seeker); ok {
+		_, err = s.Seek(offset, io.SeekStart)
+	} else {
+		// Compressed content can only be skipped by decompressing it.
+		_, err = io.CopyN(ioutil.Discard, r, offset)
+		if err == io.EOF {
+			return []byte{}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(io.LimitReader(r, length))
+}
+
+// ReadFileLimit reads the file identified by key, returning ErrTooLarge
+// without reading it if it is larger than max bytes.
+//
+// The limit applies to the decompressed content of compressed entries.
+func (c *Cache) ReadFileLimit(key string, max int64) ([]byte, error) {
+	f, target, err := c.openEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	size, err := c.contentSize(f, target, info)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if size > max {
+		_ = f.Close()
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrTooLarge, size, max)
+	}
+	r, err := c.entryReader(f, target)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// The entry may be a directory, may have grown since Stat, or may have
+	// a wrong recorded size, so bound the read too.
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: exceeds limit of %d bytes", ErrTooLarge, max)
+	}
+	return data, nil
+}
+
+// Size returns the total size in bytes of all committed entries in the Cache.
+//
+// Directory entries are walked recursively. In-flight transactions and
+// targets without a committed symlink are transient and are not counted.
+// Entries removed while Size is running are skipped.
+func (c *Cache) Size() (int64, error) {
+	if c.index != nil {
+		var total int64
+		err := c.withIndex(func(idx *keyIndex) {
+			for _, entry := range idx.entries {
+				total += entry.size
+			}
+		})
+		return total, err
+	}
+	links, err := c.committed()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, link := range links {
+		size, err := c.entrySize(link)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// Count returns the number of committed entries in the Cache.
+func (c *Cache) Count() (int, error) {
+	if c.index != nil {
+		count := 0
+		err := c.withIndex(func(idx *keyIndex) { count = len(idx.entries) })
+		return count, err
+	}
+	links, err := c.committed()
+	if err != nil {
+		return 0, err
+	}
+	return len(links), nil
 }
 
 // Purge entry for given key if older than given age.
 func (c *Cache) PurgeKey(key string, older time.Duration) error {
-	key = hash(key, false)
-	path := filepath.Join(c.root, key[:2], key)
-	entry, err := os.Readlink(path)
+	_, err := c.PurgeKeyN(key, older)
+	return err
+}
+
+// PurgeKeyN is like PurgeKey, but also returns the number of entries
+// removed, which is 0 or 1.
+func (c *Cache) PurgeKeyN(key string, older time.Duration) (int, error) {
+	path := c.linkPath(key)
+	entry, err := c.fs.Readlink(path)
 	if err != nil && os.IsNotExist(err) {
-		return nil // no entry to be purged
+		return 0, nil // no entry to be purged
 	}
 	if err != nil {
-		return fmt.Errorf("could not read link for purging: %w", err)
+		return 0, fmt.Errorf("could not read link for purging: %w", err)
+	}
+	if !c.owns(entry) {
+		return 0, nil // linked entries are not purged
 	}
-	return removeEntry(entry, older)
+	removed, err := c.removeEntry(entry, older)
+	if removed {
+		return 1, err
+	}
+	return 0, err
 }
 
 // Purge all entries older than the given age.
+//
+// Entries created within the purge safety window are kept regardless of
+// older, so Purge(0) no longer removes every entry by default. Use
+// WithPurgeSafetyWindow(0) to restore that behaviour.
 func (c *Cache) Purge(older time.Duration) error {
-	partitions, err := filepath.Glob(filepath.Join(c.root, "*"))
+	return c.PurgeContext(context.Background(), older)
+}
+
+// PurgeN is like Purge, but also returns the number of entries removed,
+// including abandoned in-flight Transactions.
+func (c *Cache) PurgeN(older time.Duration) (int, error) {
+	return c.purge(context.Background(), older)
+}
+
+// PurgeContext is like Purge, but stops and returns ctx.Err() if ctx is
+// done before the purge completes.
+//
+// ctx is checked between partitions and between entries, so entries already
+// purged remain purged.
+func (c *Cache) PurgeContext(ctx context.Context, older time.Duration) error {
+	_, err := c.purge(ctx, older)
+	return err
+}
+
+func (c *Cache) purge(ctx context.Context, older time.Duration) (removed int, err error) {
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+	partitions, err := c.partitions()
 	if err != nil {
-		return fmt.Errorf("could not list partitions: %w", err)
+		return 0, err
 	}
+	return c.purgePartitions(ctx, partitions, older)
+}
+
+// purgePartitions removes entries older than older from each of the given
+// partition directories.
+func (c *Cache) purgePartitions(ctx context.Context, partitions []string, older time.Duration) (removed int, err error) {
+	var errs []error
 	for _, partition := range partitions {
-		entries, err := filepath.Glob(filepath.Join(partition, "*"))
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		entries, err := c.fs.Glob(filepath.Join(partition, "*"))
 		if err != nil {
-			return fmt.Errorf("could not list entries in %q: %w", partition, err)
+			return removed, fmt.Errorf("could not list entries in %q: %w", partition, err)
 		}
 		for _, entry := range entries {
-			if err := removeEntry(entry, older); err != nil {
-				return err
+			if err := ctx.Err(); err != nil {
+				return removed, err
+			}
+			if c.inSafetyWindow(entry) {
+				continue
+			}
+			ok, err := c.removeEntry(entry, older)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if ok {
+				removed++
 			}
 		}
 	}
-	return nil
+	return removed, errors.Join(errs...)
 }
 
-func removeEntry(entry string, older time.Duration) error {
-	ext := filepath.Ext(entry)
-	if ext == "" {
-		return nil
+// removeEntry removes the target or in-flight Transaction entry if it is
+// older than older, returning true if it was removed.
+func (c *Cache) removeEntry(entry string, older time.Duration) (bool, error) {
+	start := time.Now()
+	link, ok, err := c.purgeable(entry, older)
+	if err != nil || !ok {
+		return false, err
+	}
+	size := c.observedSize(entry)
+	committed := false
+	if target, err := c.fs.Readlink(link); err == nil && target == entry {
+		// Called before locking, as the function may use the Cache.
+		if err := c.beforeEvict(link); err != nil {
+			return false, err
+		}
+		committed = true
 	}
-	hexTimestamp := strings.TrimPrefix(ext, ".")
-	var ts int64
-	_, err := fmt.Sscanf(hexTimestamp, "%x", &ts)
+	if committed {
+		// Only remove the symlink if it was not replaced in the meantime.
+		if committed, err = c.removeLinkOnly(link, entry); err != nil {
+			return false, err
+		}
+	}
+	err = c.removeTarget(entry)
 	if err != nil {
-		return fmt.Errorf("invalid cache entry %q: %w", entry, err)
+		return false, fmt.Errorf("failed to remove entry: %w", err)
 	}
-	fileTime := time.Unix(0, ts)
-	if clock.Since(fileTime) < older {
-		return nil
+	atomic.AddInt64(&c.stats.evictions, 1)
+	c.observe(OpEvict, filepath.Base(link), size, start)
+	if !committed {
+		return true, nil
 	}
-	err = os.Remove(strings.TrimSuffix(entry, ext))
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove entry link: %w", err)
+	return true, c.indexDelete(link)
+}
+
+// purgeable returns the path of the symlink for a target or in-flight
+// Transaction, and whether it is older than older.
+func (c *Cache) purgeable(entry string, older time.Duration) (link string, ok bool, err error) {
+	link, fileTime, err := c.parseTarget(entry)
+	if err != nil {
+		if filepath.Ext(entry) == "" {
+			return "", false, nil // a committed entry's symlink
+		}
+		return "", false, err
+	}
+	if link == entry || !c.expired(fileTime, older) {
+		return link, false, nil
+	}
+	return link, true, nil
+}
+
+// partitions returns the paths of all partition directories.
+//
+// Names under the root beginning with "." are reserved for the Cache's own
+// bookkeeping and are not partitions.
+func (c *Cache) partitions() ([]string, error) {
+	paths, err := c.fs.Glob(filepath.Join(c.root, "*"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list partitions: %w", err)
+	}
+	out := paths[:0]
+	for _, path := range paths {
+		if isPartitionName(filepath.Base(path)) {
+			out = append(out, path)
+		}
+	}
+	return out, nil
+}
+
+// isPartitionName returns true if name could be a partition directory,
+// rather than a reserved directory.
+//
+// Partitions are named by hex digits, whether by hash prefix or by
+// WithConsistentHashPartitions.
+func isPartitionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
 	}
-	err = os.RemoveAll(entry)
+	return true
+}
+
+// committed returns the paths of the symlinks for all committed entries.
+func (c *Cache) committed() ([]string, error) {
+	partitions, err := c.partitions()
 	if err != nil {
-		return fmt.Errorf("failed to remove entry: %w", err)
+		return nil, err
 	}
-	return nil
+	var out []string
+	for _, partition := range partitions {
+		entries, err := c.fs.Glob(filepath.Join(partition, "*"))
+		if err != nil {
+			return nil, fmt.Errorf("could not list entries in %q: %w", partition, err)
+		}
+		for _, entry := range entries {
+			if filepath.Ext(entry) != "" {
+				continue
+			}
+			info, err := c.fs.Lstat(entry)
+			if err != nil || info.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+// entrySize returns the size of the file or directory tree an entry symlink resolves to.
+func (c *Cache) entrySize(link string) (int64, error) {
+	info, err := c.fs.Stat(link)
+	if err != nil {
+		return 0, fmt.Errorf("could not size entry: %w", err)
+	}
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+	target, err := c.fs.Readlink(link)
+	if err != nil {
+		return 0, fmt.Errorf("could not resolve entry: %w", err)
+	}
+	size, err := c.dirSize(target, 0)
+	if err != nil {
+		return 0, fmt.Errorf("could not size entry: %w", err)
+	}
+	return size, nil
 }
 
-func (c *Cache) pathForKey(key string) (string, error) {
-	key = hash(key, true)
-	path := filepath.Join(c.root, key[:2], key)
-	err := os.Mkdir(filepath.Dir(path), 0700)
+// dirSize returns the total size of regular files under dir.
+func (c *Cache) dirSize(dir string, depth int) (int64, error) {
+	if err := c.checkDepth(dir, depth); err != nil {
+		return 0, err
+	}
+	entries, err := c.fs.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			size, err := c.dirSize(filepath.Join(dir, entry.Name()), depth+1)
+			if err != nil {
+				return 0, err
+			}
+			total += size
+			continue
+		}
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// pathForKey returns the path for a new Transaction for key created at
+// created, creating its partition directory unless b, if not nil, already
+// has.
+func (c *Cache) pathForKey(key string, created time.Time, b *writeBatch) (string, error) {
+	if err := c.checkHash(key); err != nil {
+		return "", err
+	}
+	path := filepath.Join(c.root, c.keyPartition(key), c.tempPrefix+defaultTargetFormat(c.keyHash(key), created))
+	if err := checkPathLength(path); err != nil {
+		return "", err
+	}
+	c.indexKey(key)
+	dir := filepath.Dir(path)
+	if b != nil && b.dirs[dir] {
+		return path, nil
+	}
+	err := c.mkdir(dir)
 	if err != nil && !os.IsExist(err) {
 		return "", fmt.Errorf("failed to create cache partition: %w", err)
 	}
+	if b != nil {
+		b.dirs[dir] = true
+	}
 	return path, nil
 }
 
-func hash(key string, timestamp bool) string {
-	h := sha256.Sum256([]byte(key))
-	if timestamp {
-		return fmt.Sprintf("%x.%x", h, clock.Now().UnixNano())
+func (c *Cache) txPath(tx Transaction) string {
+	if !tx.Valid() {
+		panic("transaction is not valid")
+	}
+	if strings.Contains(string(tx), "/") {
+		return filepath.Join(c.root, filepath.FromSlash(string(tx)))
 	}
+	return c.entryPath(string(tx))
+}
+
+// entryPath returns the path for a hashed key, with or without a timestamp.
+//
+// Names may also carry the temporary prefix.
+func (c *Cache) entryPath(name string) string {
+	h := strings.TrimPrefix(strings.TrimSuffix(name, filepath.Ext(name)), c.tempPrefix)
+	return filepath.Join(c.root, c.partition(h), name)
+}
+
+// partition returns the name of the partition directory for a hash.
+//
+// This is the only place hashes are split into partitions. Hashes too short
+// to name a partition are padded rather than panicking, though such hashes
+// are rejected by checkHash before an entry can be written.
+func (c *Cache) partition(h string) string {
+	if c.ring != nil {
+		return c.ring.partition(h)
+	}
+	if len(h) < partitionLen {
+		return h + strings.Repeat(invalidHashPad, partitionLen-len(h))
+	}
+	return h[:partitionLen]
+}
+
+// hash is the default hasher, returning the hex SHA-256 of key.
+func hash(key string) string {
+	h := sha256.Sum256([]byte(key))
 	return fmt.Sprintf("%x", h)
 }
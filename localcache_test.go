@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/stretchr/testify/require"
@@ -25,6 +27,11 @@ func TestCache(t *testing.T) {
 	require.NoError(t, err)
 	_ = f.Close()
 
+	_, _, err = cache.Create("test")
+	require.ErrorIs(t, err, ErrKindMismatch)
+	err = cache.Remove("test")
+	require.NoError(t, err)
+
 	tx, f, err = cache.Create("test")
 	require.NoError(t, err)
 	_, err = f.WriteString("hello")
@@ -52,7 +59,7 @@ func TestCache(t *testing.T) {
 	err = cache.Remove("test")
 	require.NoError(t, err)
 
-	require.Equal(t, []string{"", "/8b", "/9f"}, list(cache))
+	require.Equal(t, []string{"", "/.locks", "/.locks/9f", "/.pending", "/8b", "/9f"}, list(cache))
 }
 
 func TestRollbackOnError(t *testing.T) {
@@ -77,59 +84,614 @@ func list(cache *Cache) (out []string) {
 }
 
 func TestPurge(t *testing.T) {
-	globalClock := clock
-	testClock := &fakeClock{currentTime: time.Now()}
-	clock = testClock
-	defer func() { clock = globalClock }()
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		texts := []string{"hello", "world", "in", "2021"}
+		for _, text := range texts {
+			// testClock advances 2 secs for every writeFile
+			err := cache.WriteFile(text, []byte(text))
+			require.NoError(t, err)
+		}
+		// clock has advanced 8 seconds
+
+		for _, text := range texts {
+			// all entries must exist
+			require.NotEmpty(t, cache.IfExists(text))
+		}
+		err := cache.Purge(3500 * time.Millisecond) // 3.5 seconds
+		require.NoError(t, err)
+		for _, text := range texts[:2] {
+			// first two entries should have been purged
+			require.Empty(t, cache.IfExists(text))
+		}
+		for _, text := range texts[2:] {
+			// last two entries should still exist
+			require.NotEmpty(t, cache.IfExists(text))
+		}
+	})
+}
+
+func TestPurgeN(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		for _, text := range []string{"hello", "world", "in", "2021"} {
+			err := cache.WriteFile(text, []byte(text))
+			require.NoError(t, err)
+		}
+		removed, err := cache.PurgeN(3500 * time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, 2, removed)
+		removed, err = cache.PurgeN(3500 * time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, 0, removed)
+
+		removed, err = cache.PurgeKeyN("in", time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 0, removed)
+		removed, err = cache.PurgeKeyN("in", 0)
+		require.NoError(t, err)
+		require.Equal(t, 1, removed)
+		removed, err = cache.PurgeKeyN("in", 0)
+		require.NoError(t, err)
+		require.Equal(t, 0, removed)
+	})
+}
+
+func TestPurgeKey(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		err := cache.WriteFile("hello", []byte("hello"))
+		require.NoError(t, err)
 
+		err = cache.PurgeKey("hello", 5*time.Second)
+		require.NoError(t, err)
+		// entry should still exist
+		require.NotEmpty(t, cache.IfExists("hello"))
+
+		err = cache.PurgeKey("hello", 0*time.Second)
+		require.NoError(t, err)
+		// entry should be gone
+		require.Empty(t, cache.IfExists("hello"))
+	})
+}
+
+func TestPurgeKeyMissingEntry(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		err := cache.PurgeKey("missing-dir/missing-entry", 0)
+		require.NoError(t, err)
+	})
+}
+
+func TestReplaceDir(t *testing.T) {
 	cache := NewForTesting(t)
-	texts := []string{"hello", "world", "in", "2021"}
-	for _, text := range texts {
-		// testClock advances 2 secs for every writeFile
-		err := cache.WriteFile(text, []byte(text))
+	err := cache.ReplaceDir("test", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file"), []byte("old"), 0600)
+	})
+	require.NoError(t, err)
+
+	err = cache.ReplaceDir("test", func(dir string) error {
+		err := os.WriteFile(filepath.Join(dir, "file"), []byte("new"), 0600)
 		require.NoError(t, err)
-	}
-	// clock has advanced 8 seconds
+		return fmt.Errorf("build failed")
+	})
+	require.EqualError(t, err, "build failed")
 
-	for _, text := range texts {
-		// all entries must exist
-		require.NotEmpty(t, cache.IfExists(text))
-	}
-	err := cache.Purge(3500 * time.Millisecond) // 3.5 seconds
+	data, err := os.ReadFile(filepath.Join(cache.IfExists("test"), "file"))
+	require.NoError(t, err)
+	require.Equal(t, "old", string(data))
+
+	err = cache.ReplaceDir("test", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file"), []byte("new"), 0600)
+	})
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(cache.IfExists("test"), "file"))
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+}
+
+func TestReplaceDirPanic(t *testing.T) {
+	cache := NewForTesting(t)
+	require.Panics(t, func() {
+		_ = cache.ReplaceDir("test", func(dir string) error {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("partial"), 0600))
+			panic("build failed")
+		})
+	})
+	require.Empty(t, cache.IfExists("test"))
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestHash(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("test", []byte("test"))
+	require.NoError(t, err)
+	h := cache.Hash("test")
+	require.Equal(t, filepath.Join(cache.root, h[:2], h), cache.IfExists("test"))
+}
+
+func TestReadFileLimit(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		err := cache.WriteFile("test", []byte("hello world"))
+		require.NoError(t, err)
+
+		data, err := cache.ReadFileLimit("test", 11)
+		require.NoError(t, err)
+		require.Equal(t, "hello world", string(data))
+
+		data, err = cache.ReadFileLimit("test", 5)
+		require.ErrorIs(t, err, ErrTooLarge)
+		require.Nil(t, data)
+	})
+}
+
+func TestLink(t *testing.T) {
+	cache := NewForTesting(t)
+	dir := t.TempDir()
+	external := filepath.Join(dir, "external")
+	err := os.WriteFile(external, []byte("external"), 0600)
+	require.NoError(t, err)
+
+	_, err = cache.Link("test", filepath.Join(dir, "missing"))
+	require.Error(t, err)
+
+	err = cache.WriteFile("test", []byte("owned"))
+	require.NoError(t, err)
+	_, err = cache.Link("test", external)
+	require.NoError(t, err)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "external", string(data))
+	// The previously committed target was owned by the cache and is removed.
+	require.Equal(t, []string{"", "/.locks", "/.locks/9f", "/.pending", "/9f", "/9f/9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}, list(cache))
+
+	err = cache.PurgeKey("test", 0)
+	require.NoError(t, err)
+	err = cache.WriteFile("test", []byte("owned"))
+	require.NoError(t, err)
+	data, err = os.ReadFile(external)
+	require.NoError(t, err)
+	require.Equal(t, "external", string(data))
+
+	_, err = cache.Link("test", external)
+	require.NoError(t, err)
+	err = cache.Remove("test")
+	require.NoError(t, err)
+	_, err = os.Stat(external)
+	require.NoError(t, err)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, fmt.Errorf("read failed") }
+
+func TestAssembleParts(t *testing.T) {
+	cache := NewForTesting(t)
+	path, err := cache.AssembleParts("test", []io.Reader{
+		strings.NewReader("one "),
+		strings.NewReader("two "),
+		strings.NewReader("three"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, cache.IfExists("test"), path)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "one two three", string(data))
+
+	_, err = cache.AssembleParts("failed", []io.Reader{strings.NewReader("one"), failingReader{}})
+	require.EqualError(t, err, "failed to write part 1: read failed")
+	require.Empty(t, cache.IfExists("failed"))
+	h := cache.Hash("failed")
+	matches, err := filepath.Glob(filepath.Join(cache.root, h[:2], "*"))
+	require.NoError(t, err)
+	require.Empty(t, matches)
+}
+
+func TestGetFresh(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		_, found, err := cache.GetFresh("test", time.Minute)
+		require.NoError(t, err)
+		require.False(t, found)
+
+		err = cache.WriteFile("test", []byte("hello"))
+		require.NoError(t, err)
+		data, found, err := cache.GetFresh("test", time.Minute)
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, "hello", string(data))
+
+		testClock.advance(time.Minute)
+		data, found, err = cache.GetFresh("test", time.Minute)
+		require.NoError(t, err)
+		require.False(t, found)
+		require.Nil(t, data)
+		require.NotEmpty(t, cache.IfExists("test"))
+	})
+}
+
+func TestWriteFrom(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		for _, options := range [][]Option{nil, {WithCompression()}} {
+			cache := newCache(options...)
+			n, err := cache.WriteFrom("test", strings.NewReader("hello world"))
+			require.NoError(t, err)
+			require.Equal(t, int64(11), n)
+			data, err := cache.ReadFile("test")
+			require.NoError(t, err)
+			require.Equal(t, "hello world", string(data))
+
+			_, err = cache.WriteFrom("failed", io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrUnexpectedEOF)))
+			require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+			require.Empty(t, cache.IfExists("failed"))
+			pending, err := cache.PendingTransactions()
+			require.NoError(t, err)
+			require.Empty(t, pending)
+
+			require.Panics(t, func() {
+				_, _ = cache.WriteFrom("panicked", io.MultiReader(strings.NewReader("partial"), panicReader{}))
+			})
+			require.Empty(t, cache.IfExists("panicked"))
+			pending, err = cache.PendingTransactions()
+			require.NoError(t, err)
+			require.Empty(t, pending)
+		}
+	})
+}
+
+// panicReader panics when read.
+type panicReader struct{}
+
+func (panicReader) Read([]byte) (int, error) { panic("read failed") }
+
+func TestWithTransaction(t *testing.T) {
+	cache := NewForTesting(t)
+	path, err := cache.WithTransaction("test", func(w *os.File) error {
+		_, err := w.WriteString("hello")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, cache.IfExists("test"), path)
+
+	_, err = cache.WithTransaction("failed", func(w *os.File) error {
+		return fmt.Errorf("write failed")
+	})
+	require.EqualError(t, err, "write failed")
+	require.Empty(t, cache.IfExists("failed"))
+
+	require.PanicsWithValue(t, "boom", func() {
+		_, _ = cache.WithTransaction("panicked", func(w *os.File) error {
+			_, _ = w.WriteString("partial")
+			panic("boom")
+		})
+	})
+	require.Empty(t, cache.IfExists("panicked"))
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestWithDir(t *testing.T) {
+	cache := NewForTesting(t)
+	path, err := cache.WithDir("test", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0600)
+	})
 	require.NoError(t, err)
-	for _, text := range texts[:2] {
-		// first two entries should have been purged
-		require.Empty(t, cache.IfExists(text))
+	require.Equal(t, cache.IfExists("test"), path)
+	data, err := os.ReadFile(filepath.Join(path, "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	_, err = cache.WithDir("failed", func(dir string) error {
+		return fmt.Errorf("extract failed")
+	})
+	require.EqualError(t, err, "extract failed")
+	require.Empty(t, cache.IfExists("failed"))
+
+	require.PanicsWithValue(t, "boom", func() {
+		_, _ = cache.WithDir("panicked", func(dir string) error {
+			_ = os.WriteFile(filepath.Join(dir, "partial"), nil, 0600)
+			panic("boom")
+		})
+	})
+	require.Empty(t, cache.IfExists("panicked"))
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestTargetFormat(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+
+	format := func(hash string, created time.Time) string {
+		return fmt.Sprintf("%d-%s", created.Unix(), hash)
 	}
-	for _, text := range texts[2:] {
-		// last two entries should still exist
-		require.NotEmpty(t, cache.IfExists(text))
+	parse := func(name string) (string, time.Time, error) {
+		var (
+			ts   int64
+			hash string
+		)
+		if _, err := fmt.Sscanf(name, "%d-%s", &ts, &hash); err != nil {
+			return "", time.Time{}, err
+		}
+		return hash, time.Unix(ts, 0), nil
 	}
+	cache := NewForTesting(t, WithClock(testClock), WithTargetFormat(format, parse))
+	tx, f, err := cache.CreateWithContentType("test", "text/plain")
+	require.NoError(t, err)
+	_, err = f.WriteString("hello")
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	h := cache.Hash("test")
+	target, err := os.Readlink(cache.IfExists("test"))
+	require.NoError(t, err)
+	require.Regexp(t, `^\d+-`+h+`$`, filepath.Base(target))
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	meta, err := cache.GetMeta("test")
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", meta.ContentType)
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	err = cache.Purge(time.Hour)
+	require.NoError(t, err)
+	require.NotEmpty(t, cache.IfExists("test"))
+	testClock.advance(2 * time.Hour)
+	err = cache.Purge(time.Hour)
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("test"))
+	require.Equal(t, []string{"", "/.locks", "/.locks/9f", "/.meta", "/.pending", "/9f"}, list(cache))
 }
 
-func TestPurgeKey(t *testing.T) {
-	globalClock := clock
-	testClock := &fakeClock{currentTime: time.Now()}
-	clock = testClock
-	defer func() { clock = globalClock }()
+// readlinkHookFS calls hook once, after the next Readlink resolves.
+type readlinkHookFS struct {
+	FS
+	hook func()
+}
+
+func (f *readlinkHookFS) Readlink(name string) (string, error) {
+	target, err := f.FS.Readlink(name)
+	if hook := f.hook; hook != nil {
+		f.hook = nil
+		hook()
+	}
+	return target, err
+}
 
+func TestReadDuringPurge(t *testing.T) {
+	fsys := &readlinkHookFS{FS: OSFS{}}
+	cache := NewForTesting(t, WithFS(fsys), WithPurgeSafetyWindow(0))
+	err := cache.WriteFile("test", []byte("hello"))
+	require.NoError(t, err)
+
+	// The target is replaced between resolving and opening it.
+	fsys.hook = func() { require.NoError(t, cache.WriteFile("test", []byte("world"))) }
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "world", string(data))
+
+	// The entry is removed between resolving and opening it.
+	fsys.hook = func() { require.NoError(t, cache.Remove("test")) }
+	_, err = cache.ReadFile("test")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCreateOrRead(t *testing.T) {
 	cache := NewForTesting(t)
-	err := cache.WriteFile("hello", []byte("hello"))
+	tx, f, err := cache.CreateOrRead("test")
+	require.NoError(t, err)
+	require.True(t, tx.Valid())
+	_, err = f.WriteString("hello")
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
 	require.NoError(t, err)
 
-	err = cache.PurgeKey("hello", 5*time.Second)
+	tx, f, err = cache.CreateOrRead("test")
+	require.NoError(t, err)
+	require.False(t, tx.Valid())
+	data, err := io.ReadAll(f)
+	_ = f.Close()
 	require.NoError(t, err)
-	// entry should still exist
-	require.NotEmpty(t, cache.IfExists("hello"))
+	require.Equal(t, "hello", string(data))
+}
 
-	err = cache.PurgeKey("hello", 0*time.Second)
+// unreadableFS is an FS on which partition directories can't be read.
+type unreadableFS struct{ FS }
+
+func (unreadableFS) Readlink(name string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrPermission}
+}
+
+func TestCreateOrReadUnreadablePartition(t *testing.T) {
+	cache := NewForTesting(t, WithFS(unreadableFS{OSFS{}}))
+	_, _, err := cache.CreateOrRead("test")
+	require.ErrorIs(t, err, os.ErrPermission)
+	pending, err := cache.PendingTransactions()
 	require.NoError(t, err)
-	// entry should be gone
-	require.Empty(t, cache.IfExists("hello"))
+	require.Empty(t, pending)
 }
 
-func TestPurgeKeyMissingEntry(t *testing.T) {
+func TestReadRange(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		err := cache.WriteFile("test", []byte("hello world"))
+		require.NoError(t, err)
+
+		data, err := cache.ReadRange("test", 3, 5)
+		require.NoError(t, err)
+		require.Equal(t, "lo wo", string(data))
+		data, err = cache.ReadRange("test", 6, 100)
+		require.NoError(t, err)
+		require.Equal(t, "world", string(data))
+		data, err = cache.ReadRange("test", 100, 5)
+		require.NoError(t, err)
+		require.Empty(t, data)
+
+		_, err = cache.ReadRange("test", -1, 5)
+		require.EqualError(t, err, "invalid range: offset -1 and length 5 must not be negative")
+		_, err = cache.ReadRange("missing", 0, 5)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestStat(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		err := cache.WriteFile("file", []byte("hello"))
+		require.NoError(t, err)
+		info, err := cache.Stat("file")
+		require.NoError(t, err)
+		require.Equal(t, int64(5), info.Size())
+		require.False(t, info.IsDir())
+
+		tx, _, err := cache.Mkdir("dir")
+		require.NoError(t, err)
+		_, err = cache.Commit(tx)
+		require.NoError(t, err)
+		info, err = cache.Stat("dir")
+		require.NoError(t, err)
+		require.True(t, info.IsDir())
+
+		_, err = cache.Stat("missing")
+		require.True(t, os.IsNotExist(err))
+		require.ErrorContains(t, err, "stat missing")
+	})
+}
+
+func TestSize(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	err = cache.ReplaceDir("dir", func(dir string) error {
+		if err := os.WriteFile(filepath.Join(dir, "a"), []byte("abc"), 0600); err != nil {
+			return err
+		}
+		if err := os.Mkdir(filepath.Join(dir, "nested"), 0700); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "nested", "b"), []byte("defg"), 0600)
+	})
+	require.NoError(t, err)
+
+	// In-flight transactions are not counted.
+	tx, f, err := cache.Create("in-flight")
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, 100))
+	require.NoError(t, err)
+	_ = f.Close()
+
+	size, err := cache.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(12), size)
+
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	size, err = cache.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(112), size)
+}
+
+func TestClose(t *testing.T) {
+	cache := NewForTesting(t, WithIndex(), WithSoftDelete(time.Millisecond))
+	err := cache.WriteFile("committed", []byte("hello"))
+	require.NoError(t, err)
+	tx, f, err := cache.Create("in-flight")
+	require.NoError(t, err)
+	_ = f.Close()
+	err = cache.Remove("committed")
+	require.NoError(t, err)
+
+	err = cache.Close()
+	require.NoError(t, err)
+	err = cache.Close()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(cache.root, indexFile))
+	require.NoError(t, err)
+
+	_, _, err = cache.Create("other")
+	require.ErrorIs(t, err, ErrClosed)
+	_, _, err = cache.Mkdir("other")
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = cache.Commit(tx)
+	require.ErrorIs(t, err, ErrClosed)
+	err = cache.Remove("committed")
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = cache.Count()
+	require.ErrorIs(t, err, ErrClosed)
+	_, _, err = cache.PurgeBudget(0, 1)
+	require.ErrorIs(t, err, ErrClosed)
+	err = cache.Rollback(tx)
+	require.NoError(t, err)
+}
+
+func TestNewWithOptions(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	root := filepath.Join(t.TempDir(), "cache")
+	cache, err := NewWithOptions(root, WithClock(NewManualClock(now)))
+	require.NoError(t, err)
+	defer cache.Close()
+	err = cache.WriteFile("key", []byte("hello"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(cache.IfExists("key"), root))
+	created, err := cache.EntryTime("key")
+	require.NoError(t, err)
+	require.True(t, now.Equal(created), "%s != %s", now, created)
+}
+
+func TestErrNotFound(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		_, err := cache.Open("missing")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorIs(t, err, os.ErrNotExist)
+		_, err = cache.ReadFile("missing")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorIs(t, err, os.ErrNotExist)
+		_, err = cache.IsDir("missing")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		require.NoError(t, cache.WriteFile("removed", []byte("removed")))
+		require.NoError(t, cache.Remove("removed"))
+		_, err = cache.ReadFile("removed")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestErrNotFoundDanglingLink(t *testing.T) {
 	cache := NewForTesting(t)
-	err := cache.PurgeKey("missing-dir/missing-entry", 0)
+	external := filepath.Join(t.TempDir(), "external")
+	require.NoError(t, os.WriteFile(external, []byte("external"), 0600))
+	_, err := cache.Link("key", external)
 	require.NoError(t, err)
+	require.NoError(t, os.Remove(external))
+
+	// The key exists, so its missing target isn't reported as a missing key.
+	_, err = cache.ReadFile("key")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NotErrorIs(t, err, ErrNotFound)
+	_, err = cache.IsDir("key")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NotErrorIs(t, err, ErrNotFound)
 }
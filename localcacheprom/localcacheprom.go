@@ -0,0 +1,45 @@
+// Package localcacheprom exposes localcache metrics in the Prometheus text exposition format.
+//
+// The format is written directly so that importing this package does not pull
+// the Prometheus client libraries into the dependency graph.
+package localcacheprom
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/alecthomas/localcache"
+)
+
+// Handler returns a http.Handler serving the Cache's metrics.
+//
+//	http.Handle("/metrics", localcacheprom.Handler(cache))
+func Handler(c *localcache.Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, err := c.Size()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		count, err := c.Count()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats := c.Stats()
+		buf := &bytes.Buffer{}
+		writeMetric(buf, "localcache_hits_total", "counter", "Number of lookups that found a committed entry.", stats.Hits)
+		writeMetric(buf, "localcache_misses_total", "counter", "Number of lookups that did not find a committed entry.", stats.Misses)
+		writeMetric(buf, "localcache_writes_total", "counter", "Number of committed transactions.", stats.Writes)
+		writeMetric(buf, "localcache_evictions_total", "counter", "Number of entries removed by purging.", stats.Evictions)
+		writeMetric(buf, "localcache_size_bytes", "gauge", "Total size of committed entries.", size)
+		writeMetric(buf, "localcache_entries", "gauge", "Number of committed entries.", int64(count))
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+func writeMetric(buf *bytes.Buffer, name, kind, help string, value int64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
@@ -0,0 +1,36 @@
+package localcacheprom
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/alecthomas/localcache"
+)
+
+func TestHandler(t *testing.T) {
+	cache := localcache.NewForTesting(t)
+	err := cache.WriteFile("hello", []byte("hello"))
+	require.NoError(t, err)
+	_, err = cache.ReadFile("hello")
+	require.NoError(t, err)
+	_, err = cache.ReadFile("missing")
+	require.Error(t, err)
+
+	w := httptest.NewRecorder()
+	Handler(cache).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, w.Code)
+	body := w.Body.String()
+	for _, line := range []string{
+		"localcache_hits_total 1\n",
+		"localcache_misses_total 1\n",
+		"localcache_writes_total 1\n",
+		"localcache_evictions_total 0\n",
+		"localcache_size_bytes 5\n",
+		"localcache_entries 1\n",
+		"# TYPE localcache_size_bytes gauge\n",
+	} {
+		require.Contains(t, body, line)
+	}
+}
@@ -0,0 +1,112 @@
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Directory under the cache root containing lock files.
+const locksDir = ".locks"
+
+// lockerFS is implemented by FSs that support advisory locks shared between
+// processes.
+type lockerFS interface {
+	// Lock blocks until an exclusive lock is held on the file name, creating
+	// it if necessary, and returns a function that releases the lock.
+	Lock(name string) (unlock func() error, err error)
+}
+
+func (OSFS) Lock(name string) (func() error, error) { return lockFile(name) }
+
+func (s symlinkFallbackFS) Lock(name string) (func() error, error) {
+	l, ok := s.FS.(lockerFS)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+	return l.Lock(name)
+}
+
+// lockPartition takes an advisory lock on the partition containing link,
+// serialising changes to its entries with other processes.
+//
+// This only protects against concurrent processes on the same host, and only
+// if the FS supports locking. Locks are not reentrant, so must not be nested.
+func (c *Cache) lockPartition(link string) (unlock func(), err error) {
+	unlock, err = c.lock(filepath.Base(filepath.Dir(link)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock partition: %w", err)
+	}
+	return unlock, nil
+}
+
+// lockEntry takes the partition lock for a change to the committed entry at
+// link, first recording its pending key in the key index and the change in
+// the index journal, so that neither is lost if the process crashes once
+// the change is made.
+func (c *Cache) lockEntry(link string) (unlock func(), err error) {
+	return c.lockEntries([]string{link})
+}
+
+// lockEntries is like lockEntry, for a change to several committed entries
+// at once. Each partition is locked once, in order, so that concurrent
+// changes to overlapping sets of partitions can't deadlock.
+func (c *Cache) lockEntries(links []string) (unlock func(), err error) {
+	partitions := map[string]string{}
+	for _, link := range links {
+		partitions[filepath.Dir(link)] = link
+	}
+	dirs := make([]string, 0, len(partitions))
+	for dir := range partitions {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	var unlocks []func()
+	unlockPartitions := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, dir := range dirs {
+		unlockPartition, err := c.lockPartition(partitions[dir])
+		if err != nil {
+			unlockPartitions()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlockPartition)
+	}
+	for _, link := range links {
+		if err := c.recordKey(link); err != nil {
+			unlockPartitions()
+			return nil, err
+		}
+	}
+	journaled, err := c.journalEntries(links)
+	if err != nil {
+		unlockPartitions()
+		return nil, err
+	}
+	return func() {
+		journaled()
+		unlockPartitions()
+	}, nil
+}
+
+// lock takes an advisory lock on the lock file name in the locks directory.
+func (c *Cache) lock(name string) (unlock func(), err error) {
+	l, ok := c.fs.(lockerFS)
+	if !ok {
+		return func() {}, nil
+	}
+	dir := filepath.Join(c.root, locksDir)
+	err = c.mkdir(dir)
+	if err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("failed to create locks directory: %w", err)
+	}
+	release, err := l.Lock(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = release() }, nil
+}
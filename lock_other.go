@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package localcache
+
+// Advisory locks are not supported on this platform.
+func lockFile(name string) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package localcache
+
+import (
+	"os"
+	"syscall"
+)
+
+func lockFile(name string) (func() error, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fd := int(f.Fd())
+	for {
+		err = syscall.Flock(fd, syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, &os.PathError{Op: "flock", Path: name, Err: err}
+	}
+	return func() error {
+		_ = syscall.Flock(fd, syscall.LOCK_UN)
+		return f.Close()
+	}, nil
+}
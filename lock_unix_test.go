@@ -0,0 +1,62 @@
+//go:build unix
+
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitLocksPartition(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("key", []byte("old"))
+	require.NoError(t, err)
+
+	// Simulate another process holding the partition lock.
+	link := cache.linkPath("key")
+	unlock, err := lockFile(filepath.Join(cache.root, locksDir, filepath.Base(filepath.Dir(link))))
+	require.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- cache.WriteFile("key", []byte("new")) }()
+	select {
+	case err := <-done:
+		t.Fatalf("commit did not wait for lock: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.NoError(t, cache.AssertContent("key", []byte("old")))
+	require.NoError(t, unlock())
+	require.NoError(t, <-done)
+	require.NoError(t, cache.AssertContent("key", []byte("new")))
+}
+
+func TestConcurrentCommitsAcrossCaches(t *testing.T) {
+	cache := NewForTesting(t)
+	// Separate Caches over the same root stand in for separate processes.
+	other := newCache(cache.root, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := cache
+			if i%2 == 1 {
+				c = other
+			}
+			err := c.WriteFile("key", []byte(fmt.Sprint(i)))
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	_, err := cache.ReadFile("key")
+	require.NoError(t, err)
+	// Only the link and its current target remain.
+	entries, err := os.ReadDir(filepath.Dir(cache.linkPath("key")))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
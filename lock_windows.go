@@ -0,0 +1,33 @@
+package localcache
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const lockfileExclusiveLock = 0x2
+
+func lockFile(name string) (func() error, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	handle := f.Fd()
+	overlapped := &syscall.Overlapped{}
+	r, _, err := procLockFileEx.Call(handle, lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		_ = f.Close()
+		return nil, &os.PathError{Op: "LockFileEx", Path: name, Err: err}
+	}
+	return func() error {
+		_, _, _ = procUnlockFileEx.Call(handle, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+		return f.Close()
+	}, nil
+}
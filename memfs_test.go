@@ -0,0 +1,378 @@
+package localcache
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memFS is an in-memory FS for testing.
+type memFS struct {
+	lock  sync.Mutex
+	nodes map[string]*memNode
+}
+
+var (
+	_ FS   = (*memFS)(nil)
+	_ File = (*memFile)(nil)
+)
+
+type memNode struct {
+	mode    os.FileMode
+	data    []byte
+	target  string
+	modTime time.Time
+}
+
+func newMemFS(dirs ...string) *memFS {
+	m := &memFS{nodes: map[string]*memNode{"/": {mode: fs.ModeDir | 0700}}}
+	for _, dir := range dirs {
+		path := "/"
+		for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+			path = filepath.Join(path, part)
+			m.nodes[path] = &memNode{mode: fs.ModeDir | 0700}
+		}
+	}
+	return m
+}
+
+// resolve symlinks in path, optionally including the final component.
+//
+// Must be called with the lock held.
+func (m *memFS) resolve(op, path string, followLast bool) (string, error) {
+	path = filepath.Clean(path)
+	for i := 0; i < 40; i++ {
+		parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		resolved := "/"
+		restarted := false
+		for j, part := range parts {
+			next := filepath.Join(resolved, part)
+			node, ok := m.nodes[next]
+			last := j == len(parts)-1
+			if ok && node.mode&fs.ModeSymlink != 0 && (!last || followLast) {
+				target := node.target
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(resolved, target)
+				}
+				path = filepath.Join(append([]string{target}, parts[j+1:]...)...)
+				restarted = true
+				break
+			}
+			if !ok && !last {
+				return "", &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+			}
+			resolved = next
+		}
+		if !restarted {
+			return resolved, nil
+		}
+	}
+	return "", &fs.PathError{Op: op, Path: path, Err: fmt.Errorf("too many levels of symbolic links")}
+}
+
+func (m *memFS) lookup(op, name string, followLast bool) (string, *memNode, error) {
+	path, err := m.resolve(op, name, followLast)
+	if err != nil {
+		return "", nil, err
+	}
+	node, ok := m.nodes[path]
+	if !ok {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return path, node, nil
+}
+
+// create a node at name, which must not already exist.
+func (m *memFS) create(op, name string, node *memNode, replace bool) (string, error) {
+	path, err := m.resolve(op, name, false)
+	if err != nil {
+		return "", err
+	}
+	if parent, ok := m.nodes[filepath.Dir(path)]; !ok || !parent.mode.IsDir() {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.nodes[path]; ok && !replace {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	node.modTime = time.Now()
+	m.nodes[path] = node
+	return path, nil
+}
+
+func (m *memFS) children(dir string) []string {
+	var out []string
+	for path := range m.nodes {
+		if path != "/" && filepath.Dir(path) == dir {
+			out = append(out, path)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (m *memFS) Mkdir(name string, perm os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, err := m.create("mkdir", name, &memNode{mode: fs.ModeDir | perm}, false)
+	return err
+}
+
+func (m *memFS) Create(name string) (File, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path, err := m.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if node, ok := m.nodes[path]; ok && node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	_, err = m.create("open", path, &memNode{mode: 0600}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{fs: m, path: path, writable: true}, nil
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path, node, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{fs: m, path: path, reader: bytes.NewReader(append([]byte{}, node.data...))}, nil
+}
+
+func (m *memFS) Symlink(oldname, newname string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, err := m.create("symlink", newname, &memNode{mode: fs.ModeSymlink | 0777, target: oldname}, false)
+	return err
+}
+
+func (m *memFS) Readlink(name string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, node, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fmt.Errorf("invalid argument")}
+	}
+	return node.target, nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	from, node, err := m.lookup("rename", oldpath, false)
+	if err != nil {
+		return err
+	}
+	to, err := m.resolve("rename", newpath, false)
+	if err != nil {
+		return err
+	}
+	if existing, ok := m.nodes[to]; ok && existing.mode.IsDir() && len(m.children(to)) > 0 {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fmt.Errorf("directory not empty")}
+	}
+	delete(m.nodes, from)
+	m.nodes[to] = node
+	for path, child := range m.nodes {
+		if strings.HasPrefix(path, from+"/") {
+			delete(m.nodes, path)
+			m.nodes[to+strings.TrimPrefix(path, from)] = child
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path, _, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if len(m.children(path)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("directory not empty")}
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path, err := m.resolve("removeall", name, false)
+	if err != nil {
+		return nil
+	}
+	delete(m.nodes, path)
+	for child := range m.nodes {
+		if strings.HasPrefix(child, path+"/") {
+			delete(m.nodes, child)
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path, node, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(path), nil
+}
+
+func (m *memFS) Lstat(name string) (os.FileInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path, node, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(path), nil
+}
+
+func (m *memFS) ReadDir(name string) ([]os.DirEntry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path, node, err := m.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	var out []os.DirEntry
+	for _, child := range m.children(path) {
+		out = append(out, fs.FileInfoToDirEntry(m.nodes[child].info(child)))
+	}
+	return out, nil
+}
+
+// Glob only supports patterns in the final path component.
+func (m *memFS) Glob(pattern string) ([]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	dir, base := filepath.Split(pattern)
+	dir = filepath.Clean(dir)
+	path, node, err := m.lookup("glob", dir, true)
+	if err != nil || !node.mode.IsDir() {
+		return nil, nil //nolint:nilerr
+	}
+	var out []string
+	for _, child := range m.children(path) {
+		if ok, err := filepath.Match(base, filepath.Base(child)); err != nil {
+			return nil, err
+		} else if ok {
+			out = append(out, filepath.Join(dir, filepath.Base(child)))
+		}
+	}
+	return out, nil
+}
+
+func (m *memFS) Chmod(name string, mode os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, node, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode.Type() | mode.Perm()
+	return nil
+}
+
+func (m *memFS) Lchown(name string, uid, gid int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, _, err := m.lookup("lchown", name, false)
+	return err
+}
+
+func (m *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, node, err := m.lookup("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	node.modTime = mtime
+	return nil
+}
+
+func (n *memNode) info(path string) os.FileInfo {
+	return &memFileInfo{name: filepath.Base(path), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() interface{}   { return nil }
+
+type memFile struct {
+	fs       *memFS
+	path     string
+	writable bool
+	reader   *bytes.Reader
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrInvalid}
+	}
+	return f.reader.Read(p)
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if !f.writable {
+		return 0, &fs.PathError{Op: "write", Path: f.path, Err: fs.ErrInvalid}
+	}
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	node, ok := f.fs.nodes[f.path]
+	if !ok {
+		return 0, &fs.PathError{Op: "write", Path: f.path, Err: fs.ErrNotExist}
+	}
+	node.data = append(node.data, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.path, Err: fs.ErrInvalid}
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *memFile) Close() error { return nil }
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.lock.Lock()
+	defer f.fs.lock.Unlock()
+	node, ok := f.fs.nodes[f.path]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: f.path, Err: fs.ErrNotExist}
+	}
+	return node.info(f.path), nil
+}
@@ -0,0 +1,114 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConflictPolicy determines how MergeFrom resolves an entry that exists in
+// both caches.
+type ConflictPolicy int
+
+const (
+	// KeepExisting leaves the destination entry in place.
+	KeepExisting ConflictPolicy = iota
+	// Overwrite replaces the destination entry with the source entry.
+	Overwrite
+	// KeepNewest keeps whichever entry has the most recent creation time.
+	KeepNewest
+)
+
+// MergeFrom imports all committed entries from src into the Cache.
+//
+// Entries are matched by the hash of their key, and collisions are resolved
+// according to onConflict. Imported entries keep their original creation
+// time and metadata, and are committed atomically. In-flight Transactions in
+// src are not imported. Entries published in src with Link are linked to
+// the same external target.
+func (c *Cache) MergeFrom(src *Cache, onConflict ConflictPolicy) error {
+	links, err := src.committed()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, link := range links {
+		info, err := src.info(link)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := c.mergeEntry(src, info, onConflict); err != nil {
+			errs = append(errs, fmt.Errorf("failed to merge %s: %w", info.id(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) mergeEntry(src *Cache, info CacheInfo, onConflict ConflictPolicy) error {
+	dest := c.infoLink(info)
+	existing, err := c.info(dest)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	case onConflict == KeepExisting:
+		return nil
+	case onConflict == KeepNewest && !info.Created.After(existing.Created):
+		return nil
+	}
+	err = c.mkdir(filepath.Dir(dest))
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cache partition: %w", err)
+	}
+	srcTarget, err := src.fs.Readlink(info.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read entry: %w", err)
+	}
+	if !src.owns(srcTarget) {
+		c.mergeKey(src, info)
+		return c.swapLink(dest, srcTarget)
+	}
+
+	name := defaultTargetFormat(info.Hash, info.Created)
+	target := filepath.Join(filepath.Dir(dest), c.targetName(info.Hash, info.Created))
+	if _, err := c.fs.Lstat(target); err == nil {
+		// The identical entry has already been imported.
+		return nil
+	}
+	tx := c.txFor(filepath.Join(filepath.Dir(dest), c.tempPrefix+name))
+	err = c.copyEntry(c.fs, c.txPath(tx), src.fs, srcTarget, 0)
+	if err != nil {
+		_ = c.removeTarget(c.txPath(tx))
+		return err
+	}
+	meta, err := src.readMeta(srcTarget)
+	if err != nil {
+		_ = c.removeTarget(c.txPath(tx))
+		return err
+	}
+	if meta != (EntryMeta{}) {
+		if err := c.writeMeta(c.txPath(tx), meta); err != nil {
+			_ = c.removeTarget(c.txPath(tx))
+			return err
+		}
+	}
+	c.mergeKey(src, info)
+	_, err = c.commitOrRollback(tx)
+	return err
+}
+
+// mergeKey records the key of an entry merged from src, if known, so that
+// it is indexed and checked against quotas.
+func (c *Cache) mergeKey(src *Cache, info CacheInfo) {
+	key := info.Key
+	if key == "" {
+		key = src.keyOf(info.Hash)
+	}
+	if key != "" {
+		c.indexKey(key)
+	}
+}
@@ -0,0 +1,63 @@
+package localcache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeFrom(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+
+	tests := []struct {
+		policy   ConflictPolicy
+		expected map[string]string
+	}{
+		{KeepExisting, map[string]string{"older": "dest", "newer": "dest", "only-src": "src", "only-dest": "dest"}},
+		{Overwrite, map[string]string{"older": "src", "newer": "src", "only-src": "src", "only-dest": "dest"}},
+		{KeepNewest, map[string]string{"older": "dest", "newer": "src", "only-src": "src", "only-dest": "dest"}},
+	}
+	for _, test := range tests {
+		src := NewForTesting(t, WithClock(testClock))
+		dest := NewForTesting(t, WithClock(testClock))
+		require.NoError(t, src.WriteFile("older", []byte("src")))
+		require.NoError(t, dest.WriteFile("older", []byte("dest")))
+		require.NoError(t, dest.WriteFile("newer", []byte("dest")))
+		require.NoError(t, src.WriteFile("newer", []byte("src")))
+		require.NoError(t, src.WriteFile("only-src", []byte("src")))
+		require.NoError(t, dest.WriteFile("only-dest", []byte("dest")))
+		tx, f, err := src.Create("in-flight")
+		require.NoError(t, err)
+		_ = f.Close()
+
+		err = dest.MergeFrom(src, test.policy)
+		require.NoError(t, err)
+		for key, expected := range test.expected {
+			data, err := dest.ReadFile(key)
+			require.NoError(t, err)
+			require.Equal(t, expected, string(data), "policy %d, key %q", test.policy, key)
+		}
+		require.Empty(t, dest.IfExists("in-flight"))
+		require.NoError(t, src.Rollback(tx))
+	}
+}
+
+func TestMergeFromCommitFails(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		src := newCache()
+		dest := newCache()
+		require.NoError(t, src.WriteFileTTL("key", []byte("src"), time.Hour))
+
+		require.NoError(t, dest.Close())
+		err := dest.MergeFrom(src, Overwrite)
+		require.ErrorIs(t, err, ErrClosed)
+		pending, err := dest.PendingTransactions()
+		require.NoError(t, err)
+		require.Empty(t, pending)
+		metas, err := dest.fs.Glob(filepath.Join(dest.root, metaDir, "*"))
+		require.NoError(t, err)
+		require.Empty(t, metas)
+	})
+}
@@ -0,0 +1,201 @@
+package localcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory under the cache root containing entry metadata.
+const metaDir = ".meta"
+
+// EntryMeta is metadata for an entry.
+type EntryMeta struct {
+	// Size of the entry's target in bytes.
+	Size int64 `json:"-"`
+	// Created is the time the entry was created, as embedded in its name.
+	Created time.Time `json:"-"`
+
+	// ContentType is the MIME type of the entry, if known.
+	ContentType string `json:"content_type,omitempty"`
+	// TTL is how long after creation the entry expires, if set. NoTTL
+	// indicates the entry never expires, regardless of WithDefaultTTL.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// OriginalSize is the uncompressed size of a compressed entry in bytes.
+	OriginalSize int64 `json:"original_size,omitempty"`
+	// Compression is the algorithm the entry was compressed with by
+	// CreateCompressed, if any.
+	Compression Algo `json:"compression,omitempty"`
+	// SHA256 is the hex SHA-256 of the entry's uncompressed content, as
+	// recorded by WriteFileVerified.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// CreateWithContentType creates a file in the Cache, as with Create,
+// recording its MIME type in the entry's metadata.
+//
+// The content type is used when serving the entry with Handler.
+func (c *Cache) CreateWithContentType(key, contentType string) (Transaction, *os.File, error) {
+	tx, f, err := c.Create(key)
+	if err != nil {
+		return "", nil, err
+	}
+	err = c.updateMeta(c.txPath(tx), func(meta *EntryMeta) { meta.ContentType = contentType })
+	if err != nil {
+		_ = f.Close()
+		_ = c.Rollback(tx)
+		return "", nil, err
+	}
+	return tx, f, nil
+}
+
+// GetMeta returns the metadata for the committed entry for key.
+//
+// Entries created without metadata have a zero EntryMeta.
+func (c *Cache) GetMeta(key string) (EntryMeta, error) {
+	target, err := c.fs.Readlink(c.linkPath(key))
+	if err != nil {
+		return EntryMeta{}, err
+	}
+	info, err := c.fs.Stat(target)
+	if err != nil {
+		return EntryMeta{}, err
+	}
+	return c.entryMeta(target, info)
+}
+
+// OpenWithMeta opens a file or directory in the Cache, returning it along
+// with the entry's metadata.
+func (c *Cache) OpenWithMeta(key string) (*os.File, EntryMeta, error) {
+	target, err := c.fs.Readlink(c.linkPath(key))
+	if err != nil {
+		c.stats.record(err)
+		return nil, EntryMeta{}, err
+	}
+	f, err := c.fs.Open(target)
+	c.stats.record(err)
+	if err != nil {
+		return nil, EntryMeta{}, err
+	}
+	osf, ok := f.(*os.File)
+	if !ok {
+		_ = f.Close()
+		return nil, EntryMeta{}, ErrNotOSFile
+	}
+	info, err := osf.Stat()
+	if err != nil {
+		_ = osf.Close()
+		return nil, EntryMeta{}, err
+	}
+	meta, err := c.entryMeta(target, info)
+	if err != nil {
+		_ = osf.Close()
+		return nil, EntryMeta{}, err
+	}
+	return osf, meta, nil
+}
+
+// entryMeta returns the complete metadata for an entry target.
+func (c *Cache) entryMeta(target string, info os.FileInfo) (EntryMeta, error) {
+	meta, err := c.readMeta(target)
+	if err != nil {
+		return meta, err
+	}
+	meta.Size = info.Size()
+	if c.owns(target) {
+		if meta.Created, err = c.targetTime(target); err != nil {
+			return meta, err
+		}
+	}
+	return meta, nil
+}
+
+// metaPath returns the path of the metadata for an entry target.
+//
+// In-flight and committed targets share metadata.
+func (c *Cache) metaPath(target string) string {
+	return filepath.Join(c.root, metaDir, strings.TrimPrefix(filepath.Base(target), c.tempPrefix))
+}
+
+// writeMeta atomically writes the metadata for an entry target.
+func (c *Cache) writeMeta(target string, meta EntryMeta) error {
+	dir := filepath.Join(c.root, metaDir)
+	err := c.mkdir(dir)
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	path := c.metaPath(target)
+	tmp := fmt.Sprintf("%s.%x", path, c.clock.Now().UnixNano())
+	f, err := c.createFile(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create metadata: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = c.fs.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = c.fs.Remove(tmp)
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// updateMeta atomically applies update to the metadata for an entry target.
+func (c *Cache) updateMeta(target string, update func(meta *EntryMeta)) error {
+	meta, err := c.readMeta(target)
+	if err != nil {
+		return err
+	}
+	update(&meta)
+	return c.writeMeta(target, meta)
+}
+
+// readMeta reads the metadata for an entry target.
+func (c *Cache) readMeta(target string) (EntryMeta, error) {
+	meta := EntryMeta{}
+	f, err := c.fs.Open(c.metaPath(target))
+	if os.IsNotExist(err) {
+		return meta, nil
+	} else if err != nil {
+		return meta, fmt.Errorf("failed to open metadata: %w", err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return meta, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("invalid metadata for %q: %w", target, err)
+	}
+	return meta, nil
+}
+
+// removeTarget removes an entry target along with its metadata.
+//
+// Removal is deferred if the target is referenced via Acquire.
+func (c *Cache) removeTarget(target string) error {
+	if c.refs.deferAction(target, func() { _ = c.removeTarget(target) }) {
+		return nil
+	}
+	err := c.fs.RemoveAll(target)
+	if err != nil {
+		return err
+	}
+	err = c.fs.Remove(c.metaPath(target))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package localcache
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenWithMeta(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Unix(1700000000, 0)}
+
+	cache := NewForTesting(t, WithClock(testClock))
+	// The fake clock advances every time it's read, so the entry's creation
+	// time is the first tick.
+	created := testClock.currentTime.Add(time.Second)
+	tx, f, err := cache.CreateWithContentType("test", "text/plain")
+	require.NoError(t, err)
+	_, err = f.WriteString("hello")
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	f, meta, err := cache.OpenWithMeta("test")
+	require.NoError(t, err)
+	defer f.Close()
+	require.Equal(t, EntryMeta{Size: 5, Created: created, ContentType: "text/plain"}, meta)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	_, _, err = cache.OpenWithMeta("missing")
+	require.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package localcache
+
+import (
+	"os"
+)
+
+// WithDirMode sets the permissions of directories created by the Cache,
+// including the cache root, partitions and directory entries.
+//
+// The mode is applied exactly, regardless of the process umask. The default
+// is 0700.
+func WithDirMode(mode os.FileMode) Option {
+	return func(c *Cache) { c.dirMode = mode }
+}
+
+// WithFileMode sets the permissions of files created by the Cache, including
+// file entries and their metadata.
+//
+// The mode is applied exactly, regardless of the process umask. By default
+// files are created as with os.Create.
+func WithFileMode(mode os.FileMode) Option {
+	return func(c *Cache) { c.fileMode = mode }
+}
+
+// dirPerm returns the permissions for new directories.
+func (c *Cache) dirPerm() os.FileMode {
+	if c.dirMode == 0 {
+		return 0700
+	}
+	return c.dirMode
+}
+
+// mkdir creates a directory with the configured permissions.
+func (c *Cache) mkdir(path string) error {
+	if err := c.fs.Mkdir(path, c.dirPerm()); err != nil {
+		return err
+	}
+	if c.dirMode == 0 {
+		return nil
+	}
+	return c.fs.Chmod(path, c.dirMode)
+}
+
+// createFile creates a file with the configured permissions.
+func (c *Cache) createFile(path string) (File, error) {
+	f, err := c.fs.Create(path)
+	if err != nil || c.fileMode == 0 {
+		return f, err
+	}
+	if err := c.fs.Chmod(path, c.fileMode); err != nil {
+		_ = f.Close()
+		_ = c.fs.Remove(path)
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirAndFileMode(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "cache")
+	cache, err := NewWithOptions(root, WithDirMode(0750), WithFileMode(0640))
+	require.NoError(t, err)
+	defer cache.Close()
+	err = cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	tx, _, err := cache.Mkdir("dir")
+	require.NoError(t, err)
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	for path, mode := range map[string]os.FileMode{
+		root:                                 0750,
+		filepath.Dir(cache.IfExists("file")): 0750,
+		cache.IfExists("file"):               0640,
+		cache.IfExists("dir"):                0750,
+	} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, mode, info.Mode().Perm(), path)
+	}
+
+	cache = NewForTesting(t)
+	err = cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Dir(cache.IfExists("file")))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+}
@@ -0,0 +1,102 @@
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Directory under the cache root containing namespaces.
+const namespacesDir = ".namespaces"
+
+// Namespace returns a Cache rooted at the directory name within the Cache's
+// namespaces directory, creating it if necessary.
+//
+// The namespace is configured with the options of its parent followed by
+// options, so it may override eg. WithDefaultTTL and WithJanitor to apply
+// its own expiry policy. Entries in a namespace are independent of those in
+// its parent and in other namespaces, and are not affected by purging the
+// parent. The namespace is closed when its parent is closed.
+//
+// The namespace shares its parent's WithWriteRateLimit limit, rather than
+// having a limit of its own. Secondary caches set by WithWriteThrough and
+// WithReadFallback are namespaced with the same name, so that entries in
+// different namespaces don't collide in them. Either may be overridden by
+// options.
+//
+// name must be a single path element that does not begin with ".".
+func (c *Cache) Namespace(name string, options ...Option) (*Cache, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("localcache: invalid namespace %q", name)
+	}
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+	root := filepath.Join(c.root, namespacesDir, name)
+	for _, dir := range []string{filepath.Dir(root), root} {
+		if err := c.mkdir(dir); err != nil && !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create namespace %q: %w", name, err)
+		}
+	}
+	inherit, err := c.inheritOption(name)
+	if err != nil {
+		return nil, err
+	}
+	ns := newCache(root, append(append(append([]Option{}, c.options...), inherit), options...))
+	c.namespaces.add(ns)
+	return ns, nil
+}
+
+// inheritOption returns an Option that configures the namespace name to share
+// the Cache's write rate limiter and to use namespaces of its secondaries.
+func (c *Cache) inheritOption(name string) (Option, error) {
+	var secondary, fallback *Cache
+	if c.secondary != nil {
+		ns, err := c.secondary.Namespace(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to namespace write-through cache: %w", err)
+		}
+		secondary = ns
+	}
+	if c.fallback != nil {
+		ns, err := c.fallback.Namespace(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to namespace read fallback cache: %w", err)
+		}
+		fallback = ns
+	}
+	return func(ns *Cache) {
+		ns.rate = c.rate
+		ns.secondary = secondary
+		ns.fallback = fallback
+	}, nil
+}
+
+// namespaces tracks the namespaces of a Cache, so they can be closed with it.
+type namespaces struct {
+	lock   sync.Mutex
+	caches []*Cache
+}
+
+func (n *namespaces) add(c *Cache) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.caches = append(n.caches, c)
+}
+
+// closeNamespaces closes the Cache's namespaces, returning any errors.
+func (c *Cache) closeNamespaces() []error {
+	c.namespaces.lock.Lock()
+	caches := c.namespaces.caches
+	c.namespaces.caches = nil
+	c.namespaces.lock.Unlock()
+	var errs []error
+	for _, ns := range caches {
+		if err := ns.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
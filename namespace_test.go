@@ -0,0 +1,136 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestNamespaceTTL(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := NewManualClock(time.Now())
+		cache := newCache(WithClock(testClock), WithDefaultTTL(time.Minute), WithJanitor(time.Millisecond))
+		thumbnails, err := cache.Namespace("thumbnails", WithDefaultTTL(10*time.Minute))
+		require.NoError(t, err)
+		assets, err := cache.Namespace("assets", WithDefaultTTL(24*time.Hour))
+		require.NoError(t, err)
+		require.NoError(t, thumbnails.WriteFile("thumb", []byte("thumb")))
+		require.NoError(t, assets.WriteFile("asset", []byte("asset")))
+		require.Empty(t, cache.IfExists("thumb"))
+
+		// The parent's TTL does not apply to its namespaces.
+		testClock.Advance(5 * time.Minute)
+		time.Sleep(20 * time.Millisecond)
+		require.NotEmpty(t, thumbnails.IfExists("thumb"))
+
+		testClock.Advance(time.Hour)
+		require.Eventually(t, func() bool { return thumbnails.IfExists("thumb") == "" }, time.Second, time.Millisecond)
+		require.NotEmpty(t, assets.IfExists("asset"))
+
+		testClock.Advance(24 * time.Hour)
+		require.Eventually(t, func() bool { return assets.IfExists("asset") == "" }, time.Second, time.Millisecond)
+
+		require.NoError(t, cache.Close())
+		require.ErrorIs(t, assets.WriteFile("asset", []byte("asset")), ErrClosed)
+	})
+}
+
+func TestNamespaceInvalid(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		for _, name := range []string{"", ".", "..", ".meta", "a/b"} {
+			_, err := cache.Namespace(name)
+			require.Error(t, err, name)
+		}
+		require.NoError(t, cache.Close())
+		_, err := cache.Namespace("ns")
+		require.ErrorIs(t, err, ErrClosed)
+	})
+}
+
+func TestNamespace(t *testing.T) {
+	cache := NewForTesting(t, WithDirMode(0750))
+	ns, err := cache.Namespace("tool-foo")
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(cache.root, namespacesDir, "tool-foo"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	require.NoError(t, cache.WriteFile("key", []byte("parent")))
+	require.NoError(t, ns.WriteFile("key", []byte("namespace")))
+	require.NoError(t, ns.WriteFile("other", []byte("other")))
+	require.NoError(t, ns.AssertContent("key", []byte("namespace")))
+	require.NoError(t, cache.AssertContent("key", []byte("parent")))
+	require.Empty(t, cache.IfExists("other"))
+
+	// Operations on the parent ignore its namespaces.
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+	require.NoError(t, cache.RecoverCommits())
+	require.NoError(t, cache.Purge(0))
+	count, err = ns.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	require.NoError(t, ns.Remove("key"))
+	require.NoError(t, cache.AssertContent("key", []byte("parent")))
+}
+
+func TestNamespaceHexName(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		ns, err := cache.Namespace("cafe")
+		require.NoError(t, err)
+		require.NoError(t, cache.WriteFile("key", []byte("parent")))
+		require.NoError(t, ns.WriteFile("key", []byte("namespace")))
+		require.NoError(t, cache.AssertContent("key", []byte("parent")))
+		require.NoError(t, ns.AssertContent("key", []byte("namespace")))
+
+		// The namespace is not mistaken for one of the parent's partitions.
+		count, err := cache.Count()
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+		require.NoError(t, cache.Clear())
+		require.NoError(t, ns.AssertContent("key", []byte("namespace")))
+	})
+}
+
+func TestNamespaceInheritsSecondaries(t *testing.T) {
+	secondary := NewForTesting(t)
+	fallback := NewForTesting(t)
+	cache := NewForTesting(t, WithWriteThrough(secondary, nil), WithReadFallback(fallback),
+		WithWriteRateLimit(rate.Every(time.Millisecond), 1))
+	a, err := cache.Namespace("a")
+	require.NoError(t, err)
+	b, err := cache.Namespace("b")
+	require.NoError(t, err)
+	require.Same(t, cache.rate, a.rate)
+	require.Same(t, cache.rate, b.rate)
+
+	// Entries with the same key in different namespaces don't collide in the
+	// write-through cache.
+	require.NoError(t, a.WriteFile("key", []byte("a")))
+	require.NoError(t, b.WriteFile("key", []byte("b")))
+	require.Empty(t, secondary.IfExists("key"))
+	secondaryA, err := secondary.Namespace("a")
+	require.NoError(t, err)
+	require.NoError(t, secondaryA.AssertContent("key", []byte("a")))
+	secondaryB, err := secondary.Namespace("b")
+	require.NoError(t, err)
+	require.NoError(t, secondaryB.AssertContent("key", []byte("b")))
+
+	// Reads fall back to the same namespace of the fallback cache.
+	fallbackA, err := fallback.Namespace("a")
+	require.NoError(t, err)
+	require.NoError(t, fallbackA.WriteFile("other", []byte("fallback")))
+	require.NoError(t, a.AssertContent("other", []byte("fallback")))
+	require.Empty(t, b.IfExists("other"))
+}
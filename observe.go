@@ -0,0 +1,105 @@
+package localcache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Op is the kind of operation reported to an observer.
+type Op int
+
+const (
+	// OpHit is a read that found a committed entry.
+	OpHit Op = iota
+	// OpMiss is a read that did not find a committed entry.
+	OpMiss
+	// OpCommit is a committed Transaction.
+	OpCommit
+	// OpRollback is a rolled back Transaction.
+	OpRollback
+	// OpEvict is an entry removed by purging.
+	OpEvict
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpHit:
+		return "hit"
+	case OpMiss:
+		return "miss"
+	case OpCommit:
+		return "commit"
+	case OpRollback:
+		return "rollback"
+	case OpEvict:
+		return "evict"
+	default:
+		return fmt.Sprintf("Op(%d)", int(o))
+	}
+}
+
+// Event describes an operation on a Cache, as reported to WithObserver.
+type Event struct {
+	Op Op
+	// Hash of the entry's key.
+	Hash string
+	// Size in bytes of the entry, if a file. This is zero for misses and
+	// directories.
+	Size int64
+	// Duration of the operation.
+	Duration time.Duration
+}
+
+// WithObserver sets a function called with an Event for each read, commit,
+// rollback and eviction, eg. to record metrics.
+//
+// fn is called synchronously, so it should return quickly, and may be called
+// concurrently.
+func WithObserver(fn func(event Event)) Option {
+	return func(c *Cache) { c.observer = fn }
+}
+
+// observe reports an operation on the entry with hash h that began at start,
+// if an observer is set.
+func (c *Cache) observe(op Op, h string, size int64, start time.Time) {
+	if c.observer == nil {
+		return
+	}
+	c.observer(Event{Op: op, Hash: h, Size: size, Duration: time.Since(start)})
+}
+
+// observeRead reports a read of the entry with hash h that opened f, or
+// failed with err.
+func (c *Cache) observeRead(h string, f File, err error, start time.Time) {
+	if c.observer == nil {
+		return
+	}
+	if err != nil {
+		c.observe(OpMiss, h, 0, start)
+		return
+	}
+	c.observe(OpHit, h, c.fileSize(f), start)
+}
+
+// fileSize returns the size of an open file, or zero if it is a directory or
+// can't be determined.
+func (c *Cache) fileSize(f File) int64 {
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
+
+// observedSize returns the size of the file at path if an observer is set,
+// or zero if it is a directory or can't be determined.
+func (c *Cache) observedSize(path string) int64 {
+	if c.observer == nil {
+		return 0
+	}
+	info, err := c.fs.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
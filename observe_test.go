@@ -0,0 +1,42 @@
+package localcache
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserver(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		events []Event
+	)
+	cache := NewForTesting(t, WithPurgeSafetyWindow(0), WithObserver(func(event Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		event.Duration = 0
+		events = append(events, event)
+	}))
+	require.NoError(t, cache.WriteFile("test", []byte("hello")))
+	_, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	_, err = cache.ReadFile("missing")
+	require.Error(t, err)
+	tx, f, err := cache.Create("rollback")
+	require.NoError(t, err)
+	_, err = f.WriteString("abc")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, cache.Rollback(tx))
+	require.NoError(t, cache.Purge(0))
+
+	require.Equal(t, []Event{
+		{Op: OpCommit, Hash: hash("test"), Size: 5},
+		{Op: OpHit, Hash: hash("test"), Size: 5},
+		{Op: OpMiss, Hash: hash("missing")},
+		{Op: OpRollback, Hash: hash("rollback"), Size: 3},
+		{Op: OpEvict, Hash: hash("test"), Size: 5},
+	}, events)
+	require.Equal(t, "evict", OpEvict.String())
+}
@@ -0,0 +1,50 @@
+package localcache
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+type owner struct {
+	uid, gid int
+}
+
+// WithOwner causes Commit to change the ownership of committed entries,
+// recursively for directories, to uid and gid.
+//
+// This is only supported on Unix, and Commit will fail on other platforms.
+// Changing ownership usually requires privileges.
+func WithOwner(uid, gid int) Option {
+	return func(c *Cache) { c.owner = &owner{uid: uid, gid: gid} }
+}
+
+// chownEntry changes the ownership of the file or directory tree at path
+// to that configured by WithOwner, if any.
+func (c *Cache) chownEntry(path string, depth int) error {
+	if c.owner == nil {
+		return nil
+	}
+	if !ownerSupported {
+		return errOwnerUnsupported
+	}
+	if err := c.fs.Lchown(path, c.owner.uid, c.owner.gid); err != nil {
+		return fmt.Errorf("failed to change ownership: %w", err)
+	}
+	info, err := c.fs.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+	if err := c.checkDepth(path, depth); err != nil {
+		return err
+	}
+	entries, err := c.fs.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := c.chownEntry(filepath.Join(path, entry.Name()), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package localcache
+
+import (
+	"errors"
+)
+
+const ownerSupported = false
+
+var errOwnerUnsupported = errors.New("localcache: WithOwner is not supported on this platform")
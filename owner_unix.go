@@ -0,0 +1,7 @@
+//go:build unix
+
+package localcache
+
+const ownerSupported = true
+
+var errOwnerUnsupported error
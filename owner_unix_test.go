@@ -0,0 +1,32 @@
+//go:build unix
+
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwner(t *testing.T) {
+	// Only root can give files away, so otherwise use our own group.
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 1234, 5678
+	}
+	cache := NewForTesting(t, WithOwner(uid, gid))
+	err := cache.ReplaceDir("test", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file"), []byte("test"), 0600)
+	})
+	require.NoError(t, err)
+	for _, path := range []string{cache.IfExists("test"), filepath.Join(cache.IfExists("test"), "file")} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		stat := info.Sys().(*syscall.Stat_t)
+		require.Equal(t, uid, int(stat.Uid))
+		require.Equal(t, gid, int(stat.Gid))
+	}
+}
@@ -0,0 +1,39 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrPathTooLong is returned when a cache entry's path would exceed the
+// limits of the operating system.
+var ErrPathTooLong = errors.New("localcache: path too long")
+
+const maxNameLength = 255
+
+// maxPathLength is the longest path supported by the operating system.
+func maxPathLength() int {
+	if runtime.GOOS == "windows" {
+		return 260
+	}
+	return 4096
+}
+
+// checkPathLength returns ErrPathTooLong if path, or any of its components,
+// is too long to be created.
+func checkPathLength(path string) error {
+	if len(path) > maxPathLength() {
+		return fmt.Errorf("%w: %q is %d bytes, exceeding the limit of %d; use a shorter cache root, hash or partition depth",
+			ErrPathTooLong, path, len(path), maxPathLength())
+	}
+	for _, name := range strings.Split(path, string(filepath.Separator)) {
+		if len(name) > maxNameLength {
+			return fmt.Errorf("%w: component %q is %d bytes, exceeding the limit of %d; use a shorter hash or temporary prefix",
+				ErrPathTooLong, name, len(name), maxNameLength)
+		}
+	}
+	return nil
+}
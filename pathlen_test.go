@@ -0,0 +1,19 @@
+package localcache
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathTooLong(t *testing.T) {
+	cache := NewForTesting(t, WithTempPrefix(strings.Repeat("x", 200)))
+	_, _, err := cache.Create("test")
+	require.ErrorIs(t, err, ErrPathTooLong)
+	require.Contains(t, err.Error(), "exceeding the limit of 255")
+
+	err = checkPathLength("/" + strings.Repeat("a/", 2049))
+	require.ErrorIs(t, err, ErrPathTooLong)
+	require.Contains(t, err.Error(), "use a shorter cache root")
+}
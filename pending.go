@@ -0,0 +1,76 @@
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// WithTempPrefix prefixes the names of in-flight Transactions, and the
+// temporary symlinks created by Commit, with prefix.
+//
+// This makes uncommitted files easy to identify on disk, eg. ".tmp-". The
+// prefix is removed when a Transaction is committed.
+func WithTempPrefix(prefix string) Option {
+	return func(c *Cache) { c.tempPrefix = prefix }
+}
+
+// tempSeq distinguishes temporary names created at the same clock time.
+var tempSeq int64
+
+// tempName returns the name for a temporary symlink to be renamed over dest.
+//
+// The name is unique even if the clock hasn't advanced since the target
+// was created, so it can't collide with the target's name.
+func (c *Cache) tempName(dest string) string {
+	seq := atomic.AddInt64(&tempSeq, 1)
+	return filepath.Join(filepath.Dir(dest), fmt.Sprintf("%s%s.%x-%d", c.tempPrefix, filepath.Base(dest), c.clock.Now().UnixNano(), seq))
+}
+
+// PendingTransactions returns all in-flight Transactions in the Cache.
+//
+// This includes Transactions that were abandoned without being committed or
+// rolled back, for example due to a crash.
+func (c *Cache) PendingTransactions() ([]Transaction, error) {
+	partitions, err := c.partitions()
+	if err != nil {
+		return nil, err
+	}
+	var out []Transaction
+	for _, partition := range partitions {
+		entries, err := c.fs.Glob(filepath.Join(partition, "*"))
+		if err != nil {
+			return nil, fmt.Errorf("could not list entries in %q: %w", partition, err)
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry)
+			if ext == "" {
+				continue
+			}
+			info, err := c.fs.Lstat(entry)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				continue // Commit's temporary symlink.
+			}
+			name := filepath.Base(entry)
+			if c.tempPrefix != "" {
+				if !strings.HasPrefix(name, c.tempPrefix) {
+					continue
+				}
+			} else if link, _, err := c.parseTarget(entry); err == nil {
+				if target, err := c.fs.Readlink(link); err == nil && target == entry {
+					continue // Committed.
+				}
+			}
+			out = append(out, c.txFor(entry))
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,68 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingTransactions(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("committed", []byte("committed"))
+	require.NoError(t, err)
+	tx, f, err := cache.Create("pending")
+	require.NoError(t, err)
+	_ = f.Close()
+
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Equal(t, []Transaction{tx}, pending)
+
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	pending, err = cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestTempPrefix(t *testing.T) {
+	cache := NewForTesting(t, WithTempPrefix(".tmp-"))
+	tx, f, err := cache.CreateWithContentType("test", "text/plain")
+	require.NoError(t, err)
+	_, err = f.WriteString("hello")
+	require.NoError(t, err)
+	_ = f.Close()
+	require.True(t, strings.HasPrefix(filepath.Base(f.Name()), ".tmp-"))
+	require.True(t, strings.HasPrefix(string(tx), ".tmp-"))
+
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Equal(t, []Transaction{tx}, pending)
+
+	path, err := cache.Commit(tx)
+	require.NoError(t, err)
+	target, err := os.Readlink(path)
+	require.NoError(t, err)
+	require.False(t, strings.HasPrefix(filepath.Base(target), ".tmp-"))
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	meta, err := cache.GetMeta("test")
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", meta.ContentType)
+
+	pending, err = cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	tx, _, err = cache.Mkdir("dir")
+	require.NoError(t, err)
+	err = cache.Rollback(tx)
+	require.NoError(t, err)
+	pending, err = cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
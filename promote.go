@@ -0,0 +1,115 @@
+package localcache
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// PromoteDir moves every file under stageDir into the Cache as its own
+// entry, keyed by keyFn applied to the file's path relative to stageDir.
+//
+// All files are moved into Transactions before any are committed. If
+// staging any file fails, every Transaction in the batch is rolled back and
+// the files are moved back into stageDir. If a commit fails, the remaining
+// Transactions are rolled back in the same way, but entries already
+// committed are kept. stageDir must be on the same filesystem as the Cache.
+//
+// Returns the paths of the committed entries, in the order of the files'
+// relative paths.
+func (c *Cache) PromoteDir(stageDir string, keyFn func(relPath string) string) (paths []string, err error) {
+	files, err := c.stagedFiles(stageDir, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	type staged struct {
+		src string
+		tx  Transaction
+	}
+	var batch []staged
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, s := range batch {
+			_ = c.fs.Rename(c.txPath(s.tx), s.src)
+			_ = c.Rollback(s.tx)
+		}
+	}()
+	keys := map[string]string{}
+	for _, rel := range files {
+		key := keyFn(rel)
+		if other, ok := keys[key]; ok {
+			return nil, fmt.Errorf("%q and %q both map to key %q", other, rel, key)
+		}
+		keys[key] = rel
+		src := filepath.Join(stageDir, rel)
+		tx, err := c.stage(key, src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stage %q: %w", rel, err)
+		}
+		batch = append(batch, staged{src: src, tx: tx})
+	}
+	for len(batch) > 0 {
+		path, err := c.Commit(batch[0].tx)
+		if err != nil {
+			return paths, err
+		}
+		batch = batch[1:]
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// stage moves the file at src into a new Transaction for key, created as
+// with Create.
+func (c *Cache) stage(key, src string) (tx Transaction, err error) {
+	tx, f, err := c.createTx(key, c.kindOverwrite, nil)
+	if err != nil {
+		return "", err
+	}
+	defer c.RollbackOnError(tx, &err)
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	path := c.txPath(tx)
+	if err := c.fs.Rename(src, path); err != nil {
+		return "", err
+	}
+	if c.fileMode != 0 {
+		if err := c.fs.Chmod(path, c.fileMode); err != nil {
+			_ = c.fs.Rename(path, src)
+			return "", err
+		}
+	}
+	return tx, nil
+}
+
+// stagedFiles returns the paths of all regular files under dir, relative to
+// the staging directory.
+func (c *Cache) stagedFiles(dir, rel string, depth int) ([]string, error) {
+	if err := c.checkDepth(dir, depth); err != nil {
+		return nil, err
+	}
+	entries, err := c.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, entry := range entries {
+		name := filepath.Join(rel, entry.Name())
+		if entry.IsDir() {
+			files, err := c.stagedFiles(filepath.Join(dir, entry.Name()), name, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, files...)
+			continue
+		}
+		if entry.Type().IsRegular() {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
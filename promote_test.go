@@ -0,0 +1,74 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func stageFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestPromoteDir(t *testing.T) {
+	files := map[string]string{"a": "one", "b/c": "two", "b/d/e": "three"}
+	keyFn := func(rel string) string { return "build/" + filepath.ToSlash(rel) }
+
+	cache := NewForTesting(t)
+	dir := stageFiles(t, files)
+	paths, err := cache.PromoteDir(dir, keyFn)
+	require.NoError(t, err)
+	require.Len(t, paths, 3)
+	for name, content := range files {
+		data, err := cache.ReadFile(keyFn(name))
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+
+	// The third Transaction can't be created, so the batch is rolled back.
+	cache = NewForTesting(t, WithMaxConcurrentWrites(2), WithFailFastWrites())
+	dir = stageFiles(t, files)
+	_, err = cache.PromoteDir(dir, keyFn)
+	require.ErrorIs(t, err, ErrTooManyWrites)
+	for name, content := range files {
+		require.Empty(t, cache.IfExists(keyFn(name)))
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+	pending, err := cache.PendingTransactions()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestPromoteDirOptions(t *testing.T) {
+	keyFn := func(rel string) string { return rel }
+	cache := NewForTesting(t, WithFileMode(0640), WithDefaultTTL(time.Hour))
+	dir := stageFiles(t, map[string]string{"a": "one"})
+	_, err := cache.PromoteDir(dir, keyFn)
+	require.NoError(t, err)
+	info, err := os.Stat(cache.IfExists("a"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	meta, err := cache.GetMeta("a")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, meta.TTL)
+
+	// Staged files are left in place if the Cache is closed.
+	require.NoError(t, cache.Close())
+	dir = stageFiles(t, map[string]string{"b": "two"})
+	_, err = cache.PromoteDir(dir, keyFn)
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = os.Stat(filepath.Join(dir, "b"))
+	require.NoError(t, err)
+}
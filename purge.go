@@ -0,0 +1,392 @@
+package localcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithMaxClockSkew sets the tolerance for entries timestamped in the future.
+//
+// Entries with timestamps in the future, for example because the system clock
+// was moved backwards, are never considered old enough to purge. With a
+// maximum skew set, entries more than d in the future are instead considered
+// invalid and are purged.
+func WithMaxClockSkew(d time.Duration) Option {
+	return func(c *Cache) { c.skew = d }
+}
+
+// DefaultPurgeSafetyWindow is the default for WithPurgeSafetyWindow.
+const DefaultPurgeSafetyWindow = 5 * time.Second
+
+// WithPurgeSafetyWindow prevents Purge from removing entries, including
+// in-flight Transactions, created less than d ago, regardless of the age
+// requested.
+//
+// This protects writes that are in progress concurrently with a Purge. A
+// window of zero disables the protection.
+func WithPurgeSafetyWindow(d time.Duration) Option {
+	return func(c *Cache) { c.safetyWindow = d }
+}
+
+// inSafetyWindow returns true if entry is too recent to be purged.
+func (c *Cache) inSafetyWindow(entry string) bool {
+	_, created, err := c.parseTarget(entry)
+	if err != nil {
+		return false
+	}
+	age := c.clock.Since(created)
+	return age >= 0 && age < c.safetyWindow
+}
+
+// WithBeforeEvict sets a function called before a committed entry is
+// removed by Remove or any of the Purge methods.
+//
+// If fn returns an error the entry is not removed, and the error is returned
+// alongside those for any other entries that could not be removed.
+func WithBeforeEvict(fn func(info CacheInfo) error) Option {
+	return func(c *Cache) { c.onEvict = fn }
+}
+
+// beforeEvict calls the WithBeforeEvict function, if any, for a committed entry's symlink.
+func (c *Cache) beforeEvict(link string) error {
+	if c.onEvict == nil {
+		return nil
+	}
+	info, err := c.info(link)
+	if err != nil {
+		return err
+	}
+	return c.callOnEvict(info)
+}
+
+func (c *Cache) callOnEvict(info CacheInfo) error {
+	if c.onEvict == nil {
+		return nil
+	}
+	if err := c.onEvict(info); err != nil {
+		return fmt.Errorf("eviction of %q prevented: %w", info.id(), err)
+	}
+	return nil
+}
+
+// evict a committed entry, returning true if it was removed.
+//
+// Entries that have been removed or replaced since info was read are left
+// alone.
+func (c *Cache) evict(info CacheInfo) (bool, error) {
+	target, err := c.fs.Readlink(info.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read entry: %w", err)
+	}
+	if c.owns(target) && !info.Created.IsZero() {
+		created, err := c.targetTime(target)
+		if err != nil || !created.Equal(info.Created) {
+			return false, err
+		}
+	}
+	if err := c.callOnEvict(info); err != nil {
+		return false, err
+	}
+	removed, err := c.removeLinkTo(info.Path, target)
+	if removed {
+		atomic.AddInt64(&c.stats.evictions, 1)
+	}
+	return removed, err
+}
+
+// expired returns true if an entry created at created is older than older.
+func (c *Cache) expired(created time.Time, older time.Duration) bool {
+	age := c.clock.Since(created)
+	if age < 0 {
+		return c.skew > 0 && -age > c.skew
+	}
+	return age >= older
+}
+
+// WithPurgePartitionBatch sets the maximum number of partitions PurgeStep
+// processes per call.
+//
+// If unset, or n is not positive, PurgeStep processes every partition.
+func WithPurgePartitionBatch(n int) Option {
+	return func(c *Cache) { c.purgeBatch = n }
+}
+
+// purgeCursor records the last partition processed by PurgeStep.
+type purgeCursor struct {
+	lock sync.Mutex
+	last string
+}
+
+// PurgeStep is like Purge, but processes at most the number of partitions set
+// by WithPurgePartitionBatch, resuming from where the previous call stopped.
+//
+// This allows purging to be interleaved with other work on filesystems where
+// listing every partition at once is slow. done is true once the final
+// partition has been processed, after which the next call starts again from
+// the first.
+func (c *Cache) PurgeStep(older time.Duration) (done bool, err error) {
+	if err := c.checkOpen(); err != nil {
+		return false, err
+	}
+	partitions, err := c.partitions()
+	if err != nil {
+		return false, err
+	}
+	sort.Strings(partitions)
+	c.purgeCursor.lock.Lock()
+	defer c.purgeCursor.lock.Unlock()
+	start := sort.SearchStrings(partitions, c.purgeCursor.last)
+	if start < len(partitions) && partitions[start] == c.purgeCursor.last {
+		start++
+	}
+	end := len(partitions)
+	if c.purgeBatch > 0 && start+c.purgeBatch < end {
+		end = start + c.purgeBatch
+	}
+	batch := partitions[start:end]
+	if end == len(partitions) {
+		c.purgeCursor.last = ""
+		done = true
+	} else {
+		c.purgeCursor.last = batch[len(batch)-1]
+	}
+	_, err = c.purgePartitions(context.Background(), batch, older)
+	return done, err
+}
+
+// PurgeBudget is like Purge, but removes at most maxRemovals entries,
+// allowing the cost of purging a large Cache to be spread across calls.
+//
+// more is true if there are further entries older than older remaining,
+// including any that could not be removed.
+func (c *Cache) PurgeBudget(older time.Duration, maxRemovals int) (removed int, more bool, err error) {
+	if err := c.checkOpen(); err != nil {
+		return 0, false, err
+	}
+	partitions, err := c.partitions()
+	if err != nil {
+		return 0, false, err
+	}
+	var errs []error
+	for _, partition := range partitions {
+		entries, err := c.fs.Glob(filepath.Join(partition, "*"))
+		if err != nil {
+			return removed, false, fmt.Errorf("could not list entries in %q: %w", partition, err)
+		}
+		for _, entry := range entries {
+			_, ok, err := c.purgeable(entry, older)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !ok || c.inSafetyWindow(entry) {
+				continue
+			}
+			if removed >= maxRemovals {
+				return removed, true, errors.Join(errs...)
+			}
+			ok, err = c.removeEntry(entry, older)
+			if ok {
+				removed++
+			}
+			if err != nil {
+				errs = append(errs, err)
+				more = true
+			}
+		}
+	}
+	return removed, more, errors.Join(errs...)
+}
+
+// PurgeWhere removes every committed entry for which pred returns true,
+// returning the number of entries removed.
+//
+// In-flight Transactions are never considered, and entries removed by others
+// during the purge are skipped. Failure to remove an individual entry does
+// not stop the purge, and all such errors are returned.
+func (c *Cache) PurgeWhere(pred func(info CacheInfo) bool) (int, error) {
+	var matches []CacheInfo
+	err := c.Range(func(info CacheInfo) bool {
+		if pred(info) {
+			matches = append(matches, info)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var errs []error
+	for _, info := range matches {
+		ok, err := c.evict(info)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok {
+			removed++
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// RetainOnly removes every committed entry whose key is not in keys,
+// returning the number of entries removed.
+//
+// Entries are matched by the hash of their key, so the original keys of
+// committed entries need not be known. Failure to remove an individual entry
+// does not stop the purge, and all such errors are returned.
+func (c *Cache) RetainOnly(keys []string) (int, error) {
+	keep := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keep[c.keyHash(key)] = true
+	}
+	return c.PurgeWhere(func(info CacheInfo) bool { return !keep[info.Hash] })
+}
+
+// PurgeToInodes removes the oldest entries until the number of inodes used
+// by the Cache is at most maxInodes, returning the number of entries removed.
+//
+// Inode usage is approximated as one inode for each entry's symlink, its
+// metadata if any, and each file and directory within its target. Inodes
+// used by partition directories, in-flight Transactions and the Cache's own
+// bookkeeping are not counted. Entries published with Link have no age and
+// are never removed. Failure to count or remove an individual entry does not
+// stop the purge, and all such errors are returned. See FreeInodes to
+// determine the pressure on the underlying filesystem.
+func (c *Cache) PurgeToInodes(maxInodes uint64) (int, error) {
+	return c.evictOldest(int64(maxInodes), func(info CacheInfo) (int64, error) {
+		return c.inodes(info)
+	})
+}
+
+// PurgeToSize removes the oldest entries until the total size of the Cache, as
+// reported by Size, is at most maxBytes.
+//
+// Entries are removed in order of creation, oldest first. Entries published
+// with Link have no age and are never removed, though their size is counted.
+// Entries within the purge safety window are not removed either. Failure to
+// remove an individual entry does not stop the purge, and all such errors are
+// returned.
+func (c *Cache) PurgeToSize(maxBytes int64) (int, error) {
+	return c.evictOldest(maxBytes, func(info CacheInfo) (int64, error) {
+		return info.Size, nil
+	})
+}
+
+// evictOldest removes the oldest entries until the total weight of all
+// entries is at most budget, returning the number of entries removed.
+//
+// Entries are removed with removeEntry, as by Purge, so entries within the
+// safety window and entries replaced since they were weighed are kept.
+// Entries removed while being weighed are skipped, and those that otherwise
+// can't be weighed are kept and their errors returned.
+func (c *Cache) evictOldest(budget int64, weigh func(info CacheInfo) (int64, error)) (int, error) {
+	type weighted struct {
+		info   CacheInfo
+		weight int64
+	}
+	var (
+		entries []weighted
+		total   int64
+		errs    []error
+	)
+	err := c.Range(func(info CacheInfo) bool {
+		weight, err := weigh(info)
+		if errors.Is(err, os.ErrNotExist) {
+			return true
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("failed to weigh %q: %w", info.id(), err))
+			return true
+		}
+		total += weight
+		if !info.Created.IsZero() {
+			entries = append(entries, weighted{info, weight})
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].info.Created.Before(entries[j].info.Created) })
+	removed := 0
+	for _, entry := range entries {
+		if total <= budget {
+			break
+		}
+		target, err := c.fs.Readlink(entry.info.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read entry: %w", err))
+			continue
+		}
+		if created, err := c.targetTime(target); err != nil || !created.Equal(entry.info.Created) || c.inSafetyWindow(target) {
+			continue
+		}
+		ok, err := c.removeEntry(target, 0)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok {
+			total -= entry.weight
+			removed++
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// inodes returns the approximate number of inodes used by an entry.
+func (c *Cache) inodes(info CacheInfo) (int64, error) {
+	count := int64(1)
+	target, err := c.fs.Readlink(info.Path)
+	if err != nil {
+		return 0, err
+	}
+	if !c.owns(target) {
+		return count, nil
+	}
+	if _, err := c.fs.Lstat(c.metaPath(target)); err == nil {
+		count++
+	}
+	n, err := c.countNodes(target, 0)
+	if err != nil {
+		return 0, err
+	}
+	return count + n, nil
+}
+
+// countNodes returns the number of files and directories at and under path.
+func (c *Cache) countNodes(path string, depth int) (int64, error) {
+	info, err := c.fs.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	count := int64(1)
+	if !info.IsDir() {
+		return count, nil
+	}
+	if err := c.checkDepth(path, depth); err != nil {
+		return 0, err
+	}
+	entries, err := c.fs.ReadDir(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		n, err := c.countNodes(filepath.Join(path, entry.Name()), depth+1)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
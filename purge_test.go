@@ -0,0 +1,364 @@
+package localcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeClockSkew(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock), WithMaxClockSkew(time.Hour))
+
+		// Write entries while the clock is ahead, then jump it backwards.
+		testClock.advance(time.Minute)
+		err := cache.WriteFile("slightly-future", []byte("data"))
+		require.NoError(t, err)
+		testClock.advance(time.Hour * 24)
+		err = cache.WriteFile("far-future", []byte("data"))
+		require.NoError(t, err)
+		testClock.advance(-time.Hour*24 - time.Minute - 10*time.Second)
+
+		err = cache.Purge(0)
+		require.NoError(t, err)
+		require.NotEmpty(t, cache.IfExists("slightly-future"))
+		require.Empty(t, cache.IfExists("far-future"))
+	})
+}
+
+func TestPurgeWhere(t *testing.T) {
+	cache := NewForTesting(t)
+	sizes := map[string]int{"small": 1, "medium": 10, "large": 100}
+	for key, size := range sizes {
+		err := cache.WriteFile(key, make([]byte, size))
+		require.NoError(t, err)
+	}
+	tx, f, err := cache.Create("in-flight")
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, 1000))
+	require.NoError(t, err)
+	_ = f.Close()
+
+	removed, err := cache.PurgeWhere(func(info CacheInfo) bool { return info.Size > 5 })
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	require.NotEmpty(t, cache.IfExists("small"))
+	require.Empty(t, cache.IfExists("medium"))
+	require.Empty(t, cache.IfExists("large"))
+
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	require.NotEmpty(t, cache.IfExists("in-flight"))
+}
+
+func TestBeforeEvict(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		var cache *Cache
+		cache = newCache(WithPurgeSafetyWindow(0), WithBeforeEvict(func(info CacheInfo) error {
+			if info.Hash == cache.Hash("vetoed") {
+				return fmt.Errorf("in use")
+			}
+			return nil
+		}))
+		for _, key := range []string{"vetoed", "evicted", "removed"} {
+			err := cache.WriteFile(key, []byte(key))
+			require.NoError(t, err)
+		}
+
+		err := cache.Remove("vetoed")
+		require.ErrorContains(t, err, "in use")
+		err = cache.Remove("removed")
+		require.NoError(t, err)
+
+		err = cache.Purge(0)
+		require.ErrorContains(t, err, "in use")
+		require.NotEmpty(t, cache.IfExists("vetoed"))
+		require.Empty(t, cache.IfExists("evicted"))
+		require.Empty(t, cache.IfExists("removed"))
+
+		removed, err := cache.PurgeWhere(func(CacheInfo) bool { return true })
+		require.ErrorContains(t, err, "in use")
+		require.Equal(t, 0, removed)
+		require.NotEmpty(t, cache.IfExists("vetoed"))
+	})
+}
+
+func TestRetainOnly(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		for _, key := range []string{"one", "two", "three", "four"} {
+			err := cache.WriteFile(key, []byte(key))
+			require.NoError(t, err)
+		}
+		removed, err := cache.RetainOnly([]string{"one", "three", "missing"})
+		require.NoError(t, err)
+		require.Equal(t, 2, removed)
+		var remaining []string
+		err = cache.Range(func(info CacheInfo) bool {
+			remaining = append(remaining, info.Hash)
+			return true
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{cache.Hash("one"), cache.Hash("three")}, remaining)
+	})
+}
+
+func TestPurgeBudget(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		for i := 0; i < 5; i++ {
+			err := cache.WriteFile(fmt.Sprintf("old-%d", i), []byte("data"))
+			require.NoError(t, err)
+		}
+		testClock.advance(time.Hour)
+		err := cache.WriteFile("new", []byte("data"))
+		require.NoError(t, err)
+
+		removed, more, err := cache.PurgeBudget(time.Minute, 2)
+		require.NoError(t, err)
+		require.Equal(t, 2, removed)
+		require.True(t, more)
+		removed, more, err = cache.PurgeBudget(time.Minute, 2)
+		require.NoError(t, err)
+		require.Equal(t, 2, removed)
+		require.True(t, more)
+		removed, more, err = cache.PurgeBudget(time.Minute, 2)
+		require.NoError(t, err)
+		require.Equal(t, 1, removed)
+		require.False(t, more)
+
+		count, err := cache.Count()
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+		require.NotEmpty(t, cache.IfExists("new"))
+	})
+}
+
+func TestPurgeSafetyWindow(t *testing.T) {
+	cache := NewForTesting(t)
+	tx, f, err := cache.Create("in-flight")
+	require.NoError(t, err)
+	_, err = f.WriteString("data")
+	require.NoError(t, err)
+	_ = f.Close()
+	err = cache.WriteFile("committed", []byte("data"))
+	require.NoError(t, err)
+
+	err = cache.Purge(0)
+	require.NoError(t, err)
+	require.NotEmpty(t, cache.IfExists("committed"))
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	require.NotEmpty(t, cache.IfExists("in-flight"))
+
+	cache = NewForTesting(t, WithPurgeSafetyWindow(0))
+	err = cache.WriteFile("committed", []byte("data"))
+	require.NoError(t, err)
+	err = cache.Purge(0)
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("committed"))
+}
+
+func TestPurgeToSize(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		for _, key := range []string{"oldest", "older", "newer", "newest"} {
+			err := cache.WriteFile(key, make([]byte, 10))
+			require.NoError(t, err)
+			testClock.advance(time.Minute)
+		}
+
+		removed, err := cache.PurgeToSize(25)
+		require.NoError(t, err)
+		require.Equal(t, 2, removed)
+		size, err := cache.Size()
+		require.NoError(t, err)
+		require.Equal(t, int64(20), size)
+		require.Empty(t, cache.IfExists("oldest"))
+		require.Empty(t, cache.IfExists("older"))
+		require.NotEmpty(t, cache.IfExists("newer"))
+		require.NotEmpty(t, cache.IfExists("newest"))
+
+		removed, err = cache.PurgeToSize(20)
+		require.NoError(t, err)
+		require.Equal(t, 0, removed)
+		require.NotEmpty(t, cache.IfExists("newer"))
+	})
+}
+
+func TestPurgeToSizeWeighErrors(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		for _, key := range []string{"oldest", "vanished", "unweighable", "newest"} {
+			err := cache.WriteFile(key, make([]byte, 10))
+			require.NoError(t, err)
+			testClock.advance(time.Minute)
+		}
+
+		// Neither a vanished nor an unweighable entry stops the others being
+		// evicted.
+		weighErr := errors.New("weigh failed")
+		removed, err := cache.evictOldest(10, func(info CacheInfo) (int64, error) {
+			switch info.Hash {
+			case cache.Hash("vanished"):
+				return 0, os.ErrNotExist
+			case cache.Hash("unweighable"):
+				return 0, weighErr
+			}
+			return info.Size, nil
+		})
+		require.ErrorIs(t, err, weighErr)
+		require.NotErrorIs(t, err, os.ErrNotExist)
+		require.Equal(t, 1, removed)
+		require.Empty(t, cache.IfExists("oldest"))
+		require.NotEmpty(t, cache.IfExists("vanished"))
+		require.NotEmpty(t, cache.IfExists("unweighable"))
+		require.NotEmpty(t, cache.IfExists("newest"))
+	})
+}
+
+func TestPurgeToSizeSafetyWindow(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+		cache := newCache(WithClock(testClock), WithPurgeSafetyWindow(time.Minute))
+		require.NoError(t, cache.WriteFile("old", make([]byte, 10)))
+		testClock.advance(2 * time.Minute)
+		require.NoError(t, cache.WriteFile("recent", make([]byte, 10)))
+
+		removed, err := cache.PurgeToSize(0)
+		require.NoError(t, err)
+		require.Equal(t, 1, removed)
+		require.Empty(t, cache.IfExists("old"))
+		require.NotEmpty(t, cache.IfExists("recent"))
+	})
+}
+
+func TestPurgeContext(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+		cache := newCache(WithClock(testClock))
+		err := cache.WriteFile("test", []byte("data"))
+		require.NoError(t, err)
+		testClock.advance(time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = cache.PurgeContext(ctx, time.Minute)
+		require.ErrorIs(t, err, context.Canceled)
+		require.NotEmpty(t, cache.IfExists("test"))
+
+		err = cache.PurgeContext(context.Background(), time.Minute)
+		require.NoError(t, err)
+		require.Empty(t, cache.IfExists("test"))
+	})
+}
+
+func TestPurgeStep(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+		cache := newCache(WithClock(testClock), WithPurgePartitionBatch(2))
+		var old, recent []string
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("old-%d", i)
+			old = append(old, key)
+			require.NoError(t, cache.WriteFile(key, []byte(key)))
+		}
+		testClock.advance(time.Hour)
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("recent-%d", i)
+			recent = append(recent, key)
+			require.NoError(t, cache.WriteFile(key, []byte(key)))
+		}
+		partitions, err := cache.partitions()
+		require.NoError(t, err)
+
+		steps := 0
+		for done := false; !done; steps++ {
+			done, err = cache.PurgeStep(time.Minute)
+			require.NoError(t, err)
+		}
+		require.Equal(t, (len(partitions)+1)/2, steps)
+		for _, key := range old {
+			require.Empty(t, cache.IfExists(key), key)
+		}
+		for _, key := range recent {
+			require.NotEmpty(t, cache.IfExists(key), key)
+		}
+	})
+}
+
+func TestPurgeKeepsCommittedEntry(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+	cache := NewForTesting(t, WithClock(testClock))
+	// An abandoned Transaction for a key that is later committed.
+	_, f, err := cache.Create("test")
+	require.NoError(t, err)
+	_ = f.Close()
+	testClock.advance(time.Hour)
+	err = cache.WriteFile("test", []byte("committed"))
+	require.NoError(t, err)
+
+	removed, err := cache.PurgeN(30 * time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "committed", string(data))
+}
+
+func TestPurgeWhereReplaced(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+		cache := newCache(WithClock(testClock))
+		err := cache.WriteFile("test", []byte("old"))
+		require.NoError(t, err)
+
+		// The entry is replaced after it was matched, so must be kept.
+		removed, err := cache.PurgeWhere(func(info CacheInfo) bool {
+			testClock.advance(time.Second)
+			require.NoError(t, cache.WriteFile("test", []byte("new")))
+			return true
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, removed)
+		data, err := cache.ReadFile("test")
+		require.NoError(t, err)
+		require.Equal(t, "new", string(data))
+	})
+}
+
+func TestPurgeWhereSkipsRemoved(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		keys := []string{"a", "b", "c"}
+		for _, key := range keys {
+			require.NoError(t, cache.WriteFile(key, []byte(key)))
+		}
+		calls := 0
+		removed, err := cache.PurgeWhere(func(info CacheInfo) bool {
+			calls++
+			if calls == len(keys) {
+				// Every matched entry is removed before it can be purged.
+				for _, key := range keys {
+					require.NoError(t, cache.Remove(key))
+				}
+			}
+			return true
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, removed)
+	})
+}
@@ -0,0 +1,84 @@
+package localcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Pusher is a destination that committed entries can be replicated to with
+// Push.
+type Pusher interface {
+	// Has returns true if the destination already has content with the given
+	// hex SHA-256 hash for key.
+	Has(key, hash string) (bool, error)
+	// Put stores the content read from r for key.
+	Put(key string, r io.Reader) error
+}
+
+// Push replicates the committed file entries of the Cache to dst, skipping
+// entries dst already has.
+//
+// Entries are identified by their original key if known, or otherwise their
+// hash, and their content is hashed with SHA-256 after any decompression.
+// Content is streamed rather than loaded into memory. ctx is checked between
+// entries, and its error is returned if it is done.
+//
+// Directory entries can't be pushed. They are skipped and reported in the
+// returned error, along with any entries that failed to push, without
+// stopping the push.
+func (c *Cache) Push(ctx context.Context, dst Pusher) error {
+	var infos []CacheInfo
+	err := c.Range(func(info CacheInfo) bool {
+		infos = append(infos, info)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, info := range infos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.push(dst, info); err != nil {
+			errs = append(errs, fmt.Errorf("failed to push %q: %w", info.id(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) push(dst Pusher, info CacheInfo) error {
+	if info.IsDir {
+		return errors.New("directory entries can't be pushed")
+	}
+	sum, err := c.contentHash(info.Path)
+	if err != nil {
+		return err
+	}
+	has, err := dst.Has(info.id(), sum)
+	if err != nil || has {
+		return err
+	}
+	r, err := c.openLink(info.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Put(info.id(), r)
+}
+
+// openLink opens the committed entry at link for reading, decompressing it
+// if necessary.
+func (c *Cache) openLink(link string) (io.ReadCloser, error) {
+	target, err := c.fs.Readlink(link)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.fs.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	return c.entryReader(f, target)
+}
@@ -0,0 +1,59 @@
+package localcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakePusher struct {
+	content map[string]string
+	puts    []string
+}
+
+func (f *fakePusher) Has(key, hash string) (bool, error) {
+	content, ok := f.content[key]
+	return ok && fmt.Sprintf("%x", sha256.Sum256([]byte(content))) == hash, nil
+}
+
+func (f *fakePusher) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.content[key] = string(data)
+	f.puts = append(f.puts, key)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		for _, key := range []string{"same", "modified", "added"} {
+			require.NoError(t, cache.WriteFile(key, []byte(key)))
+		}
+		dst := &fakePusher{content: map[string]string{
+			cache.Hash("same"):     "same",
+			cache.Hash("modified"): "original",
+		}}
+		err := cache.Push(context.Background(), dst)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{cache.Hash("modified"), cache.Hash("added")}, dst.puts)
+		require.Equal(t, "modified", dst.content[cache.Hash("modified")])
+		require.Equal(t, "added", dst.content[cache.Hash("added")])
+
+		dst.puts = nil
+		err = cache.Push(context.Background(), dst)
+		require.NoError(t, err)
+		require.Empty(t, dst.puts)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = cache.Push(ctx, &fakePusher{content: map[string]string{}})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
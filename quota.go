@@ -0,0 +1,132 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrQuotaExceeded is returned by Commit when committing an entry would
+// exceed the quota set by SetQuota for a prefix of its key.
+var ErrQuotaExceeded = errors.New("localcache: quota exceeded")
+
+// SetQuota limits the total size of committed entries with keys beginning
+// with prefix to maxBytes, replacing any existing quota for prefix.
+//
+// Commit returns ErrQuotaExceeded for Transactions that would exceed the
+// quota, leaving them in-flight to be rolled back. A negative maxBytes
+// removes the quota. Quotas rely on the index to attribute entries to keys,
+// so require WithIndex, and entries whose keys are unknown to the index are
+// neither counted nor checked.
+//
+// Quotas are also checked when entries are copied into the Cache by
+// MergeFrom, WithWriteThrough and WithReadFallback, if the source Cache
+// knows their keys. Entries published with Link are not checked.
+func (c *Cache) SetQuota(prefix string, maxBytes int64) {
+	c.quotaLock.Lock()
+	defer c.quotaLock.Unlock()
+	if maxBytes < 0 {
+		delete(c.quotas, prefix)
+		return
+	}
+	if c.quotas == nil {
+		c.quotas = map[string]int64{}
+	}
+	c.quotas[prefix] = maxBytes
+}
+
+// checkQuota checks that committing the Transaction at path, for the hash h,
+// will not exceed any quotas, reserving its size against them if not.
+//
+// The returned release function must be called once the commit has
+// finished, whether or not it succeeded.
+func (c *Cache) checkQuota(path, h string) (release func(), err error) {
+	c.quotaLock.Lock()
+	quotas := make(map[string]int64, len(c.quotas))
+	for prefix, max := range c.quotas {
+		quotas[prefix] = max
+	}
+	c.quotaLock.Unlock()
+	if len(quotas) == 0 {
+		return func() {}, nil
+	}
+	if c.index == nil {
+		return nil, fmt.Errorf("localcache: quotas require WithIndex")
+	}
+	key, ok := c.keyNames.lookup(h)
+	if !ok {
+		return func() {}, nil
+	}
+	size, err := c.entrySize(path)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		prefixes []string
+		qerr     error
+	)
+	err = c.withIndex(func(idx *keyIndex) {
+		for prefix, max := range quotas {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			used := idx.quotaUsage(prefix) + idx.reserved[prefix] + size
+			if existing := idx.entries[h]; existing.key != "" {
+				// Replacing an entry only counts the new size.
+				used -= existing.size
+			}
+			if used > max {
+				qerr = fmt.Errorf("%w: committing %q would use %d bytes of the %d byte quota for %q", ErrQuotaExceeded, key, used, max, prefix)
+				return
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		if idx.reserved == nil {
+			idx.reserved = map[string]int64{}
+		}
+		for _, prefix := range prefixes {
+			idx.reserved[prefix] += size
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qerr != nil {
+		return nil, qerr
+	}
+	return func() {
+		_ = c.withIndex(func(idx *keyIndex) {
+			for _, prefix := range prefixes {
+				idx.reserved[prefix] -= size
+			}
+		})
+	}, nil
+}
+
+// quotaUsage returns the total size of the entries in the index with keys
+// beginning with prefix.
+func (idx *keyIndex) quotaUsage(prefix string) int64 {
+	if used, ok := idx.usage[prefix]; ok {
+		return used
+	}
+	var used int64
+	for _, entry := range idx.entries {
+		if entry.key != "" && strings.HasPrefix(entry.key, prefix) {
+			used += entry.size
+		}
+	}
+	idx.usage[prefix] = used
+	return used
+}
+
+// account adds delta to the usage of every quota prefix of entry's key.
+func (idx *keyIndex) account(entry indexEntry, delta int64) {
+	if entry.key == "" {
+		return
+	}
+	for prefix := range idx.usage {
+		if strings.HasPrefix(entry.key, prefix) {
+			idx.usage[prefix] += delta
+		}
+	}
+}
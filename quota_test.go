@@ -0,0 +1,100 @@
+package localcache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache(WithIndex())
+		cache.SetQuota("tenant-a/", 10)
+
+		err := cache.WriteFile("tenant-a/one", []byte("123456"))
+		require.NoError(t, err)
+		err = cache.WriteFile("tenant-a/two", []byte("123456"))
+		require.ErrorIs(t, err, ErrQuotaExceeded)
+		require.Empty(t, cache.IfExists("tenant-a/two"))
+		pending, err := cache.PendingTransactions()
+		require.NoError(t, err)
+		require.Empty(t, pending)
+
+		// Replacing an entry only counts the new size.
+		err = cache.WriteFile("tenant-a/one", []byte("1234567890"))
+		require.NoError(t, err)
+
+		err = cache.WriteFile("tenant-b/one", make([]byte, 100))
+		require.NoError(t, err)
+
+		cache.SetQuota("tenant-a/", -1)
+		err = cache.WriteFile("tenant-a/two", []byte("123456"))
+		require.NoError(t, err)
+	})
+}
+
+func TestQuotaRollsBackOnce(t *testing.T) {
+	var (
+		lock      sync.Mutex
+		rollbacks int
+	)
+	cache := NewForTesting(t, WithIndex(), WithObserver(func(event Event) {
+		if event.Op == OpRollback {
+			lock.Lock()
+			rollbacks++
+			lock.Unlock()
+		}
+	}))
+	cache.SetQuota("a/", 5)
+	require.ErrorIs(t, cache.WriteFile("a/one", []byte("123456")), ErrQuotaExceeded)
+	require.Equal(t, 1, rollbacks)
+
+	// The Transaction is left for the caller to roll back.
+	tx, f, err := cache.Create("a/two")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("123456"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = cache.Commit(tx)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.Equal(t, 1, rollbacks)
+	require.NoError(t, cache.Rollback(tx))
+	require.Equal(t, 2, rollbacks)
+}
+
+func TestQuotaConcurrent(t *testing.T) {
+	cache := NewForTesting(t, WithIndex())
+	cache.SetQuota("a/", 10)
+	var (
+		wg        sync.WaitGroup
+		committed int64
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := cache.WriteFile(fmt.Sprintf("a/%d", i), []byte("1234")); err == nil {
+				atomic.AddInt64(&committed, 1)
+			} else {
+				require.ErrorIs(t, err, ErrQuotaExceeded)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int64(2), committed)
+}
+
+func TestQuotaMerge(t *testing.T) {
+	src := NewForTesting(t, WithIndex())
+	require.NoError(t, src.WriteFile("a/one", []byte("123456")))
+	require.NoError(t, src.WriteFile("a/two", []byte("123456")))
+	cache := NewForTesting(t, WithIndex())
+	cache.SetQuota("a/", 10)
+	require.ErrorIs(t, cache.MergeFrom(src, Overwrite), ErrQuotaExceeded)
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+}
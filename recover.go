@@ -0,0 +1,147 @@
+package localcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Directory under the cache root containing markers for in-progress commits.
+const pendingDir = ".pending"
+
+// commitIntent is written before a commit swaps its symlink into place.
+type commitIntent struct {
+	// Symlink is the temporary symlink that is renamed over Dest.
+	Symlink string `json:"symlink"`
+	// Dest is the final committed symlink.
+	Dest string `json:"dest"`
+	// Target of the new symlink.
+	Target string `json:"target"`
+	// Old is the previous target of Dest, if any.
+	Old string `json:"old,omitempty"`
+	// Batch contains the commits of several entries that are committed
+	// together, in which case the other fields are empty.
+	Batch []commitIntent `json:"batch,omitempty"`
+}
+
+// WithAutoRecover runs RecoverCommits when the Cache is opened with New.
+func WithAutoRecover() Option {
+	return func(c *Cache) { c.autoRecover = true }
+}
+
+// writeIntent records intent, returning the path of the marker.
+func (c *Cache) writeIntent(intent commitIntent) (string, error) {
+	dir := filepath.Join(c.root, pendingDir)
+	err := c.mkdir(dir)
+	if err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("failed to create pending commit directory: %w", err)
+	}
+	data, err := json.Marshal(intent)
+	if err != nil {
+		return "", err
+	}
+	name := intent.Symlink
+	for _, entry := range intent.Batch {
+		if name == "" {
+			name = entry.Symlink
+		}
+	}
+	if name == "" {
+		// A batch of removals is named as if it had a temporary symlink.
+		name = c.tempName(intent.Batch[0].Dest)
+	}
+	marker := filepath.Join(dir, filepath.Base(name))
+	f, err := c.createFile(marker)
+	if err != nil {
+		return "", fmt.Errorf("failed to create commit marker: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = c.fs.Remove(marker)
+		return "", fmt.Errorf("failed to write commit marker: %w", err)
+	}
+	return marker, nil
+}
+
+// RecoverCommits completes or cleans up commits that were interrupted, for
+// example by the process crashing.
+//
+// A commit that had created its temporary symlink is completed, while a
+// commit that had not yet done so is abandoned, leaving its Transaction to
+// be purged. A commit of several entries at once, eg. by WriteFiles, is
+// always completed. This should be run when no other process is using the Cache.
+func (c *Cache) RecoverCommits() error {
+	markers, err := c.fs.Glob(filepath.Join(c.root, pendingDir, "*"))
+	if err != nil {
+		return fmt.Errorf("could not list pending commits: %w", err)
+	}
+	var errs []error
+	for _, marker := range markers {
+		if err := c.recoverCommit(marker); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) recoverCommit(marker string) error {
+	f, err := c.fs.Open(marker)
+	if err != nil {
+		return fmt.Errorf("failed to open commit marker: %w", err)
+	}
+	data, err := ioutil.ReadAll(f)
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read commit marker: %w", err)
+	}
+	intent := commitIntent{}
+	if err := json.Unmarshal(data, &intent); err != nil {
+		// The marker was only partially written, so the commit never began.
+		return c.fs.Remove(marker)
+	}
+	if len(intent.Batch) == 0 {
+		intent.Batch = []commitIntent{intent}
+	}
+	var errs []error
+	for _, intent := range intent.Batch {
+		if err := c.recoverIntent(intent); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return c.fs.Remove(marker)
+}
+
+// recoverIntent completes the commit of a single entry, if it had created its
+// temporary symlink, or its removal as part of a batch.
+func (c *Cache) recoverIntent(intent commitIntent) error {
+	if intent.Target == "" {
+		if current, err := c.fs.Readlink(intent.Dest); err == nil && current == intent.Old {
+			if err := c.fs.Remove(intent.Dest); err != nil {
+				return fmt.Errorf("failed to complete removal of %q: %w", intent.Dest, err)
+			}
+		}
+		if _, err := c.fs.Lstat(intent.Dest); os.IsNotExist(err) {
+			c.removeOldTarget(intent)
+		}
+		return nil
+	}
+	if _, err := c.fs.Lstat(intent.Symlink); err == nil {
+		err = c.fs.Rename(intent.Symlink, intent.Dest)
+		if err != nil {
+			return fmt.Errorf("failed to complete commit of %q: %w", intent.Dest, err)
+		}
+	}
+	if current, err := c.fs.Readlink(intent.Dest); err == nil && current == intent.Target {
+		c.removeOldTarget(intent)
+	}
+	return nil
+}
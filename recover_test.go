@@ -0,0 +1,67 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// interruptCommit simulates a crash during Commit, after the temporary
+// symlink is optionally created but before it is renamed into place.
+func interruptCommit(t *testing.T, cache *Cache, key, content string, symlinked bool) {
+	t.Helper()
+	tx, f, err := cache.Create(key)
+	require.NoError(t, err)
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	_ = f.Close()
+	target := cache.txPath(tx)
+	dest := strings.TrimSuffix(target, filepath.Ext(target))
+	old, _ := os.Readlink(dest)
+	tmpSymlink := cache.tempName(dest)
+	_, err = cache.writeIntent(commitIntent{Symlink: tmpSymlink, Dest: dest, Target: target, Old: old})
+	require.NoError(t, err)
+	if symlinked {
+		err = os.Symlink(target, tmpSymlink)
+		require.NoError(t, err)
+	}
+}
+
+func TestRecoverCommits(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("completed", []byte("old"))
+	require.NoError(t, err)
+	err = cache.WriteFile("abandoned", []byte("old"))
+	require.NoError(t, err)
+
+	interruptCommit(t, cache, "completed", "new", true)
+	interruptCommit(t, cache, "abandoned", "new", false)
+
+	err = cache.RecoverCommits()
+	require.NoError(t, err)
+
+	data, err := cache.ReadFile("completed")
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	data, err = cache.ReadFile("abandoned")
+	require.NoError(t, err)
+	require.Equal(t, "old", string(data))
+
+	markers, err := filepath.Glob(filepath.Join(cache.root, pendingDir, "*"))
+	require.NoError(t, err)
+	require.Empty(t, markers)
+
+	// The replaced target of the completed commit is removed, while the
+	// abandoned transaction is left for purging.
+	entries := func(key string) int {
+		h := cache.Hash(key)
+		matches, err := filepath.Glob(filepath.Join(cache.root, h[:2], h+"*"))
+		require.NoError(t, err)
+		return len(matches)
+	}
+	require.Equal(t, 2, entries("completed"))
+	require.Equal(t, 3, entries("abandoned"))
+}
@@ -0,0 +1,93 @@
+package localcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// refCounter tracks in-process references to entry targets.
+type refCounter struct {
+	lock    sync.Mutex
+	counts  map[string]int
+	pending map[string]func()
+}
+
+func newRefCounter() *refCounter {
+	return &refCounter{counts: map[string]int{}, pending: map[string]func(){}}
+}
+
+// processRefs is shared by every Cache in the process, so that a reference
+// acquired through one Cache is honoured by others over the same root.
+var processRefs = newRefCounter()
+
+func (r *refCounter) acquire(target string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.counts[target]++
+}
+
+// release a reference, running any deferred action once the last reference
+// is released.
+func (r *refCounter) release(target string) {
+	r.lock.Lock()
+	r.counts[target]--
+	if r.counts[target] > 0 {
+		r.lock.Unlock()
+		return
+	}
+	delete(r.counts, target)
+	action := r.pending[target]
+	delete(r.pending, target)
+	r.lock.Unlock()
+	if action != nil {
+		action()
+	}
+}
+
+// deferAction returns true if target is referenced, in which case action is
+// deferred until the last reference is released, replacing any previously
+// deferred action.
+func (r *refCounter) deferAction(target string, action func()) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.counts[target] == 0 {
+		return false
+	}
+	r.pending[target] = action
+	return true
+}
+
+// Acquire a reference to the committed entry for key.
+//
+// The returned path is the entry's target, which will not be deleted or
+// moved while the reference is held, even if the entry is overwritten,
+// removed, purged, touched, moved to the trash by WithSoftDelete or
+// repartitioned. The entry's symlink is still updated immediately, so the
+// key will resolve to any new content. release must be called when the path
+// is no longer in use, at which point any deferred deletion occurs.
+//
+// References are tracked within the current process only, and are honoured
+// by every Cache in the process over the same root.
+func (c *Cache) Acquire(key string) (path string, release func(), err error) {
+	link := c.linkPath(key)
+	for {
+		target, err := c.fs.Readlink(link)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to acquire entry: %w", err)
+		}
+		c.refs.acquire(target)
+		// Ensure the entry wasn't replaced before our reference was taken.
+		current, err := c.fs.Readlink(link)
+		if err != nil || current != target {
+			c.refs.release(target)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to acquire entry: %w", err)
+			}
+			continue
+		}
+		once := sync.Once{}
+		return target, func() {
+			once.Do(func() { c.refs.release(target) })
+		}, nil
+	}
+}
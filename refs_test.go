@@ -0,0 +1,101 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquire(t *testing.T) {
+	cache := NewForTesting(t)
+	err := cache.WriteFile("test", []byte("old"))
+	require.NoError(t, err)
+
+	path, release, err := cache.Acquire("test")
+	require.NoError(t, err)
+
+	// Overwriting repoints the key but keeps the acquired target.
+	err = cache.WriteFile("test", []byte("new"))
+	require.NoError(t, err)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(data))
+
+	release()
+	release()
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	// Removal is deferred too.
+	path, release, err = cache.Acquire("test")
+	require.NoError(t, err)
+	err = cache.Remove("test")
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("test"))
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+	release()
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	_, _, err = cache.Acquire("missing")
+	require.Error(t, err)
+}
+
+func TestAcquireTouch(t *testing.T) {
+	testClock := NewManualClock(time.Now())
+	cache := NewForTesting(t, WithClock(testClock))
+	require.NoError(t, cache.WriteFile("file", []byte("file")))
+	require.NoError(t, cache.ReplaceDir("dir", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file"), []byte("dir"), 0600)
+	}))
+	filePath, releaseFile, err := cache.Acquire("file")
+	require.NoError(t, err)
+	dirPath, releaseDir, err := cache.Acquire("dir")
+	require.NoError(t, err)
+
+	// Touching re-timestamps the entries without moving the acquired targets.
+	testClock.Advance(time.Hour)
+	require.NoError(t, cache.TouchAll())
+	require.NotEqual(t, filePath, cache.IfExists("file"))
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.Equal(t, "file", string(data))
+	data, err = os.ReadFile(filepath.Join(dirPath, "file"))
+	require.NoError(t, err)
+	require.Equal(t, "dir", string(data))
+
+	releaseFile()
+	releaseDir()
+	_, err = os.Stat(filePath)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(dirPath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestAcquireRepartition(t *testing.T) {
+	cache := NewForTesting(t)
+	require.NoError(t, cache.WriteFile("key", []byte("content")))
+	path, release, err := cache.Acquire("key")
+	require.NoError(t, err)
+
+	// A reference acquired through another Cache over the same root is
+	// honoured.
+	ringed := newCache(cache.root, []Option{WithConsistentHashPartitions(3)})
+	require.NoError(t, ringed.Repartition())
+	require.NoError(t, ringed.AssertContent("key", []byte("content")))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(data))
+
+	release()
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, ringed.AssertContent("key", []byte("content")))
+}
@@ -0,0 +1,63 @@
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RenamePreservingAge atomically moves the committed entry for oldKey to
+// newKey, replacing any existing entry for newKey.
+//
+// The entry keeps its original creation time, so it is purged as if it had
+// always been stored under newKey. This differs from rewriting the content
+// to newKey, which timestamps the entry with the current time and so resets
+// its age. Entries published with Link have no age and are simply relinked.
+//
+// The entry is cloned to its new name, hard linking its files if the FS
+// supports it and copying them otherwise, so oldKey remains readable until
+// newKey is committed. If oldKey is committed again during the rename, the
+// new entry is left in place.
+func (c *Cache) RenamePreservingAge(oldKey, newKey string) error {
+	c.frozen.RLock()
+	defer c.frozen.RUnlock()
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	if err := c.checkHash(newKey); err != nil {
+		return err
+	}
+	oldLink := c.linkPath(oldKey)
+	newLink := c.linkPath(newKey)
+	if oldLink == newLink {
+		return nil
+	}
+	target, err := c.fs.Readlink(oldLink)
+	if err != nil {
+		return err
+	}
+	err = c.mkdir(filepath.Dir(newLink))
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cache partition: %w", err)
+	}
+	newTarget := target
+	if c.owns(target) {
+		created, err := c.targetTime(target)
+		if err != nil {
+			return err
+		}
+		newTarget, err = c.linkTarget(target, newLink, created)
+		if err != nil {
+			return err
+		}
+	}
+	c.indexKey(newKey)
+	// Commit newKey before removing oldKey, so the entry is never missing.
+	if err := c.swapLink(newLink, newTarget); err != nil {
+		return err
+	}
+	// A hard linked target remains in place until now, and is removed along
+	// with the symlink.
+	_, err = c.removeLinkTo(oldLink, target)
+	return err
+}
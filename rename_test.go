@@ -0,0 +1,100 @@
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenamePreservingAge(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+
+	cache := NewForTesting(t, WithClock(testClock))
+	err := cache.WriteFile("old", []byte("hello"))
+	require.NoError(t, err)
+	created, err := cache.EntryTime("old")
+	require.NoError(t, err)
+	testClock.advance(time.Hour)
+	err = cache.WriteFile("new", []byte("replaced"))
+	require.NoError(t, err)
+
+	err = cache.RenamePreservingAge("old", "new")
+	require.NoError(t, err)
+	renamed, err := cache.EntryTime("new")
+	require.NoError(t, err)
+	require.True(t, created.Equal(renamed), "%s != %s", created, renamed)
+	data, err := cache.ReadFile("new")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	_, err = cache.ReadFile("old")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	err = cache.Purge(30 * time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("new"))
+}
+
+func TestRenamePreservingAgeConcurrentRead(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		for i := 0; i < 50; i++ {
+			oldKey, newKey := fmt.Sprintf("old-%d", i), fmt.Sprintf("new-%d", i)
+			err := cache.WriteFile(oldKey, []byte("hello"))
+			require.NoError(t, err)
+			done := make(chan struct{})
+			missing := make(chan struct{}, 1)
+			go func() {
+				defer close(missing)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					// Once oldKey is gone newKey must exist.
+					if _, err := cache.ReadFile(oldKey); err == nil {
+						continue
+					}
+					if _, err := cache.ReadFile(newKey); err != nil {
+						missing <- struct{}{}
+						return
+					}
+				}
+			}()
+			err = cache.RenamePreservingAge(oldKey, newKey)
+			close(done)
+			require.NoError(t, err)
+			_, found := <-missing
+			require.False(t, found, "entry was missing under both keys")
+		}
+	})
+}
+
+func TestRenamePreservingAgeFrozen(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		err := cache.WriteFile("old", []byte("hello"))
+		require.NoError(t, err)
+		unfreeze, err := cache.Freeze()
+		require.NoError(t, err)
+
+		renamed := make(chan error)
+		go func() { renamed <- cache.RenamePreservingAge("old", "new") }()
+		select {
+		case <-renamed:
+			t.Fatal("rename should block while the cache is frozen")
+		case <-time.After(50 * time.Millisecond):
+		}
+		require.Empty(t, cache.IfExists("new"))
+		unfreeze()
+		require.NoError(t, <-renamed)
+		require.NotEmpty(t, cache.IfExists("new"))
+
+		require.NoError(t, cache.Close())
+		err = cache.RenamePreservingAge("new", "old")
+		require.ErrorIs(t, err, ErrClosed)
+	})
+}
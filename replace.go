@@ -0,0 +1,75 @@
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReplaceIfOlder writes data to the entry for key if it is absent or was
+// created more than age ago, returning true if it was written.
+//
+// Concurrent calls for the same key within the process are serialised, so
+// only the first of several callers refreshing a stale entry writes it.
+// Other writes to key are not excluded. Entries published with Link have no
+// creation time and are never replaced.
+func (c *Cache) ReplaceIfOlder(key string, age time.Duration, data []byte) (replaced bool, err error) {
+	unlock := c.keyLocks.lock(key)
+	defer unlock()
+	target, err := c.fs.Readlink(c.linkPath(key))
+	if err == nil {
+		if !c.owns(target) {
+			return false, nil
+		}
+		created, err := c.targetTime(target)
+		if err != nil {
+			return false, err
+		}
+		if c.clock.Since(created) <= age {
+			return false, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read entry: %w", err)
+	}
+	if err := c.WriteFile(key, data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// keyMutex provides a mutex per key, held only while in use.
+type keyMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock blocks until the mutex for key is held, returning a function that
+// releases it.
+func (m *keyMutex) lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = map[string]*keyLock{}
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,44 @@
+package localcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceIfOlder(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := NewManualClock(time.Now())
+		cache := newCache(WithClock(testClock))
+		replaced, err := cache.ReplaceIfOlder("test", time.Hour, []byte("first"))
+		require.NoError(t, err)
+		require.True(t, replaced)
+
+		testClock.Advance(30 * time.Minute)
+		replaced, err = cache.ReplaceIfOlder("test", time.Hour, []byte("fresh"))
+		require.NoError(t, err)
+		require.False(t, replaced)
+		require.NoError(t, cache.AssertContent("test", []byte("first")))
+
+		testClock.Advance(time.Hour)
+		var count int64
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				replaced, err := cache.ReplaceIfOlder("test", time.Hour, []byte("stale"))
+				require.NoError(t, err)
+				if replaced {
+					atomic.AddInt64(&count, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, int64(1), count)
+		require.NoError(t, cache.AssertContent("test", []byte("stale")))
+	})
+}
@@ -0,0 +1,186 @@
+package localcache
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directory under the cache root containing key reservations.
+const reservationsDir = ".reservations"
+
+// DefaultReservationTTL is the duration after which a reservation made with
+// TryReserve expires if it has not been released.
+const DefaultReservationTTL = time.Minute
+
+// WithReservationTTL sets the duration after which a reservation made with
+// TryReserve expires if it has not been released.
+func WithReservationTTL(d time.Duration) Option {
+	return func(c *Cache) { c.reservationTTL = d }
+}
+
+// TryReserve marks key as about to be created, so that other workers can
+// skip creating it.
+//
+// reserved is false if another worker holds an unexpired reservation for
+// key, or if key already exists. Otherwise release must be called to clear
+// the reservation once the entry has been created (or creation abandoned).
+// Reservations expire after DefaultReservationTTL (see WithReservationTTL)
+// so that a crashed worker does not hold a key indefinitely. Releasing an
+// expired reservation that has since been claimed by another worker leaves
+// the new reservation in place.
+//
+// Reservations are advisory and do not prevent writes to the key.
+func (c *Cache) TryReserve(key string) (reserved bool, release func(), err error) {
+	h := c.keyHash(key)
+	if _, err := c.fs.Stat(c.linkPath(key)); err == nil {
+		return false, nil, nil
+	}
+	dir := filepath.Join(c.root, reservationsDir)
+	err = c.mkdir(dir)
+	if err != nil && !os.IsExist(err) {
+		return false, nil, fmt.Errorf("failed to create reservations directory: %w", err)
+	}
+	marker := filepath.Join(dir, h)
+	unlock, err := c.lock(reservationLock(h))
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to lock reservation: %w", err)
+	}
+	defer unlock()
+	token, err := c.reservationToken()
+	if err != nil {
+		return false, nil, err
+	}
+	// The marker is a symlink to its owner's token, so it is created
+	// atomically and can be checked without reading a file.
+	err = c.fs.Symlink(token, marker)
+	if os.IsExist(err) {
+		reclaimed, rerr := c.reclaimReservation(marker, token)
+		if rerr != nil || !reclaimed {
+			return false, nil, rerr
+		}
+		err = nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to reserve key: %w", err)
+	}
+	once := sync.Once{}
+	return true, func() { once.Do(func() { c.releaseReservation(marker, token) }) }, nil
+}
+
+// reservationLock returns the name of the lock serialising reservations of
+// the hash h.
+func reservationLock(h string) string {
+	return "reservation." + h
+}
+
+// reservationToken returns a unique token identifying a reservation, which
+// embeds the time it was made.
+func (c *Cache) reservationToken() (string, error) {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", fmt.Errorf("failed to generate reservation token: %w", err)
+	}
+	return fmt.Sprintf("%x-%x", c.clock.Now().UnixNano(), nonce), nil
+}
+
+// reclaimReservation replaces the reservation at marker with token if it
+// has expired, returning true if it was replaced.
+//
+// The expired marker is moved aside before being replaced. If it no longer
+// holds the expired token once moved, another worker reclaimed it first, so
+// it is put back.
+func (c *Cache) reclaimReservation(marker, token string) (bool, error) {
+	old, err := c.fs.Readlink(marker)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return c.reclaimLegacyReservation(marker, token)
+	}
+	if !c.reservationExpired(old) {
+		return false, nil
+	}
+	stale := marker + "." + token
+	if err := c.fs.Rename(marker, stale); err != nil {
+		// Another worker claimed it first.
+		return false, nil //nolint:nilerr
+	}
+	defer c.fs.Remove(stale) //nolint:errcheck
+	if current, err := c.fs.Readlink(stale); err != nil || current != old {
+		if err == nil {
+			_ = c.fs.Symlink(current, marker)
+		}
+		return false, nil
+	}
+	err = c.fs.Symlink(token, marker)
+	if os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to reserve key: %w", err)
+	}
+	return true, nil
+}
+
+// reclaimLegacyReservation replaces a reservation directory made by an
+// earlier version if its modification time has expired.
+func (c *Cache) reclaimLegacyReservation(marker, token string) (bool, error) {
+	info, err := c.fs.Lstat(marker)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to check reservation: %w", err)
+	}
+	if c.clock.Since(info.ModTime()) <= c.reservationLifetime() {
+		return false, nil
+	}
+	if err := c.fs.RemoveAll(marker); err != nil {
+		return false, fmt.Errorf("failed to remove expired reservation: %w", err)
+	}
+	err = c.fs.Symlink(token, marker)
+	if os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to reserve key: %w", err)
+	}
+	return true, nil
+}
+
+// releaseReservation removes the reservation at marker if it is still held
+// by token.
+func (c *Cache) releaseReservation(marker, token string) {
+	unlock, err := c.lock(reservationLock(filepath.Base(marker)))
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if current, err := c.fs.Readlink(marker); err == nil && current == token {
+		_ = c.fs.Remove(marker)
+	}
+}
+
+// reservationExpired returns true if the reservation identified by token is
+// older than the reservation TTL. Unrecognised tokens are expired.
+func (c *Cache) reservationExpired(token string) bool {
+	created, _, ok := strings.Cut(token, "-")
+	if !ok {
+		return true
+	}
+	nanos, err := strconv.ParseInt(created, 16, 64)
+	if err != nil {
+		return true
+	}
+	return c.clock.Since(time.Unix(0, nanos)) > c.reservationLifetime()
+}
+
+// reservationLifetime returns the duration after which reservations expire.
+func (c *Cache) reservationLifetime() time.Duration {
+	if c.reservationTTL == 0 {
+		return DefaultReservationTTL
+	}
+	return c.reservationTTL
+}
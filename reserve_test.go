@@ -0,0 +1,117 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryReserve(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		reserved, release, err := cache.TryReserve("test")
+		require.NoError(t, err)
+		require.True(t, reserved)
+
+		reserved, _, err = cache.TryReserve("test")
+		require.NoError(t, err)
+		require.False(t, reserved)
+
+		release()
+		reserved, release, err = cache.TryReserve("test")
+		require.NoError(t, err)
+		require.True(t, reserved)
+		require.NoError(t, cache.WriteFile("test", []byte("test")))
+		release()
+
+		// The key exists, so there's nothing to reserve.
+		reserved, _, err = cache.TryReserve("test")
+		require.NoError(t, err)
+		require.False(t, reserved)
+	})
+}
+
+func TestTryReserveExpires(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock), WithReservationTTL(time.Minute))
+		reserved, _, err := cache.TryReserve("test")
+		require.NoError(t, err)
+		require.True(t, reserved)
+
+		testClock.advance(30 * time.Second)
+		reserved, _, err = cache.TryReserve("test")
+		require.NoError(t, err)
+		require.False(t, reserved)
+
+		testClock.advance(time.Minute)
+		reserved, _, err = cache.TryReserve("test")
+		require.NoError(t, err)
+		require.True(t, reserved)
+	})
+}
+
+func TestTryReserveConcurrent(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	cache := NewForTesting(t, WithClock(clock), WithReservationTTL(time.Minute))
+	reserved, releaseStale, err := cache.TryReserve("test")
+	require.NoError(t, err)
+	require.True(t, reserved)
+	clock.Advance(2 * time.Minute)
+
+	var (
+		wg       sync.WaitGroup
+		claimed  int32
+		releases = make(chan func(), 16)
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker uses its own Cache, as separate processes would.
+			worker := newCache(cache.root, []Option{WithClock(clock), WithReservationTTL(time.Minute)})
+			reserved, release, err := worker.TryReserve("test")
+			require.NoError(t, err)
+			if reserved {
+				atomic.AddInt32(&claimed, 1)
+				releases <- release
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), claimed)
+
+	// The stale holder releasing late must not drop the new reservation.
+	releaseStale()
+	reserved, _, err = cache.TryReserve("test")
+	require.NoError(t, err)
+	require.False(t, reserved)
+
+	(<-releases)()
+	reserved, _, err = cache.TryReserve("test")
+	require.NoError(t, err)
+	require.True(t, reserved)
+}
+
+func TestTryReserveLegacyMarker(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	cache := NewForTesting(t, WithClock(clock), WithReservationTTL(time.Minute))
+	marker := filepath.Join(cache.root, reservationsDir, cache.Hash("test"))
+	require.NoError(t, os.MkdirAll(marker, 0700))
+	require.NoError(t, os.Chtimes(marker, clock.Now(), clock.Now()))
+
+	reserved, _, err := cache.TryReserve("test")
+	require.NoError(t, err)
+	require.False(t, reserved)
+
+	clock.Advance(2 * time.Minute)
+	reserved, _, err = cache.TryReserve("test")
+	require.NoError(t, err)
+	require.True(t, reserved)
+}
@@ -0,0 +1,184 @@
+package localcache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Number of points each partition occupies on the ring.
+const ringReplicas = 64
+
+// WithConsistentHashPartitions distributes entries across a consistent-hash
+// ring of n partitions rather than partitioning by hash prefix.
+//
+// This evens out the distribution of entries when hashes are not uniformly
+// distributed, such as with a weak hasher. Existing caches can be converted
+// to (or from) this scheme with Repartition.
+func WithConsistentHashPartitions(n int) Option {
+	return func(c *Cache) { c.ring = newHashRing(n) }
+}
+
+type hashRing struct {
+	width  int
+	points []uint64
+	owners map[uint64]int
+}
+
+func newHashRing(n int) *hashRing {
+	if n < 1 {
+		n = 1
+	}
+	r := &hashRing{
+		width:  len(strconv.FormatInt(int64(n-1), 16)),
+		owners: map[uint64]int{},
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < ringReplicas; j++ {
+			point := ringHash(fmt.Sprintf("%d-%d", i, j))
+			r.points = append(r.points, point)
+			r.owners[point] = i
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+func (r *hashRing) partition(h string) string {
+	point := ringHash(h)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+	return fmt.Sprintf("%0*x", r.width, r.owners[r.points[i]])
+}
+
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	// FNV's high bits are poorly mixed for inputs that differ only in their
+	// suffix, so finalise with MurmurHash3's mixer.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Repartition moves committed entries that are not in the partition dictated
+// by the Cache's current partitioning scheme.
+//
+// This provides a migration path when changing partitioning options on an
+// existing cache. It is not atomic, and should be run while the cache is not
+// otherwise in use. Each entry is cloned to its new partition, hard linking
+// its files if the FS supports them, and its previous target is removed as
+// with Remove, so a target held with Acquire is kept until it is released.
+//
+// Repartition is not supported with WithGroupBy.
+func (c *Cache) Repartition() error {
+	if c.group != nil {
+		return fmt.Errorf("cannot repartition a cache grouped with WithGroupBy")
+	}
+	links, err := c.committed()
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		if err := c.repartitionEntry(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) repartitionEntry(link string) error {
+	h := filepath.Base(link)
+	dest := c.entryPath(h)
+	if dest == link {
+		return nil
+	}
+	target, err := c.fs.Readlink(link)
+	if err != nil {
+		return fmt.Errorf("failed to read link: %w", err)
+	}
+	err = c.mkdir(filepath.Dir(dest))
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cache partition: %w", err)
+	}
+	unlock, err := c.lockEntry(dest)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// Targets published with Link belong to the caller and stay where they are.
+	newTarget := target
+	if c.owns(target) {
+		newTarget = filepath.Join(filepath.Dir(dest), filepath.Base(target))
+		if err := c.cloneEntry(newTarget, target, 0); err != nil {
+			_ = c.fs.RemoveAll(newTarget)
+			return fmt.Errorf("failed to move entry: %w", err)
+		}
+		err = c.cloneEntry(c.metaPath(newTarget), c.metaPath(target), 0)
+		if err != nil && !os.IsNotExist(err) {
+			_ = c.fs.RemoveAll(newTarget)
+			return fmt.Errorf("failed to move metadata: %w", err)
+		}
+	}
+	discard := func() {
+		if newTarget != target {
+			_ = c.removeTarget(newTarget)
+		}
+	}
+	tmpSymlink := c.tempName(dest)
+	err = c.fs.Symlink(newTarget, tmpSymlink)
+	if err != nil {
+		discard()
+		return fmt.Errorf("failed to create symlink: %w", err)
+	}
+	err = c.fs.Rename(tmpSymlink, dest)
+	if err != nil {
+		_ = c.fs.Remove(tmpSymlink)
+		discard()
+		return fmt.Errorf("failed to rename symlink: %w", err)
+	}
+	err = c.fs.Remove(link)
+	if err != nil {
+		return fmt.Errorf("failed to remove old symlink: %w", err)
+	}
+	if newTarget != target {
+		if err := c.removeTarget(target); err != nil {
+			return fmt.Errorf("failed to remove old entry: %w", err)
+		}
+	}
+	return c.indexPut(dest)
+}
+
+// PartitionStats returns the number of committed entries in each partition
+// directory, keyed by the partition's name.
+//
+// Partition directories without any committed entries are included with a
+// count of zero. A skewed distribution indicates a weak hash or partitioning
+// scheme, see WithConsistentHashPartitions.
+func (c *Cache) PartitionStats() (map[string]int, error) {
+	partitions, err := c.partitions()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int, len(partitions))
+	for _, partition := range partitions {
+		out[filepath.Base(partition)] = 0
+	}
+	links, err := c.committed()
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		out[filepath.Base(filepath.Dir(link))]++
+	}
+	return out, nil
+}
@@ -0,0 +1,100 @@
+package localcache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistentHashPartitions(t *testing.T) {
+	// Simulate a weak hasher where every hash shares a prefix.
+	skewed := make([]string, 1000)
+	for i := range skewed {
+		skewed[i] = fmt.Sprintf("0000%060x", i)
+	}
+	distribution := func(c *Cache) map[string]int {
+		out := map[string]int{}
+		for _, h := range skewed {
+			out[c.partition(h)]++
+		}
+		return out
+	}
+
+	require.Len(t, distribution(NewForTesting(t)), 1)
+
+	ringed := distribution(NewForTesting(t, WithConsistentHashPartitions(16)))
+	require.Len(t, ringed, 16)
+	for partition, count := range ringed {
+		require.Greater(t, count, 1000/16/4, "partition %s is underpopulated", partition)
+	}
+}
+
+func TestRepartition(t *testing.T) {
+	cache := NewForTesting(t)
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		err := cache.WriteFile(key, []byte(key))
+		require.NoError(t, err)
+	}
+
+	ringed := newCache(cache.root, []Option{WithConsistentHashPartitions(3)})
+	err := ringed.Repartition()
+	require.NoError(t, err)
+	for _, key := range keys {
+		data, err := ringed.ReadFile(key)
+		require.NoError(t, err)
+		require.Equal(t, key, string(data))
+	}
+	for _, path := range list(ringed) {
+		parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		if len(parts) == 2 && !strings.HasPrefix(parts[0], ".") {
+			require.Len(t, parts[0], 1, "entry %s was not repartitioned", path)
+		}
+	}
+}
+
+func TestRepartitionLinked(t *testing.T) {
+	cache := NewForTesting(t)
+	external := filepath.Join(t.TempDir(), "tool")
+	require.NoError(t, os.WriteFile(external, []byte("tool"), 0600))
+	_, err := cache.Link("linked", external)
+	require.NoError(t, err)
+
+	ringed := newCache(cache.root, []Option{WithConsistentHashPartitions(3), WithPurgeSafetyWindow(0)})
+	require.NoError(t, ringed.Repartition())
+	target, err := os.Readlink(ringed.IfExists("linked"))
+	require.NoError(t, err)
+	require.Equal(t, external, target)
+	data, err := ringed.ReadFile("linked")
+	require.NoError(t, err)
+	require.Equal(t, "tool", string(data))
+
+	require.NoError(t, ringed.Purge(0))
+	data, err = os.ReadFile(external)
+	require.NoError(t, err)
+	require.Equal(t, "tool", string(data))
+}
+
+func TestPartitionStats(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache(WithConsistentHashPartitions(8))
+		for i := 0; i < 100; i++ {
+			err := cache.WriteFile(fmt.Sprintf("key-%d", i), []byte("data"))
+			require.NoError(t, err)
+		}
+		stats, err := cache.PartitionStats()
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(stats), 8)
+		total := 0
+		for _, count := range stats {
+			total += count
+		}
+		count, err := cache.Count()
+		require.NoError(t, err)
+		require.Equal(t, count, total)
+	})
+}
@@ -0,0 +1,111 @@
+package localcache
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Rotate shifts the content of each of keys to the next key in the sequence,
+// discarding the content of the last key, and writes newContent to the first.
+//
+// For example, rotating "current", "prev" and "prev2" moves "prev" to
+// "prev2" and "current" to "prev", then replaces "current". A missing key
+// leaves the next key missing.
+//
+// Keys are rotated atomically: the content of each key is hard linked, or
+// copied if that isn't possible, to a Transaction for the next key, and
+// every key is then committed together. If the rotation fails, or is
+// interrupted by a crash and recovered by RecoverCommits, either every key
+// or none is rotated.
+//
+// With WithMaxConcurrentWrites, slots for every key are acquired before any
+// are written, so keys must fit within the limit.
+func (c *Cache) Rotate(keys []string, newContent []byte) (err error) {
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys to rotate")
+	}
+	if err := c.writes.acquireN(len(keys)); err != nil {
+		return err
+	}
+	b := &writeBatch{dirs: map[string]bool{}, slots: len(keys)}
+	defer b.cancel(c.writes)
+	var txs []Transaction
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, tx := range txs {
+			_ = c.Rollback(tx)
+		}
+	}()
+	links := map[string]string{}
+	for i := len(keys) - 1; i > 0; i-- {
+		src, dst := keys[i-1], keys[i]
+		target, err := c.fs.Readlink(c.linkPath(src))
+		switch {
+		case os.IsNotExist(err):
+			links[c.linkPath(dst)] = ""
+		case err != nil:
+			return fmt.Errorf("failed to rotate %q to %q: %w", src, dst, err)
+		case !c.owns(target):
+			links[c.linkPath(dst)] = target
+		default:
+			tx, err := c.cloneTx(dst, target, b)
+			if err != nil {
+				return fmt.Errorf("failed to rotate %q to %q: %w", src, dst, err)
+			}
+			txs = append(txs, tx)
+		}
+	}
+	tx, err := c.writeTx(keys[0], newContent, nil, b)
+	if err != nil {
+		return err
+	}
+	txs = append(txs, tx)
+	_, done, err := c.commitAll(context.Background(), txs, links)
+	if done {
+		txs = nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate: %w", err)
+	}
+	return nil
+}
+
+// cloneTx creates a Transaction for key containing a clone of the committed
+// entry target, including its metadata, as part of the batch b.
+func (c *Cache) cloneTx(key, target string, b *writeBatch) (tx Transaction, err error) {
+	info, err := c.fs.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	var w File
+	if info.IsDir() {
+		tx, _, err = c.mkdirTx(key, true, b)
+	} else {
+		tx, w, err = c.createTx(key, true, b)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer c.RollbackOnError(tx, &err)
+	if w != nil {
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+	}
+	path := c.txPath(tx)
+	// Replace the empty file or directory with a clone of the target.
+	if err := c.fs.Remove(path); err != nil {
+		return "", err
+	}
+	if err := c.cloneEntry(path, target, 0); err != nil {
+		return "", err
+	}
+	meta, err := c.readMeta(target)
+	if err != nil || meta == (EntryMeta{}) {
+		return tx, err
+	}
+	return tx, c.writeMeta(path, meta)
+}
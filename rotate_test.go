@@ -0,0 +1,119 @@
+package localcache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotate(t *testing.T) {
+	cache := NewForTesting(t, WithClock(&fakeClock{currentTime: time.Now()}))
+	keys := []string{"current", "prev", "prev2"}
+
+	for _, content := range []string{"one", "two", "three", "four"} {
+		err := cache.Rotate(keys, []byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, cache.AssertContent("current", []byte("four")))
+	require.NoError(t, cache.AssertContent("prev", []byte("three")))
+	require.NoError(t, cache.AssertContent("prev2", []byte("two")))
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	err = cache.Remove("current")
+	require.NoError(t, err)
+	err = cache.Rotate(keys, []byte("five"))
+	require.NoError(t, err)
+	require.NoError(t, cache.AssertContent("current", []byte("five")))
+	_, err = cache.ReadFile("prev")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, cache.AssertContent("prev2", []byte("three")))
+
+	err = cache.Rotate(nil, []byte("six"))
+	require.Error(t, err)
+}
+
+func TestRotateAtomic(t *testing.T) {
+	var failLink string
+	fs := renameHookFS{FS: OSFS{}, hook: func(oldpath, newpath string) error {
+		if newpath == failLink {
+			return errors.New("rename failed")
+		}
+		return nil
+	}}
+	cache := NewForTesting(t, WithFS(fs))
+	keys := []string{"current", "prev", "prev2"}
+	require.NoError(t, cache.Rotate(keys, []byte("one")))
+	require.NoError(t, cache.Rotate(keys, []byte("two")))
+	require.NoError(t, cache.Rotate(keys, []byte("three")))
+
+	// A failure to commit any key leaves every key unrotated.
+	for _, key := range keys {
+		failLink = cache.linkPath(key)
+		require.Error(t, cache.Rotate(keys, []byte("four")))
+		require.NoError(t, cache.AssertContent("current", []byte("three")))
+		require.NoError(t, cache.AssertContent("prev", []byte("two")))
+		require.NoError(t, cache.AssertContent("prev2", []byte("one")))
+		pending, err := cache.PendingTransactions()
+		require.NoError(t, err)
+		require.Empty(t, pending)
+	}
+
+	failLink = ""
+	require.NoError(t, cache.Rotate(keys, []byte("four")))
+	require.NoError(t, cache.AssertContent("current", []byte("four")))
+	require.NoError(t, cache.AssertContent("prev", []byte("three")))
+	require.NoError(t, cache.AssertContent("prev2", []byte("two")))
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
+
+func TestRotateRecover(t *testing.T) {
+	var crashLink string
+	fs := renameHookFS{FS: OSFS{}, hook: func(oldpath, newpath string) error {
+		if newpath == crashLink {
+			panic("crash")
+		}
+		return nil
+	}}
+	cache := NewForTesting(t, WithFS(fs))
+	keys := []string{"current", "prev", "prev2"}
+	require.NoError(t, cache.Rotate(keys, []byte("one")))
+	require.NoError(t, cache.Rotate(keys, []byte("two")))
+	require.NoError(t, cache.Remove("current"))
+
+	crashLink = cache.linkPath("prev2")
+	require.Panics(t, func() { _ = cache.Rotate(keys, []byte("three")) })
+
+	// The interrupted rotation is completed in full, including removing the
+	// key following the missing one.
+	crashLink = ""
+	require.NoError(t, cache.RecoverCommits())
+	require.NoError(t, cache.AssertContent("current", []byte("three")))
+	_, err := cache.ReadFile("prev")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, cache.AssertContent("prev2", []byte("one")))
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestRotateDir(t *testing.T) {
+	cache := NewForTesting(t, WithKindOverwrite())
+	require.NoError(t, cache.ReplaceDir("current", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file"), []byte("dir"), 0600)
+	}))
+	require.NoError(t, cache.Rotate([]string{"current", "prev"}, []byte("file")))
+	require.NoError(t, cache.AssertContent("current", []byte("file")))
+	target, err := cache.fs.Readlink(cache.linkPath("prev"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(target, "file"))
+	require.NoError(t, err)
+	require.Equal(t, "dir", string(data))
+}
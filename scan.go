@@ -0,0 +1,19 @@
+package localcache
+
+import (
+	"bufio"
+	"io"
+)
+
+// OpenScanner opens the file identified by key and returns a bufio.Scanner
+// over its lines, along with a Closer that must be called to release the file.
+//
+// Entries are decompressed as with OpenReader. An error wrapping ErrNotFound
+// is returned if key has no entry.
+func (c *Cache) OpenScanner(key string) (*bufio.Scanner, io.Closer, error) {
+	r, err := c.OpenReader(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bufio.NewScanner(r), r, nil
+}
@@ -0,0 +1,27 @@
+package localcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenScanner(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		err := cache.WriteFile("log", []byte("one\ntwo\n\nthree"))
+		require.NoError(t, err)
+		scanner, closer, err := cache.OpenScanner("log")
+		require.NoError(t, err)
+		var lines []string
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		require.NoError(t, scanner.Err())
+		require.NoError(t, closer.Close())
+		require.Equal(t, []string{"one", "two", "", "three"}, lines)
+
+		_, _, err = cache.OpenScanner("missing")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+}
@@ -0,0 +1,41 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Seed writes each entry that does not already exist in the Cache, leaving
+// existing entries untouched, so it is safe to call on every start.
+//
+// Each entry is committed atomically, but the entries are not committed as a
+// whole. Failure to write an individual entry does not stop seeding, and all
+// such errors are returned.
+func (c *Cache) Seed(entries map[string][]byte) error {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		if err := c.seed(key, entries[key]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to seed %q: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) seed(key string, data []byte) error {
+	unlock := c.keyLocks.lock(key)
+	defer unlock()
+	_, err := c.fs.Lstat(c.linkPath(key))
+	if err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return c.WriteFile(key, data)
+}
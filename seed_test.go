@@ -0,0 +1,37 @@
+package localcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		require.NoError(t, cache.WriteFile("b", []byte("existing")))
+
+		entries := map[string][]byte{"a": []byte("a"), "b": []byte("b")}
+		require.NoError(t, cache.Seed(entries))
+		require.NoError(t, cache.WriteFile("a", []byte("changed")))
+		require.NoError(t, cache.Seed(entries))
+
+		data, err := cache.ReadFile("a")
+		require.NoError(t, err)
+		require.Equal(t, "changed", string(data))
+		data, err = cache.ReadFile("b")
+		require.NoError(t, err)
+		require.Equal(t, "existing", string(data))
+	})
+}
+
+func TestSeedErrors(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		require.NoError(t, cache.Close())
+		err := cache.Seed(map[string][]byte{"a": []byte("a"), "b": []byte("b")})
+		require.ErrorIs(t, err, ErrClosed)
+		require.Contains(t, err.Error(), `"a"`)
+		require.Contains(t, err.Error(), `"b"`)
+	})
+}
@@ -0,0 +1,88 @@
+package localcache
+
+import (
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+)
+
+// Stats are counters accumulated over the lifetime of a Cache.
+type Stats struct {
+	// Hits is the number of lookups that found a committed entry.
+	Hits int64
+	// Misses is the number of lookups that did not find a committed entry.
+	Misses int64
+	// Writes is the number of committed transactions.
+	Writes int64
+	// Evictions is the number of entries removed by purging.
+	Evictions int64
+}
+
+// counters are the Cache's stats.
+//
+// Lookups are far more frequent than writes, so hits and misses are spread
+// across shards to avoid contending on a single cache line.
+type counters struct {
+	hits      shardedCounter
+	misses    shardedCounter
+	writes    int64
+	evictions int64
+}
+
+func newCounters() *counters {
+	return &counters{hits: newShardedCounter(), misses: newShardedCounter()}
+}
+
+// record a lookup as a hit or miss based on its error.
+func (c *counters) record(err error) {
+	if err != nil {
+		c.misses.add(1)
+	} else {
+		c.hits.add(1)
+	}
+}
+
+// shardedCounter is a counter that scales under concurrent increments by
+// spreading them across shards, at the cost of a slower load.
+type shardedCounter []counterShard
+
+// counterShard is padded to occupy its own cache line.
+type counterShard struct {
+	n int64
+	_ [56]byte
+}
+
+func newShardedCounter() shardedCounter {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	return make(shardedCounter, n)
+}
+
+// add delta to a random shard.
+//
+// The global source of math/rand is lock free when unseeded, so concurrent
+// goroutines will mostly pick different shards.
+func (s shardedCounter) add(delta int64) {
+	atomic.AddInt64(&s[rand.Uint32()&uint32(len(s)-1)].n, delta)
+}
+
+// load returns the sum of all shards.
+func (s shardedCounter) load() int64 {
+	var total int64
+	for i := range s {
+		total += atomic.LoadInt64(&s[i].n)
+	}
+	return total
+}
+
+// Stats returns a snapshot of the Cache's counters.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:      c.stats.hits.load(),
+		Misses:    c.stats.misses.load(),
+		Writes:    atomic.LoadInt64(&c.stats.writes),
+		Evictions: atomic.LoadInt64(&c.stats.evictions),
+	}
+}
@@ -0,0 +1,71 @@
+package localcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+	cache := NewForTesting(t, WithClock(testClock))
+	require.Equal(t, Stats{}, cache.Stats())
+
+	require.NoError(t, cache.WriteFile("a", []byte("a")))
+	require.NoError(t, cache.WriteFile("b", []byte("b")))
+	_, err := cache.ReadFile("a")
+	require.NoError(t, err)
+	f, err := cache.Open("b")
+	require.NoError(t, err)
+	_ = f.Close()
+	require.NotEmpty(t, cache.IfExists("a"))
+	_, err = cache.ReadFile("missing")
+	require.Error(t, err)
+	_, err = cache.Open("missing")
+	require.Error(t, err)
+	require.Empty(t, cache.IfExists("missing"))
+
+	testClock.advance(time.Hour)
+	require.NoError(t, cache.Purge(time.Minute))
+	require.Equal(t, Stats{Hits: 3, Misses: 3, Writes: 2, Evictions: 2}, cache.Stats())
+}
+
+func TestShardedCounter(t *testing.T) {
+	counter := newShardedCounter()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				counter.add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(8000), counter.load())
+}
+
+func BenchmarkCounter(b *testing.B) {
+	b.Run("Atomic", func(b *testing.B) {
+		var counter int64
+		b.SetParallelism(16)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				atomic.AddInt64(&counter, 1)
+			}
+		})
+	})
+	b.Run("Sharded", func(b *testing.B) {
+		counter := newShardedCounter()
+		b.SetParallelism(16)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				counter.add(1)
+			}
+		})
+	})
+}
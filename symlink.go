@@ -0,0 +1,125 @@
+package localcache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// linkMarkerMagic prefixes the content of marker files standing in for symlinks.
+var linkMarkerMagic = []byte("localcache-link\x00")
+
+// Marker files larger than this are not considered, to bound reads.
+const maxLinkMarkerSize = 64 * 1024
+
+// SymlinkFallbackFS wraps fs so that where a symlink can't be created due to
+// insufficient privileges, a small marker file recording the target is
+// created in its place.
+//
+// This is necessary on Windows, where creating symlinks requires elevated
+// privileges, and is the default FS there. Markers are followed by Readlink,
+// Stat, Open, Chmod and Chtimes and are reported as symlinks by Lstat, so
+// the Cache behaves identically. Like symlinks, markers are atomically
+// replaced by renaming over them, for both file and directory entries.
+func SymlinkFallbackFS(fs FS) FS {
+	return symlinkFallbackFS{fs}
+}
+
+type symlinkFallbackFS struct{ FS }
+
+func (s symlinkFallbackFS) Symlink(oldname, newname string) error {
+	err := s.FS.Symlink(oldname, newname)
+	if err == nil || !isPrivilegeError(err) {
+		return err
+	}
+	if _, err := s.FS.Lstat(newname); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	f, err := s.FS.Create(newname)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(append([]byte(nil), linkMarkerMagic...), oldname...))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = s.FS.Remove(newname)
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return nil
+}
+
+// marker returns the target recorded in the marker file name, and false if
+// name is not a marker.
+func (s symlinkFallbackFS) marker(name string) (string, bool) {
+	info, err := s.FS.Lstat(name)
+	if err != nil || !info.Mode().IsRegular() || info.Size() <= int64(len(linkMarkerMagic)) || info.Size() > maxLinkMarkerSize {
+		return "", false
+	}
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(f, maxLinkMarkerSize))
+	if err != nil || !bytes.HasPrefix(data, linkMarkerMagic) {
+		return "", false
+	}
+	// Targets are always absolute, which guards against files that merely
+	// begin with the magic bytes.
+	target := string(data[len(linkMarkerMagic):])
+	if !filepath.IsAbs(target) || strings.ContainsRune(target, 0) {
+		return "", false
+	}
+	return target, true
+}
+
+// resolve returns the target of name if it is a marker, or name otherwise.
+func (s symlinkFallbackFS) resolve(name string) string {
+	if target, ok := s.marker(name); ok {
+		return target
+	}
+	return name
+}
+
+func (s symlinkFallbackFS) Readlink(name string) (string, error) {
+	target, err := s.FS.Readlink(name)
+	if err == nil || os.IsNotExist(err) {
+		return target, err
+	}
+	if target, ok := s.marker(name); ok {
+		return target, nil
+	}
+	return "", err
+}
+
+func (s symlinkFallbackFS) Lstat(name string) (os.FileInfo, error) {
+	info, err := s.FS.Lstat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return info, err
+	}
+	if _, ok := s.marker(name); ok {
+		return markerInfo{info}, nil
+	}
+	return info, nil
+}
+
+func (s symlinkFallbackFS) Stat(name string) (os.FileInfo, error) { return s.FS.Stat(s.resolve(name)) }
+func (s symlinkFallbackFS) Open(name string) (File, error)        { return s.FS.Open(s.resolve(name)) }
+func (s symlinkFallbackFS) Chmod(name string, mode os.FileMode) error {
+	return s.FS.Chmod(s.resolve(name), mode)
+}
+func (s symlinkFallbackFS) Chtimes(name string, atime, mtime time.Time) error {
+	return s.FS.Chtimes(s.resolve(name), atime, mtime)
+}
+
+// markerInfo reports a marker file as a symlink.
+type markerInfo struct{ os.FileInfo }
+
+func (m markerInfo) Mode() os.FileMode { return os.ModeSymlink | m.FileInfo.Mode().Perm() }
+func (m markerInfo) IsDir() bool       { return false }
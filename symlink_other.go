@@ -0,0 +1,14 @@
+//go:build !windows
+
+package localcache
+
+import (
+	"errors"
+	"os"
+)
+
+func defaultFS() FS { return OSFS{} }
+
+func isPrivilegeError(err error) bool {
+	return errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,68 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// noSymlinkFS is an FS on which creating symlinks is not permitted.
+type noSymlinkFS struct{ FS }
+
+func (noSymlinkFS) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrPermission}
+}
+
+func TestSymlinkFallbackFS(t *testing.T) {
+	cache := NewForTesting(t, WithFS(SymlinkFallbackFS(noSymlinkFS{OSFS{}})), WithPurgeSafetyWindow(0))
+	err := cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	info, err := os.Lstat(cache.IfExists("file"))
+	require.NoError(t, err)
+	require.True(t, info.Mode().IsRegular(), "expected a marker file rather than a symlink")
+	require.NoError(t, cache.AssertContent("file", []byte("hello")))
+
+	// Replacing an entry atomically swaps the marker.
+	err = cache.WriteFile("file", []byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, cache.AssertContent("file", []byte("world")))
+
+	err = cache.ReplaceDir("dir", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "nested"), []byte("nested"), 0600)
+	})
+	require.NoError(t, err)
+	stat, err := cache.Stat("dir")
+	require.NoError(t, err)
+	require.True(t, stat.IsDir())
+	f, err := cache.Open("dir")
+	require.NoError(t, err)
+	names, err := f.Readdirnames(-1)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, []string{"nested"}, names)
+
+	count, err := cache.Count()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	size, err := cache.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(11), size)
+
+	err = cache.Remove("file")
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("file"))
+	err = cache.PurgeKey("dir", 0)
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("dir"))
+	entries, err := os.ReadDir(filepath.Dir(cache.linkPath("dir")))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// Regular files are not mistaken for markers.
+	content := append([]byte("localcache-link\x00"), make([]byte, 10)...)
+	err = cache.WriteFile("plain", content)
+	require.NoError(t, err)
+	require.NoError(t, cache.AssertContent("plain", content))
+}
@@ -0,0 +1,16 @@
+package localcache
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Windows error returned when creating a symlink without SeCreateSymbolicLinkPrivilege.
+const errorPrivilegeNotHeld = syscall.Errno(1314)
+
+func defaultFS() FS { return SymlinkFallbackFS(OSFS{}) }
+
+func isPrivilegeError(err error) bool {
+	return errors.Is(err, errorPrivilegeNotHeld) || errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,18 @@
+package localcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultFSFallsBackWithoutSymlinkPrivilege(t *testing.T) {
+	cache := NewForTesting(t)
+	require.IsType(t, symlinkFallbackFS{}, cache.fs)
+	err := cache.WriteFile("file", []byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, cache.AssertContent("file", []byte("hello")))
+	err = cache.Remove("file")
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("file"))
+}
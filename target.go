@@ -0,0 +1,80 @@
+package localcache
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ParseFunc recovers the hash and creation time from the name of a
+// committed target formatted by a WithTargetFormat format function.
+//
+// It must return an error for names it did not format, including bare hashes.
+type ParseFunc func(name string) (hash string, created time.Time, err error)
+
+// WithTargetFormat sets how the committed targets of entries are named on disk.
+//
+// format returns the name of the target for the hash of a key and the
+// entry's creation time, and parse must recover both from that name so the
+// entry can be purged. The name must not contain a path separator. The
+// default format is "<hash>.<hex nanosecond timestamp>".
+//
+// In-flight Transactions are always named using the default format.
+func WithTargetFormat(format func(hash string, created time.Time) string, parse ParseFunc) Option {
+	return func(c *Cache) {
+		c.formatTarget = format
+		c.parseTargetName = parse
+	}
+}
+
+func defaultTargetFormat(h string, created time.Time) string {
+	return fmt.Sprintf("%s.%x", h, created.UnixNano())
+}
+
+func parseDefaultTarget(name string) (string, time.Time, error) {
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return "", time.Time{}, fmt.Errorf("invalid cache entry %q: no timestamp", name)
+	}
+	created, err := entryTime(name)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return strings.TrimSuffix(name, ext), created, nil
+}
+
+// targetName returns the name of the committed target for a hash created at created.
+func (c *Cache) targetName(h string, created time.Time) string {
+	if c.formatTarget != nil {
+		return c.formatTarget(h, created)
+	}
+	return defaultTargetFormat(h, created)
+}
+
+// parseTarget returns the path of the symlink for the target or in-flight
+// Transaction at path, and its creation time.
+func (c *Cache) parseTarget(path string) (link string, created time.Time, err error) {
+	name := filepath.Base(path)
+	var h string
+	if c.parseTargetName != nil {
+		h, created, err = c.parseTargetName(name)
+	}
+	if c.parseTargetName == nil || err != nil {
+		// In-flight Transactions are always in the default format.
+		var derr error
+		if h, created, derr = parseDefaultTarget(name); derr != nil {
+			if err == nil {
+				err = derr
+			}
+			return "", time.Time{}, err
+		}
+	}
+	return filepath.Join(filepath.Dir(path), h), created, nil
+}
+
+// targetTime returns the creation time of a committed target.
+func (c *Cache) targetTime(target string) (time.Time, error) {
+	_, created, err := c.parseTarget(target)
+	return created, err
+}
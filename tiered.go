@@ -0,0 +1,66 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WithWriteThrough synchronously copies every entry committed with Commit
+// to secondary.
+//
+// If writing to secondary fails, onError is called with the error. If it
+// returns nil the failure is ignored, otherwise Commit returns its error,
+// though the entry remains committed locally. A nil onError fails all
+// commits that cannot be written through.
+func WithWriteThrough(secondary *Cache, onError func(err error) error) Option {
+	return func(c *Cache) {
+		c.secondary = secondary
+		c.onSecondaryErr = onError
+	}
+}
+
+// writeToSecondary copies the committed entry at link to the secondary Cache, if any.
+func (c *Cache) writeToSecondary(link string) error {
+	if c.secondary == nil {
+		return nil
+	}
+	info, err := c.info(link)
+	if err == nil {
+		err = c.secondary.mergeEntry(c, info, Overwrite)
+	}
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("write-through of %s failed: %w", filepath.Base(link), err)
+	if c.onSecondaryErr == nil {
+		return err
+	}
+	return c.onSecondaryErr(err)
+}
+
+// WithReadFallback reads entries missing from the Cache from secondary.
+//
+// Entries found in secondary are atomically copied into the Cache before
+// being returned, so subsequent reads are served locally.
+func WithReadFallback(secondary *Cache) Option {
+	return func(c *Cache) { c.fallback = secondary }
+}
+
+// readFromFallback copies the entry for key from the fallback Cache.
+//
+// It is not an error for the entry to be missing from the fallback.
+func (c *Cache) readFromFallback(key string) error {
+	info, err := c.fallback.info(c.fallback.linkPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	info.Key = key
+	if err := c.mergeEntry(c.fallback, info, KeepExisting); err != nil {
+		return fmt.Errorf("failed to read %s from fallback: %w", info.id(), err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package localcache
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteThrough(t *testing.T) {
+	secondary := NewForTesting(t)
+	cache := NewForTesting(t, WithWriteThrough(secondary, nil))
+	err := cache.WriteFile("test", []byte("hello"))
+	require.NoError(t, err)
+	for _, c := range []*Cache{cache, secondary} {
+		data, err := c.ReadFile("test")
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(data))
+	}
+
+	// Hard failure.
+	err = os.RemoveAll(secondary.root)
+	require.NoError(t, err)
+	err = cache.WriteFile("hard", []byte("hello"))
+	require.ErrorContains(t, err, "write-through")
+	require.NotEmpty(t, cache.IfExists("hard"))
+
+	// Soft failure.
+	var failures []error
+	cache = NewForTesting(t, WithWriteThrough(secondary, func(err error) error {
+		failures = append(failures, err)
+		return nil
+	}))
+	err = cache.WriteFile("soft", []byte("hello"))
+	require.NoError(t, err)
+	require.Len(t, failures, 1)
+	require.NotEmpty(t, cache.IfExists("soft"))
+}
+
+func TestReadFallback(t *testing.T) {
+	secondary := NewForTesting(t)
+	cache := NewForTesting(t, WithReadFallback(secondary))
+	err := secondary.WriteFile("test", []byte("hello"))
+	require.NoError(t, err)
+
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	require.NotEmpty(t, cache.IfExists("test"))
+
+	err = secondary.Remove("test")
+	require.NoError(t, err)
+	data, err = cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	_, err = cache.ReadFile("missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
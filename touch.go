@@ -0,0 +1,142 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Touch resets the age of the committed entry for key to zero, by
+// re-timestamping its target with the current time.
+//
+// Combined with Purge, calling Touch when an entry is read approximates
+// least-recently-used eviction. The entry is re-timestamped by cloning it to
+// a new target, hard linking its files if the FS supports them and copying
+// them otherwise, so the entry remains readable throughout. Entries
+// published with Link have no age and are unaffected.
+func (c *Cache) Touch(key string) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	if err := c.touch(c.linkPath(key), c.clock.Now()); err != nil {
+		return fmt.Errorf("failed to touch %q: %w", key, err)
+	}
+	return nil
+}
+
+// TouchAll resets the age of every committed entry to zero, by
+// re-timestamping each entry's target with the current time.
+//
+// Entries published with Link have no age and are unaffected. Failure to
+// touch an individual entry does not stop the walk, and all such errors are
+// returned.
+func (c *Cache) TouchAll() error {
+	links, err := c.committed()
+	if err != nil {
+		return err
+	}
+	now := c.clock.Now()
+	var errs []error
+	for _, link := range links {
+		if err := c.touch(link, now); err != nil {
+			errs = append(errs, fmt.Errorf("failed to touch %s: %w", link, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// touch re-timestamps the committed entry at link with now.
+func (c *Cache) touch(link string, now time.Time) error {
+	target, err := c.fs.Readlink(link)
+	if err != nil {
+		return err
+	}
+	if !c.owns(target) {
+		return nil
+	}
+	created, err := c.targetTime(target)
+	if err != nil || created.Equal(now) {
+		return err
+	}
+	newTarget, err := c.linkTarget(target, link, now)
+	if err != nil {
+		return err
+	}
+	// The previous target is removed once the symlink is swapped. If the
+	// entry was committed again in the meantime, the new entry is kept.
+	swapped, err := c.swapLinkFrom(link, target, newTarget)
+	if !swapped && err == nil {
+		err = c.removeTarget(newTarget)
+	}
+	return err
+}
+
+// linkerFS is implemented by FSs that support hard links.
+type linkerFS interface {
+	Link(oldname, newname string) error
+}
+
+func (OSFS) Link(oldname, newname string) error { return os.Link(oldname, newname) }
+
+func (s symlinkFallbackFS) Link(oldname, newname string) error {
+	l, ok := s.FS.(linkerFS)
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.New("hard links are not supported")}
+	}
+	return l.Link(oldname, newname)
+}
+
+// linkTarget clones the target of the committed entry at link, and its
+// metadata, to a new target with the given creation time, leaving the
+// existing target in place.
+func (c *Cache) linkTarget(target, link string, created time.Time) (string, error) {
+	newTarget := filepath.Join(filepath.Dir(link), c.targetName(filepath.Base(link), created))
+	if err := checkPathLength(newTarget); err != nil {
+		return "", err
+	}
+	if err := c.cloneEntry(newTarget, target, 0); err != nil {
+		_ = c.fs.RemoveAll(newTarget)
+		return "", fmt.Errorf("failed to clone entry: %w", err)
+	}
+	err := c.cloneEntry(c.metaPath(newTarget), c.metaPath(target), 0)
+	if err != nil && !os.IsNotExist(err) {
+		_ = c.fs.RemoveAll(newTarget)
+		return "", fmt.Errorf("failed to clone metadata: %w", err)
+	}
+	return newTarget, nil
+}
+
+// cloneEntry creates path as a clone of the file or directory src, hard
+// linking files if the FS supports hard links, and otherwise copying them
+// with their permissions.
+func (c *Cache) cloneEntry(path, src string, depth int) error {
+	info, err := c.fs.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if l, ok := c.fs.(linkerFS); ok && l.Link(src, path) == nil {
+			return nil
+		}
+		return copyFile(c.fs, path, c.fs, src, info.Mode().Perm())
+	}
+	if err := c.checkDepth(src, depth); err != nil {
+		return err
+	}
+	if err := c.fs.Mkdir(path, c.dirPerm()); err != nil {
+		return err
+	}
+	entries, err := c.fs.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := c.cloneEntry(filepath.Join(path, entry.Name()), filepath.Join(src, entry.Name()), depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return c.fs.Chmod(path, info.Mode().Perm())
+}
@@ -0,0 +1,133 @@
+package localcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTouchAll(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := &fakeClock{currentTime: time.Now()}
+
+		cache := newCache(WithClock(testClock))
+		keys := []string{"one", "two", "three"}
+		for _, key := range keys {
+			err := cache.WriteFile(key, []byte(key))
+			require.NoError(t, err)
+		}
+		testClock.advance(time.Hour)
+
+		err := cache.TouchAll()
+		require.NoError(t, err)
+		err = cache.Purge(time.Minute)
+		require.NoError(t, err)
+		for _, key := range keys {
+			data, err := cache.ReadFile(key)
+			require.NoError(t, err)
+			require.Equal(t, key, string(data))
+		}
+	})
+}
+
+func TestTouch(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+
+	cache := NewForTesting(t, WithClock(testClock))
+	tx, f, err := cache.CreateWithContentType("hot", "text/plain")
+	require.NoError(t, err)
+	_, err = f.WriteString("hot")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	require.NoError(t, cache.WriteFile("cold", []byte("cold")))
+	testClock.advance(time.Hour)
+	target, err := os.Readlink(cache.linkPath("hot"))
+	require.NoError(t, err)
+
+	err = cache.Touch("hot")
+	require.NoError(t, err)
+	touched, err := os.Readlink(cache.linkPath("hot"))
+	require.NoError(t, err)
+	require.NotEqual(t, target, touched)
+	_, err = os.Stat(target)
+	require.True(t, os.IsNotExist(err), "previous target should be removed")
+
+	err = cache.Purge(time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, cache.AssertContent("hot", []byte("hot")))
+	meta, err := cache.GetMeta("hot")
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", meta.ContentType)
+	require.Empty(t, cache.IfExists("cold"))
+
+	err = cache.Touch("missing")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestTouchReplaced(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+	cache := NewForTesting(t, WithClock(testClock))
+	err := cache.WriteFile("test", []byte("old"))
+	require.NoError(t, err)
+	link := cache.linkPath("test")
+	old, err := os.Readlink(link)
+	require.NoError(t, err)
+	testClock.advance(time.Hour)
+	err = cache.WriteFile("test", []byte("new"))
+	require.NoError(t, err)
+	current, err := os.Readlink(link)
+	require.NoError(t, err)
+
+	// A swap from a target that has since been replaced does nothing.
+	swapped, err := cache.swapLinkFrom(link, old, current+".touched")
+	require.NoError(t, err)
+	require.False(t, swapped)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+}
+
+func TestTouchDir(t *testing.T) {
+	testClock := NewManualClock(time.Now())
+	var (
+		link, target string
+		swaps        int
+	)
+	fs := renameHookFS{FS: OSFS{}, hook: func(oldpath, newpath string) error {
+		if newpath == link {
+			// The previous target is still in place when the link is swapped.
+			data, err := os.ReadFile(filepath.Join(target, "file"))
+			require.NoError(t, err)
+			require.Equal(t, "content", string(data))
+			swaps++
+		}
+		return nil
+	}}
+	cache := NewForTesting(t, WithFS(fs), WithClock(testClock))
+	require.NoError(t, cache.ReplaceDir("dir", func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0600)
+	}))
+	link = cache.linkPath("dir")
+	var err error
+	target, err = cache.fs.Readlink(link)
+	require.NoError(t, err)
+
+	testClock.Advance(time.Hour)
+	require.NoError(t, cache.Touch("dir"))
+	require.Equal(t, 1, swaps)
+	created, err := cache.EntryTime("dir")
+	require.NoError(t, err)
+	require.True(t, created.Equal(testClock.Now()))
+	newTarget, err := cache.fs.Readlink(link)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(newTarget, "file"))
+	require.NoError(t, err)
+	require.Equal(t, "content", string(data))
+	_, err = os.Stat(target)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,171 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory under the cache root containing soft-deleted entries.
+const trashDir = ".trash"
+
+// WithSoftDelete causes Remove to move entries to a trash area rather than
+// deleting them immediately.
+//
+// Removed entries can be recovered with Restore until they are older than
+// grace, after which they are permanently deleted by a background sweep (see
+// SweepTrash) that runs until the Cache is closed.
+func WithSoftDelete(grace time.Duration) Option {
+	return func(c *Cache) { c.softDelete = grace }
+}
+
+// trash soft-deletes a committed entry's symlink.
+//
+// The symlink is removed and its target is moved to the trash, named after
+// the original target with the deletion time appended. If the target is
+// referenced via Acquire, it is moved once the last reference is released.
+func (c *Cache) trash(link string) error {
+	target, err := c.fs.Readlink(link)
+	if err != nil {
+		return fmt.Errorf("failed to read entry: %w", err)
+	}
+	err = c.fs.Remove(link)
+	if err != nil {
+		return fmt.Errorf("failed to remove cache entry: %w", err)
+	}
+	ierr := c.indexDelete(link)
+	if !c.owns(target) {
+		return ierr
+	}
+	trashed := filepath.Join(c.root, trashDir, fmt.Sprintf("%s.%x", filepath.Base(target), c.clock.Now().UnixNano()))
+	if c.refs.deferAction(target, func() { _ = c.moveToTrash(target, trashed) }) {
+		return ierr
+	}
+	if err := c.moveToTrash(target, trashed); err != nil {
+		return err
+	}
+	return ierr
+}
+
+// moveToTrash renames the target of a removed entry to trashed.
+func (c *Cache) moveToTrash(target, trashed string) error {
+	err := c.mkdir(filepath.Dir(trashed))
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create trash: %w", err)
+	}
+	err = c.fs.Rename(target, trashed)
+	if err != nil {
+		return fmt.Errorf("failed to move entry to trash: %w", err)
+	}
+	return nil
+}
+
+// Restore recovers the most recently soft-deleted entry for key.
+//
+// An error is returned if key has no entry in the trash, or if a new entry
+// has since been committed for key. An entry that was referenced via Acquire
+// when it was removed is only in the trash once the reference is released.
+func (c *Cache) Restore(key string) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	h := c.keyHash(key)
+	link := c.linkPath(key)
+	if _, err := c.fs.Lstat(link); err == nil {
+		return fmt.Errorf("cannot restore %q: key exists", key)
+	}
+	trashed, err := c.fs.Glob(filepath.Join(c.root, trashDir, "*"))
+	if err != nil {
+		return fmt.Errorf("could not list trash: %w", err)
+	}
+	var (
+		newest  string
+		deleted time.Time
+	)
+	for _, path := range trashed {
+		ts, err := entryTime(path)
+		if err != nil {
+			continue
+		}
+		original, _, err := c.parseTarget(strings.TrimSuffix(path, filepath.Ext(path)))
+		if err != nil || filepath.Base(original) != h {
+			continue
+		}
+		if newest == "" || ts.After(deleted) {
+			newest, deleted = path, ts
+		}
+	}
+	if newest == "" {
+		return fmt.Errorf("cannot restore %q: %w", key, os.ErrNotExist)
+	}
+	target := filepath.Join(filepath.Dir(link), strings.TrimSuffix(filepath.Base(newest), filepath.Ext(newest)))
+	err = c.mkdir(filepath.Dir(target))
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cache partition: %w", err)
+	}
+	err = c.fs.Rename(newest, target)
+	if err != nil {
+		return fmt.Errorf("failed to restore entry: %w", err)
+	}
+	// Only restore the entry if no other has been committed in the meantime,
+	// recording its key so it is listed by Keys.
+	c.indexKey(key)
+	swapped, err := c.swapLinkFrom(link, "", target)
+	if err == nil && !swapped {
+		err = fmt.Errorf("cannot restore %q: key exists", key)
+	}
+	if !swapped {
+		c.keyNames.forget(h)
+		if rerr := c.fs.Rename(target, newest); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to return entry to trash: %w", rerr))
+		}
+	}
+	return err
+}
+
+// SweepTrash permanently deletes soft-deleted entries that were removed
+// longer ago than the WithSoftDelete grace period.
+func (c *Cache) SweepTrash() error {
+	trashed, err := c.fs.Glob(filepath.Join(c.root, trashDir, "*"))
+	if err != nil {
+		return fmt.Errorf("could not list trash: %w", err)
+	}
+	var errs []error
+	for _, path := range trashed {
+		deleted, err := entryTime(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if c.clock.Since(deleted) < c.softDelete {
+			continue
+		}
+		// Remove the trashed entry along with the metadata of its original target.
+		original := strings.TrimSuffix(path, filepath.Ext(path))
+		if err := c.fs.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = c.fs.Remove(c.metaPath(original))
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) sweepTrashPeriodically() {
+	ticker := time.NewTicker(c.softDelete)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			_ = c.SweepTrash()
+		}
+	}
+}
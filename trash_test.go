@@ -0,0 +1,80 @@
+package localcache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDelete(t *testing.T) {
+	testClock := &fakeClock{currentTime: time.Now()}
+
+	cache := NewForTesting(t, WithClock(testClock), WithSoftDelete(time.Hour))
+	tx, f, err := cache.CreateWithContentType("test", "text/plain")
+	require.NoError(t, err)
+	_, err = f.WriteString("hello")
+	require.NoError(t, err)
+	_ = f.Close()
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+
+	err = cache.Remove("test")
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("test"))
+
+	testClock.advance(30 * time.Minute)
+	err = cache.SweepTrash()
+	require.NoError(t, err)
+	err = cache.Restore("test")
+	require.NoError(t, err)
+	data, err := cache.ReadFile("test")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	meta, err := cache.GetMeta("test")
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", meta.ContentType)
+
+	err = cache.Remove("test")
+	require.NoError(t, err)
+	testClock.advance(2 * time.Hour)
+	err = cache.SweepTrash()
+	require.NoError(t, err)
+	err = cache.Restore("test")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Equal(t, []string{"", "/" + locksDir, "/" + locksDir + "/9f", "/" + metaDir, "/" + pendingDir, "/" + trashDir, "/9f"}, list(cache))
+}
+
+func TestSoftDeleteAcquired(t *testing.T) {
+	cache := NewForTesting(t, WithSoftDelete(time.Hour), WithIndex())
+	require.NoError(t, cache.WriteFile("test", []byte("hello")))
+	path, release, err := cache.Acquire("test")
+	require.NoError(t, err)
+
+	// The acquired target is only moved to the trash once released.
+	require.NoError(t, cache.Remove("test"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	require.ErrorIs(t, cache.Restore("test"), os.ErrNotExist)
+	release()
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	// Restored entries are indexed again.
+	require.NoError(t, cache.Restore("test"))
+	require.NoError(t, cache.AssertContent("test", []byte("hello")))
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"test"}, keys)
+
+	// A restore never replaces an entry committed since.
+	require.NoError(t, cache.Remove("test"))
+	require.NoError(t, cache.WriteFile("test", []byte("new")))
+	require.Error(t, cache.Restore("test"))
+	require.NoError(t, cache.AssertContent("test", []byte("new")))
+
+	require.NoError(t, cache.Close())
+	require.ErrorIs(t, cache.Restore("test"), ErrClosed)
+}
@@ -0,0 +1,163 @@
+package localcache
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// NoTTL may be passed to CreateWithTTL to create an entry that never expires,
+// regardless of WithDefaultTTL.
+const NoTTL time.Duration = -1
+
+// WithDefaultTTL sets the TTL of entries created without an explicit TTL.
+//
+// The TTL is recorded in each entry's metadata when it is created, so
+// changing the default does not affect existing entries. Expired entries are
+// removed by PurgeExpired.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(c *Cache) { c.defaultTTL = ttl }
+}
+
+// CreateWithTTL creates a file in the Cache, as with Create, that expires ttl
+// after it was created.
+//
+// ttl overrides WithDefaultTTL. Pass NoTTL to create an entry that never
+// expires.
+func (c *Cache) CreateWithTTL(key string, ttl time.Duration) (Transaction, *os.File, error) {
+	tx, f, err := c.Create(key)
+	if err != nil {
+		return "", nil, err
+	}
+	err = c.updateMeta(c.txPath(tx), func(meta *EntryMeta) { meta.TTL = ttl })
+	if err != nil {
+		_ = f.Close()
+		_ = c.Rollback(tx)
+		return "", nil, err
+	}
+	return tx, f, nil
+}
+
+// WriteFileTTL writes a byte slice to a file in the cache, as with WriteFile,
+// that expires ttl after it was written.
+//
+// ttl overrides WithDefaultTTL. Pass NoTTL to write an entry that never
+// expires.
+func (c *Cache) WriteFileTTL(key string, data []byte, ttl time.Duration) error {
+	return c.writeFile(key, data, func(meta *EntryMeta) { meta.TTL = ttl })
+}
+
+// applyDefaultTTL records the default TTL, if any, in the metadata of a new
+// in-flight entry.
+func (c *Cache) applyDefaultTTL(path string) error {
+	if c.defaultTTL == 0 {
+		return nil
+	}
+	return c.updateMeta(path, func(meta *EntryMeta) { meta.TTL = c.defaultTTL })
+}
+
+// PurgeExpired removes committed entries that are older than their TTL.
+//
+// Entries without a TTL, and entries published with Link, never expire.
+// Failure to remove an individual entry does not stop the purge, and all
+// such errors are returned.
+func (c *Cache) PurgeExpired() error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	var (
+		expired []CacheInfo
+		errs    []error
+	)
+	err := c.Range(func(info CacheInfo) bool {
+		ok, err := c.expiredTTL(info)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			expired = append(expired, info)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, info := range expired {
+		if _, err := c.evict(info); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithJanitor periodically removes expired entries in the background, as
+// with PurgeExpired, every interval until the Cache is closed.
+func WithJanitor(interval time.Duration) Option {
+	return func(c *Cache) { c.janitor = interval }
+}
+
+func (c *Cache) purgeExpiredPeriodically() {
+	ticker := time.NewTicker(c.janitor)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			_ = c.PurgeExpired()
+		}
+	}
+}
+
+// expiredTTL returns true if a committed entry is older than its TTL.
+func (c *Cache) expiredTTL(info CacheInfo) (bool, error) {
+	if info.Created.IsZero() {
+		return false, nil
+	}
+	target, err := c.fs.Readlink(info.Path)
+	if err != nil {
+		return false, err
+	}
+	return c.expiredTarget(target)
+}
+
+// expiredTarget returns true if a committed entry's target is older than its
+// TTL.
+func (c *Cache) expiredTarget(target string) (bool, error) {
+	if !c.owns(target) {
+		return false, nil
+	}
+	created, err := c.targetTime(target)
+	if err != nil {
+		return false, err
+	}
+	meta, err := c.readMeta(target)
+	if err != nil || meta.TTL <= 0 {
+		return false, err
+	}
+	return c.clock.Since(created) >= meta.TTL, nil
+}
+
+// WithExpiryEnforced causes entries older than their TTL to be treated as
+// missing by IfExists and by methods reading entries, such as Open and
+// ReadFile, rather than only being removed by PurgeExpired.
+//
+// This requires reading each entry's metadata when it is accessed.
+func WithExpiryEnforced() Option {
+	return func(c *Cache) { c.enforceExpiry = true }
+}
+
+// checkExpiry returns an error satisfying os.IsNotExist if WithExpiryEnforced
+// is set and the committed entry at link has expired.
+func (c *Cache) checkExpiry(link, target string) error {
+	if !c.enforceExpiry {
+		return nil
+	}
+	expired, err := c.expiredTarget(target)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return &os.PathError{Op: "open", Path: link, Err: os.ErrNotExist}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package localcache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultTTL(t *testing.T) {
+	testClock := NewManualClock(time.Now())
+	cache := NewForTesting(t, WithClock(testClock), WithDefaultTTL(time.Hour))
+	err := cache.WriteFile("default", []byte("data"))
+	require.NoError(t, err)
+	meta, err := cache.GetMeta("default")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, meta.TTL)
+
+	for key, ttl := range map[string]time.Duration{"short": time.Minute, "long": 2 * time.Hour, "forever": NoTTL} {
+		tx, f, err := cache.CreateWithTTL(key, ttl)
+		require.NoError(t, err)
+		_, err = f.WriteString(key)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		_, err = cache.Commit(tx)
+		require.NoError(t, err)
+	}
+
+	testClock.Advance(30 * time.Minute)
+	err = cache.PurgeExpired()
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("short"))
+	require.NotEmpty(t, cache.IfExists("default"))
+
+	testClock.Advance(time.Hour)
+	err = cache.PurgeExpired()
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("default"))
+	require.NotEmpty(t, cache.IfExists("long"))
+
+	testClock.Advance(24 * time.Hour)
+	err = cache.PurgeExpired()
+	require.NoError(t, err)
+	require.Empty(t, cache.IfExists("long"))
+	require.NotEmpty(t, cache.IfExists("forever"))
+}
+
+func TestNoDefaultTTL(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		testClock := NewManualClock(time.Now())
+		cache := newCache(WithClock(testClock))
+		err := cache.WriteFile("key", []byte("data"))
+		require.NoError(t, err)
+		testClock.Advance(24 * time.Hour)
+		err = cache.PurgeExpired()
+		require.NoError(t, err)
+		require.NotEmpty(t, cache.IfExists("key"))
+	})
+}
+
+func TestWriteFileTTL(t *testing.T) {
+	testClock := NewManualClock(time.Now())
+	cache := NewForTesting(t, WithClock(testClock), WithExpiryEnforced())
+	err := cache.WriteFileTTL("token", []byte("token"), 5*time.Minute)
+	require.NoError(t, err)
+	err = cache.WriteFileTTL("artifact", []byte("artifact"), 7*24*time.Hour)
+	require.NoError(t, err)
+	require.NotEmpty(t, cache.IfExists("token"))
+
+	testClock.Advance(10 * time.Minute)
+	require.Empty(t, cache.IfExists("token"))
+	_, err = cache.ReadFile("token")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = cache.Open("token")
+	require.ErrorIs(t, err, ErrNotFound)
+	data, err := cache.ReadFile("artifact")
+	require.NoError(t, err)
+	require.Equal(t, "artifact", string(data))
+
+	// The expired entry remains on disk until purged.
+	_, err = os.Lstat(cache.linkPath("token"))
+	require.NoError(t, err)
+	err = cache.PurgeExpired()
+	require.NoError(t, err)
+	_, err = os.Lstat(cache.linkPath("token"))
+	require.True(t, os.IsNotExist(err), "%v", err)
+	require.NotEmpty(t, cache.IfExists("artifact"))
+}
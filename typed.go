@@ -0,0 +1,82 @@
+package localcache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Codec encodes and decodes values stored in a Typed cache.
+type Codec interface {
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+var (
+	// JSONCodec encodes values with encoding/json.
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec encodes values with encoding/gob.
+	GobCodec Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) }
+func (jsonCodec) Decode(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(w io.Writer, v any) error { return gob.NewEncoder(w).Encode(v) }
+func (gobCodec) Decode(r io.Reader, v any) error { return gob.NewDecoder(r).Decode(v) }
+
+// Typed stores values of type T in a Cache, encoded with a Codec.
+type Typed[T any] struct {
+	cache *Cache
+	codec Codec
+}
+
+// NewTyped creates a Typed cache storing values in c, encoded with codec.
+func NewTyped[T any](c *Cache, codec Codec) *Typed[T] {
+	return &Typed[T]{cache: c, codec: codec}
+}
+
+// Get decodes the value for key.
+//
+// found is false if key has no entry.
+func (t *Typed[T]) Get(key string) (value T, found bool, err error) {
+	f, err := t.cache.open(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return value, false, nil
+	} else if err != nil {
+		return value, false, err
+	}
+	defer f.Close()
+	if err := t.codec.Decode(f, &value); err != nil {
+		return value, false, fmt.Errorf("failed to decode %q: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// Put atomically encodes and stores value for key.
+//
+// Nothing is stored if encoding fails or the codec panics.
+func (t *Typed[T]) Put(key string, value T) (err error) {
+	tx, f, err := t.cache.create(key)
+	if err != nil {
+		return err
+	}
+	defer t.cache.RollbackOrCommit(tx, &err)
+	// Closed before rolling back if the codec panics.
+	defer f.Close() //nolint:errcheck
+	err = t.codec.Encode(f, value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode %q: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package localcache
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type typedValue struct {
+	Name  string
+	Count int
+}
+
+func TestTyped(t *testing.T) {
+	for name, codec := range map[string]Codec{"json": JSONCodec, "gob": GobCodec} {
+		t.Run(name, func(t *testing.T) {
+			cache := NewTyped[typedValue](NewForTesting(t), codec)
+			_, found, err := cache.Get("key")
+			require.NoError(t, err)
+			require.False(t, found)
+
+			want := typedValue{Name: "hello", Count: 42}
+			err = cache.Put("key", want)
+			require.NoError(t, err)
+			got, found, err := cache.Get("key")
+			require.NoError(t, err)
+			require.True(t, found)
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestTypedDecodeError(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		err := cache.WriteFile("key", []byte("not json"))
+		require.NoError(t, err)
+		_, found, err := NewTyped[typedValue](cache, JSONCodec).Get("key")
+		require.ErrorContains(t, err, `failed to decode "key"`)
+		require.False(t, found)
+	})
+}
+
+// panicCodec writes partial output and then panics.
+type panicCodec struct{ Codec }
+
+func (panicCodec) Encode(w io.Writer, v any) error {
+	_, _ = w.Write([]byte("partial"))
+	panic("encode failed")
+}
+
+func TestTypedPutPanic(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache()
+		typed := NewTyped[typedValue](cache, panicCodec{JSONCodec})
+		require.Panics(t, func() { _ = typed.Put("key", typedValue{Name: "hello"}) })
+		require.Empty(t, cache.IfExists("key"))
+		pending, err := cache.PendingTransactions()
+		require.NoError(t, err)
+		require.Empty(t, pending)
+	})
+}
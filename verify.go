@@ -0,0 +1,52 @@
+package localcache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// WriteFileVerified writes data to the entry for key, as with WriteFile,
+// recording its SHA-256 in the entry's metadata for ReadFileVerified.
+func (c *Cache) WriteFileVerified(key string, data []byte) error {
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	return c.writeFile(key, data, func(meta *EntryMeta) { meta.SHA256 = sum })
+}
+
+// ReadFileVerified reads the entry for key, as with ReadFile, and checks
+// that the hex SHA-256 of its content matches wantSHA256.
+//
+// If wantSHA256 is empty the checksum recorded by WriteFileVerified is used,
+// and it is an error if there is none. If the content does not match, the
+// corrupt entry is removed and the error wraps ErrChecksumMismatch.
+func (c *Cache) ReadFileVerified(key string, wantSHA256 string) ([]byte, error) {
+	f, target, err := c.openEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	if wantSHA256 == "" {
+		meta, err := c.readMeta(target)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if meta.SHA256 == "" {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s: no checksum recorded", key)
+		}
+		wantSHA256 = meta.SHA256
+	}
+	data, err := c.readEntry(f, target)
+	if err != nil {
+		return nil, err
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if strings.EqualFold(sum, wantSHA256) {
+		return data, nil
+	}
+	err = fmt.Errorf("%s: %w: got %s, expected %s", key, ErrChecksumMismatch, sum, wantSHA256)
+	if _, rerr := c.removeLinkTo(c.linkPath(key), target); rerr != nil {
+		return nil, fmt.Errorf("%w: failed to remove entry: %w", err, rerr)
+	}
+	return nil, err
+}
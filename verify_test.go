@@ -0,0 +1,54 @@
+package localcache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFileVerified(t *testing.T) {
+	cache := NewForTesting(t)
+	data := []byte("binary")
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	require.NoError(t, cache.WriteFile("plain", data))
+	got, err := cache.ReadFileVerified("plain", sum)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	_, err = cache.ReadFileVerified("plain", "")
+	require.Error(t, err)
+
+	require.NoError(t, cache.WriteFileVerified("verified", data))
+	got, err = cache.ReadFileVerified("verified", "")
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	meta, err := cache.GetMeta("verified")
+	require.NoError(t, err)
+	require.Equal(t, sum, meta.SHA256)
+
+	// Corrupt the entry on disk.
+	require.NoError(t, os.WriteFile(cache.IfExists("verified"), []byte("binar"), 0600))
+	_, err = cache.ReadFileVerified("verified", "")
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	require.Empty(t, cache.IfExists("verified"))
+
+	_, err = cache.ReadFileVerified("missing", sum)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestReadFileVerifiedCompressed(t *testing.T) {
+	forEachFS(t, func(t *testing.T, newCache func(options ...Option) *Cache) {
+		cache := newCache(WithCompression())
+		data := []byte("compressed binary")
+		require.NoError(t, cache.WriteFileVerified("a", data))
+		got, err := cache.ReadFileVerified("a", fmt.Sprintf("%X", sha256.Sum256(data)))
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+		got, err = cache.ReadFileVerified("a", "")
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	})
+}
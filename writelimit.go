@@ -0,0 +1,138 @@
+package localcache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrTooManyWrites is returned by Create and Mkdir when the limit set by
+// WithMaxConcurrentWrites has been reached and WithFailFastWrites is set.
+var ErrTooManyWrites = errors.New("localcache: too many concurrent writes")
+
+// WithMaxConcurrentWrites limits the number of in-flight write Transactions to n.
+//
+// Create and Mkdir block until a slot is available, which is released by a
+// successful Commit or by Rollback. Values of n below 1 impose no limit.
+func WithMaxConcurrentWrites(n int) Option {
+	return func(c *Cache) {
+		if n < 1 {
+			return
+		}
+		if c.writes == nil {
+			c.writes = &writeLimiter{held: map[Transaction]bool{}}
+		}
+		c.writes.slots = make(chan struct{}, n)
+	}
+}
+
+// WithFailFastWrites causes Create and Mkdir to return ErrTooManyWrites
+// rather than blocking when the WithMaxConcurrentWrites limit is reached.
+func WithFailFastWrites() Option {
+	return func(c *Cache) {
+		if c.writes == nil {
+			c.writes = &writeLimiter{held: map[Transaction]bool{}}
+		}
+		c.writes.failFast = true
+	}
+}
+
+// WithWriteRateLimit paces commits to at most limit per second, allowing
+// bursts of up to burst commits.
+//
+// Commit blocks until the limiter allows the write; use CommitContext to
+// bound the wait.
+func WithWriteRateLimit(limit rate.Limit, burst int) Option {
+	return func(c *Cache) { c.rate = rate.NewLimiter(limit, burst) }
+}
+
+// writeLimiter is a semaphore over in-flight Transactions.
+//
+// A nil writeLimiter imposes no limit.
+type writeLimiter struct {
+	slots    chan struct{}
+	failFast bool
+	lock     sync.Mutex
+	held     map[Transaction]bool
+	// batch serialises acquireN, so batches waiting for slots can't each
+	// hold part of what they need.
+	batch sync.Mutex
+}
+
+// acquire a slot for a new Transaction.
+func (w *writeLimiter) acquire() error {
+	if w == nil || w.slots == nil {
+		return nil
+	}
+	if w.failFast {
+		select {
+		case w.slots <- struct{}{}:
+			return nil
+		default:
+			return ErrTooManyWrites
+		}
+	}
+	w.slots <- struct{}{}
+	return nil
+}
+
+// acquireN acquires n slots at once for a batch of Transactions.
+func (w *writeLimiter) acquireN(n int) error {
+	if w == nil || w.slots == nil || n == 0 {
+		return nil
+	}
+	if n > cap(w.slots) {
+		return fmt.Errorf("batch of %d writes exceeds the limit of %d concurrent writes", n, cap(w.slots))
+	}
+	w.batch.Lock()
+	defer w.batch.Unlock()
+	for i := 0; i < n; i++ {
+		if !w.failFast {
+			w.slots <- struct{}{}
+			continue
+		}
+		select {
+		case w.slots <- struct{}{}:
+		default:
+			for ; i > 0; i-- {
+				<-w.slots
+			}
+			return ErrTooManyWrites
+		}
+	}
+	return nil
+}
+
+// cancel releases a slot acquired for a Transaction that failed to be created.
+func (w *writeLimiter) cancel() {
+	if w == nil || w.slots == nil {
+		return
+	}
+	<-w.slots
+}
+
+// hold associates an acquired slot with tx.
+func (w *writeLimiter) hold(tx Transaction) {
+	if w == nil || w.slots == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.held[tx] = true
+}
+
+// release the slot held by tx, if any.
+func (w *writeLimiter) release(tx Transaction) {
+	if w == nil || w.slots == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.held[tx] {
+		return
+	}
+	delete(w.held, tx)
+	<-w.slots
+}
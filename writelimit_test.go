@@ -0,0 +1,119 @@
+package localcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestMaxConcurrentWrites(t *testing.T) {
+	cache := NewForTesting(t, WithMaxConcurrentWrites(1))
+	tx, f, err := cache.Create("first")
+	require.NoError(t, err)
+	_ = f.Close()
+
+	created := make(chan error)
+	go func() {
+		tx, f, err := cache.Create("second")
+		if err == nil {
+			_ = f.Close()
+			_, err = cache.Commit(tx)
+		}
+		created <- err
+	}()
+
+	select {
+	case <-created:
+		t.Fatal("second Create should block while the first is in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+	select {
+	case err := <-created:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("second Create did not unblock after Commit")
+	}
+}
+
+func TestMaxConcurrentWritesFailFast(t *testing.T) {
+	cache := NewForTesting(t, WithMaxConcurrentWrites(1), WithFailFastWrites())
+	tx, f, err := cache.Create("first")
+	require.NoError(t, err)
+	_ = f.Close()
+
+	_, _, err = cache.Mkdir("second")
+	require.ErrorIs(t, err, ErrTooManyWrites)
+
+	err = cache.Rollback(tx)
+	require.NoError(t, err)
+	tx, _, err = cache.Mkdir("second")
+	require.NoError(t, err)
+	_, err = cache.Commit(tx)
+	require.NoError(t, err)
+}
+
+func TestWriteRateLimit(t *testing.T) {
+	cache := NewForTesting(t, WithWriteRateLimit(rate.Every(50*time.Millisecond), 1))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		err := cache.WriteFile(fmt.Sprintf("key-%d", i), []byte("data"))
+		require.NoError(t, err)
+	}
+	// The first write uses the burst and the remaining four are paced.
+	require.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+
+	tx, f, err := cache.Create("deadline")
+	require.NoError(t, err)
+	_ = f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = cache.CommitContext(ctx, tx)
+	require.Error(t, err)
+	require.Empty(t, cache.IfExists("deadline"))
+	err = cache.Rollback(tx)
+	require.NoError(t, err)
+}
+
+func TestMaxConcurrentWritesNonPositive(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		cache := NewForTesting(t, WithMaxConcurrentWrites(n), WithFailFastWrites())
+		tx, f, err := cache.Create("first")
+		require.NoError(t, err)
+		_ = f.Close()
+		require.NoError(t, cache.WriteFile("second", []byte("second")))
+		_, err = cache.Commit(tx)
+		require.NoError(t, err)
+	}
+}
+
+func TestMaxConcurrentWritesFailedCommit(t *testing.T) {
+	cache := NewForTesting(t,
+		WithMaxConcurrentWrites(1),
+		WithFailFastWrites(),
+		WithWriteRateLimit(rate.Every(time.Hour), 1))
+	require.NoError(t, cache.WriteFile("burst", []byte("burst")))
+
+	tx, f, err := cache.Create("first")
+	require.NoError(t, err)
+	_ = f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = cache.CommitContext(ctx, tx)
+	require.Error(t, err)
+
+	// The failed Transaction is still in flight, so still holds its slot.
+	_, _, err = cache.Create("second")
+	require.ErrorIs(t, err, ErrTooManyWrites)
+	require.NoError(t, cache.Rollback(tx))
+	tx, f, err = cache.Create("second")
+	require.NoError(t, err)
+	_ = f.Close()
+	require.NoError(t, cache.Rollback(tx))
+}